@@ -0,0 +1,295 @@
+package gcode
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default probe grid options.
+const (
+	defaultGridSafeZ   = 2
+	defaultGridMinZ    = -2
+	defaultGridLogFile = "probe-results.txt"
+)
+
+// heightMapTolerance is the distance within which probed X or Y
+// coordinates are considered to be on the same grid line.
+const heightMapTolerance = 1e-3
+
+// ProbeGridOptions represents options for the ProbeGrid method.
+type ProbeGridOptions struct {
+	// Feedrate is the feedrate of the initial probe. Default is 100.
+	Feedrate *float64
+	// SlowFeedrate, if non-nil, is the feedrate used to reprobe
+	// each point after retracting from the initial contact.
+	SlowFeedrate *float64
+	// SafeZ is the Z height for moving between points. Default is 2.
+	SafeZ *float64
+	// MinZ is the lowest Z to probe to. Default is -2.
+	MinZ *float64
+	// LogFile is the file to which the probe results are logged.
+	// Default is "probe-results.txt".
+	LogFile string
+}
+
+// ProbeGrid probes the surface using G38.2 (G31 with UseFanuc) at nx by
+// ny points of a grid spanning the bounding box from min to max (in XY),
+// visiting the rows alternately left-to-right and right-to-left.
+//
+// The probe results are logged to a file which can be read with
+// ReadHeightMap: LinuxCNC uses (PROBEOPEN) and (PROBECLOSE) and Fanuc
+// uses POPEN, DPRNT, and PCLOS. The probe finishes at SafeZ.
+func (g *GCode) ProbeGrid(min, max Tuple, nx, ny int, opts *ProbeGridOptions) *GCode {
+	if g.xform != nil {
+		log.Fatal("ProbeGrid: probing cycles can not be transformed")
+	}
+	if nx < 2 || ny < 2 {
+		log.Fatalf("ProbeGrid: grid must be at least 2x2, got %vx%v", nx, ny)
+	}
+	if opts == nil {
+		opts = &ProbeGridOptions{}
+	}
+	safeZ := getFloat(opts.SafeZ, defaultGridSafeZ)
+	minZ := getFloat(opts.MinZ, defaultGridMinZ)
+	logFile := opts.LogFile
+	if logFile == "" {
+		logFile = defaultGridLogFile
+	}
+	probe := &ProbeOptions{Feedrate: opts.Feedrate, SlowFeedrate: opts.SlowFeedrate}
+
+	if g.dialect == dialectFanuc {
+		g.sendOpCode("POPEN")
+	} else {
+		g.sendOpCode(fmt.Sprintf("(PROBEOPEN %v)", logFile))
+	}
+
+	g.hasMoved = false
+	g.GotoZ(Z(safeZ))
+	dx := (max.X() - min.X()) / float64(nx-1)
+	dy := (max.Y() - min.Y()) / float64(ny-1)
+	for j := 0; j < ny; j++ {
+		for k := 0; k < nx; k++ {
+			i := k
+			if j%2 == 1 {
+				i = nx - 1 - k
+			}
+			g.hasMoved = false
+			g.GotoXY(XY(min.X()+float64(i)*dx, min.Y()+float64(j)*dy))
+			g.probeAxis(2, -1, safeZ-minZ, probe)
+			if g.dialect == dialectFanuc {
+				g.sendOpCode("DPRNT[X#5061[44]*Y#5062[44]*Z#5063[44]]")
+			}
+			g.GotoZ(Z(safeZ))
+		}
+	}
+
+	if g.dialect == dialectFanuc {
+		g.sendOpCode("PCLOS")
+	} else {
+		g.sendOpCode("(PROBECLOSE)")
+	}
+	return g
+}
+
+// HeightMap represents the height of a surface measured on a
+// rectangular grid, such as by ProbeGrid.
+type HeightMap struct {
+	xs, ys []float64   // grid coordinates in increasing order.
+	z      [][]float64 // z[j][i] is the height at xs[i], ys[j].
+}
+
+// NewHeightMap returns a height map from points measured on a
+// rectangular grid. Every grid point must be measured.
+func NewHeightMap(points []Tuple) (*HeightMap, error) {
+	var allX, allY []float64
+	for _, p := range points {
+		allX = append(allX, p.X())
+		allY = append(allY, p.Y())
+	}
+	h := &HeightMap{xs: gridLines(allX), ys: gridLines(allY)}
+	if len(h.xs) < 2 || len(h.ys) < 2 {
+		return nil, fmt.Errorf("height map needs at least a 2x2 grid, got %vx%v", len(h.xs), len(h.ys))
+	}
+
+	seen := make([][]bool, len(h.ys))
+	h.z = make([][]float64, len(h.ys))
+	for j := range h.z {
+		seen[j] = make([]bool, len(h.xs))
+		h.z[j] = make([]float64, len(h.xs))
+	}
+	for _, p := range points {
+		i, j := nearest(h.xs, p.X()), nearest(h.ys, p.Y())
+		h.z[j][i] = p.Z()
+		seen[j][i] = true
+	}
+	for j, row := range seen {
+		for i, ok := range row {
+			if !ok {
+				return nil, fmt.Errorf("height map is missing grid point (%v,%v)", h.xs[i], h.ys[j])
+			}
+		}
+	}
+	return h, nil
+}
+
+// ReadHeightMap reads a height map from CSV ("x,y,z") or from a probe
+// log written by ProbeGrid. Each line starts with the X, Y, and Z of a
+// point, optionally prefixed by their axis letter, and lines that do
+// not (such as headers) are ignored.
+func ReadHeightMap(r io.Reader) (*HeightMap, error) {
+	var points []Tuple
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) < 3 {
+			continue
+		}
+		var v [3]float64
+		var err error
+		for i := range v {
+			f := strings.TrimLeft(fields[i], "XYZxyz")
+			if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		points = append(points, XYZ(v[0], v[1], v[2]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, errors.New("height map has no points")
+	}
+	return NewHeightMap(points)
+}
+
+// At returns the bilinearly interpolated height at (x,y).
+// Points outside the grid use the height at the nearest edge.
+func (h *HeightMap) At(x, y float64) float64 {
+	i, tx := gridCell(h.xs, x)
+	j, ty := gridCell(h.ys, y)
+	z0 := h.z[j][i] + tx*(h.z[j][i+1]-h.z[j][i])
+	z1 := h.z[j+1][i] + tx*(h.z[j+1][i+1]-h.z[j+1][i])
+	return z0 + ty*(z1-z0)
+}
+
+// ApplyHeightMap compensates the design for the height of the surface
+// by rewriting every G1, G2, and G3 move as G1 moves whose Z is offset
+// by the height map. Moves and arcs are subdivided such that no segment
+// is longer than maxLength in XY. Rapid moves are left unchanged.
+//
+// It should be called once the design is complete and does not support
+// symbolic coordinates or sub-program definitions.
+func (g *GCode) ApplyHeightMap(h *HeightMap, maxLength float64) *GCode {
+	if maxLength <= 0 {
+		log.Fatalf("ApplyHeightMap: invalid maxLength %v", maxLength)
+	}
+	if len(g.subs) > 0 && g.dialect != dialectNone {
+		log.Fatal("ApplyHeightMap: sub-program definitions can not be leveled")
+	}
+
+	plane := PlaneXY
+	prev := XYZ(0, 0, 0)
+	last := prev // last leveled position
+	var steps []*Step
+	for _, step := range g.steps {
+		if step.plane != "" {
+			plane = step.plane
+		}
+		m := step.motion
+		if m == nil || m.opCode == "G0" {
+			steps = append(steps, step)
+			prev, last = step.pos, step.pos
+			continue
+		}
+		if m.axes&^forceXYZ != 0 {
+			log.Fatalf("ApplyHeightMap: step %q with extra axes can not be leveled", step.s)
+		}
+		if m.sym {
+			log.Fatalf("ApplyHeightMap: symbolic step %q can not be leveled", step.s)
+		}
+
+		points := []Tuple{step.pos}
+		if m.arc {
+			points = arcPoints(plane, m.opCode, prev, step.pos, m.center, m.turns)
+		}
+		words := m.words
+		from := prev
+		for _, to := range points {
+			n := int(math.Ceil(math.Hypot(to.X()-from.X(), to.Y()-from.Y()) / maxLength))
+			if n < 1 {
+				n = 1
+			}
+			for i := 1; i <= n; i++ {
+				p := from.Add(to.Sub(from).MultScalar(float64(i) / float64(n)))
+				p[2] += h.At(p.X(), p.Y())
+				s := fmt.Sprintf("G1 X%.8f Y%.8f Z%.8f%v", p.X(), p.Y(), p.Z(), words)
+				// In inverse time mode, every segment needs its own F word.
+				if length := p.Sub(last).Magnitude(); m.rate > 0 && length >= epsilon {
+					s += fmt.Sprintf(" F%.8f", m.rate/length)
+				}
+				steps = append(steps, &Step{s: s, pos: p, motion: &motion{opCode: "G1", axes: forceXYZ, words: words, rate: m.rate, extra: m.extra}})
+				words = ""
+				last = p
+			}
+			from = to
+		}
+		prev = step.pos
+	}
+	g.steps = steps
+	return g
+}
+
+// gridLines returns the distinct values of vs in increasing order,
+// merging values within heightMapTolerance.
+func gridLines(vs []float64) []float64 {
+	sorted := append([]float64{}, vs...)
+	sort.Float64s(sorted)
+	var result []float64
+	for _, v := range sorted {
+		if len(result) == 0 || v-result[len(result)-1] >= heightMapTolerance {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// nearest returns the index of the grid line nearest to v.
+func nearest(lines []float64, v float64) int {
+	best := 0
+	for i, line := range lines {
+		if math.Abs(line-v) < math.Abs(lines[best]-v) {
+			best = i
+		}
+	}
+	return best
+}
+
+// gridCell returns the index of the grid cell containing v and
+// the fraction of v within the cell, clamped to the grid.
+func gridCell(lines []float64, v float64) (int, float64) {
+	n := len(lines)
+	switch {
+	case v <= lines[0]:
+		return 0, 0
+	case v >= lines[n-1]:
+		return n - 2, 1
+	}
+	i := sort.SearchFloat64s(lines, v) - 1
+	if i < 0 {
+		i = 0
+	}
+	return i, (v - lines[i]) / (lines[i+1] - lines[i])
+}
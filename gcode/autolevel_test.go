@@ -0,0 +1,155 @@
+package gcode
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// planeHeightMap returns a synthetic 3x3 height map of the plane
+// z = 0.01x + 0.02y over 0 <= x,y <= 20.
+func planeHeightMap(t *testing.T) *HeightMap {
+	t.Helper()
+	var points []Tuple
+	for y := 0.0; y <= 20; y += 10 {
+		for x := 0.0; x <= 20; x += 10 {
+			points = append(points, XYZ(x, y, 0.01*x+0.02*y))
+		}
+	}
+	h, err := NewHeightMap(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestReadHeightMap(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "CSV", data: "x,y,z\n0,0,0\n1,0,0.1\n0,1,0.2\n1,1,0.3\n"},
+		{name: "LinuxCNC", data: "0.000000 0.000000 0.000000 0 0 0 0 0 0\n1.000000 0.000000 0.100000 0 0 0 0 0 0\n1.000000 1.000000 0.300000 0 0 0 0 0 0\n0.000000 1.000000 0.200000 0 0 0 0 0 0\n"},
+		{name: "Fanuc", data: "X0.0000 Y0.0000 Z0.0000\nX1.0000 Y0.0000 Z0.1000\nX1.0000 Y1.0000 Z0.3000\nX0.0000 Y1.0000 Z0.2000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ReadHeightMap(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := h.At(0.5, 0.5), 0.15; math.Abs(got-want) > epsilon {
+				t.Errorf("At(0.5,0.5) = %v, want %v", got, want)
+			}
+			if got, want := h.At(2, -1), 0.1; math.Abs(got-want) > epsilon {
+				t.Errorf("At(2,-1) = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := ReadHeightMap(strings.NewReader("0,0,0\n1,0,0\n0,1,0\n")); err == nil {
+		t.Error("ReadHeightMap with missing grid point: want error")
+	}
+}
+
+func TestApplyHeightMap_Lines(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 1))
+	g.MoveZWithF(100, Z(-1))
+	g.MoveXY(XY(20, 0))
+	g.GotoZ(Z(1))
+	g.ApplyHeightMap(planeHeightMap(t), 10)
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z1.00000000
+G1 X0.00000000 Y0.00000000 Z-1.00000000 F100
+G1 X10.00000000 Y0.00000000 Z-0.90000000
+G1 X20.00000000 Y0.00000000 Z-0.80000000
+G0 Z1.00000000
+`
+	if got != want {
+		t.Errorf("ApplyHeightMap =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestApplyHeightMap_InverseTime(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 0))
+	g.Feedmode(FeedInverseTime)
+	g.Feedrate(100)
+	g.MoveXY(XY(20, 0))
+	g.ApplyHeightMap(planeHeightMap(t), 10)
+
+	// Each segment has the F word of its own length.
+	f := 100 / math.Hypot(10, 0.1)
+	want := fmt.Sprintf(`G0 X0.00000000 Y0.00000000 Z0.00000000
+G93
+G1 X10.00000000 Y0.00000000 Z0.10000000 F%.8f
+G1 X20.00000000 Y0.00000000 Z0.20000000 F%.8f
+`, f, f)
+	if got := g.String(); got != want {
+		t.Errorf("ApplyHeightMap =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestApplyHeightMap_Arc(t *testing.T) {
+	h := planeHeightMap(t)
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(15, 10, 0))
+	g.MoveZ(Z(-1))
+	g.CircleCW(XYZ(10, 10, -1), nil)
+	g.ApplyHeightMap(h, 1)
+
+	for _, step := range g.steps[2:] {
+		p := step.pos
+		if r := math.Hypot(p.X()-10, p.Y()-10); math.Abs(r-5) > 0.01 {
+			t.Errorf("step %q is %v from the arc center, want 5", step.s, r)
+		}
+		if want := -1 + h.At(p.X(), p.Y()); math.Abs(p.Z()-want) > epsilon {
+			t.Errorf("step %q Z = %v, want %v", step.s, p.Z(), want)
+		}
+	}
+	if got, want := len(g.steps), 2+360; got != want {
+		t.Errorf("got %v steps, want %v", got, want)
+	}
+}
+
+func TestProbeGrid(t *testing.T) {
+	g := New(NoHeader, UseFanuc)
+	g.ProbeGrid(XY(0, 0), XY(10, 20), 2, 2, &ProbeGridOptions{Feedrate: Float(50), MinZ: Float(-1)})
+
+	got := g.String()
+	want := `POPEN
+G0 Z2.00000000
+G0 X0.00000000 Y0.00000000
+G91
+G31 Z-3.00000000 F50.00000000
+G90
+DPRNT[X#5061[44]*Y#5062[44]*Z#5063[44]]
+G0 Z2.00000000
+G0 X10.00000000 Y0.00000000
+G91
+G31 Z-3.00000000 F50.00000000
+G90
+DPRNT[X#5061[44]*Y#5062[44]*Z#5063[44]]
+G0 Z2.00000000
+G0 X10.00000000 Y20.00000000
+G91
+G31 Z-3.00000000 F50.00000000
+G90
+DPRNT[X#5061[44]*Y#5062[44]*Z#5063[44]]
+G0 Z2.00000000
+G0 X0.00000000 Y20.00000000
+G91
+G31 Z-3.00000000 F50.00000000
+G90
+DPRNT[X#5061[44]*Y#5062[44]*Z#5063[44]]
+G0 Z2.00000000
+PCLOS
+`
+	if got != want {
+		t.Errorf("ProbeGrid =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package gcode
+
+import (
+	"log"
+	"strings"
+)
+
+// axisNames are the names of all axes in the order they are emitted.
+// The bit for each axis in a force mask is 1 << its index.
+const axisNames = "XYZABCUVW"
+
+// AxesT represents a position on any combination of the axes X, Y, Z,
+// the rotary axes A, B, and C (in degrees), and the parallel axes
+// U, V, and W, such as AxesT{"X": 10, "A": 90}.
+type AxesT map[string]float64
+
+// Goto performs a rapid move on the axes in p.
+func (g *GCode) Goto(p AxesT) *GCode {
+	g.moveAxes("G0", p)
+	return g
+}
+
+// Move performs a move on the axes in p.
+func (g *GCode) Move(p AxesT) *GCode {
+	g.moveAxes("G1", p)
+	return g
+}
+
+// MoveWithF performs a move on the axes in p with the provided feedrate.
+func (g *GCode) MoveWithF(feedrate float64, p AxesT) *GCode {
+	g.withF(feedrate, func() { g.moveAxes("G1", p) })
+	return g
+}
+
+// AxesPosition returns the current position of all axes.
+// Like Position, X, Y, and Z are reported in the coordinate system
+// of the current transform (see PushTransform).
+func (g *GCode) AxesPosition() AxesT {
+	pos := g.Position()
+	result := AxesT{}
+	for i, v := range allAxes(pos, g.extra) {
+		result[axisNames[i:i+1]] = v
+	}
+	return result
+}
+
+// moveAxes moves the axes in p, leaving the others unchanged.
+func (g *GCode) moveAxes(opCode string, p AxesT) {
+	pos := g.Position()
+	extra := g.extra
+	var force int
+	for name, v := range p {
+		i := strings.Index(axisNames, name)
+		if len(name) != 1 || i < 0 {
+			log.Fatalf("unknown axis %q", name)
+		}
+		force |= 1 << i
+		if i < 3 {
+			pos[i] = v
+		} else {
+			extra[i-3] = v
+		}
+	}
+	g.moveOrGoAxes(opCode, pos, extra, force)
+}
+
+// allAxes returns the values of all axes in the order of axisNames.
+func allAxes(p Tuple, extra [6]float64) [9]float64 {
+	var result [9]float64
+	copy(result[:], p[:3])
+	copy(result[3:], extra[:])
+	return result
+}
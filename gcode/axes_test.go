@@ -0,0 +1,55 @@
+package gcode
+
+import "testing"
+
+func TestAxes(t *testing.T) {
+	g := New(NoHeader)
+	g.Goto(AxesT{"X": 0, "Y": 0, "Z": 5, "A": 0})
+	g.Move(AxesT{"A": 90, "X": 10})
+	g.Move(AxesT{"A": 90, "Y": 5})
+	g.MoveXY(XY(0, 0))
+	g.MoveWithF(100, AxesT{"B": 45, "W": -1})
+	g.PushTransform(Translation(1, 1, 0))
+	g.Move(AxesT{"X": 0, "A": 180})
+	g.PopTransform()
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z5.00000000 A0.00000000
+G1 X10.00000000 A90.00000000
+G1 Y5.00000000
+G1 X0.00000000 Y0.00000000
+G1 B45.00000000 W-1.00000000 F100
+G1 X1.00000000 A180.00000000
+`
+	if got != want {
+		t.Errorf("Axes =\n%v\nwant:\n%v", got, want)
+	}
+
+	wantPos := AxesT{"X": 1, "Y": 0, "Z": 5, "A": 180, "B": 45, "C": 0, "U": 0, "V": 0, "W": -1}
+	gotPos := g.AxesPosition()
+	for name, v := range wantPos {
+		if gotPos[name] != v {
+			t.Errorf("AxesPosition[%q] = %v, want %v", name, gotPos[name], v)
+		}
+	}
+}
+
+func TestAxes_Repeat(t *testing.T) {
+	sub := New(NoHeader)
+	sub.Goto(AxesT{"X": 0, "A": 0})
+	sub.Move(AxesT{"X": 1, "A": 90})
+
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 0))
+	g.Repeat(sub, GridPlacements(2, 1, 10, 0), nil)
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z0.00000000
+G1 X1.00000000 A90.00000000
+G0 X10.00000000 A0.00000000
+G1 X11.00000000 A90.00000000
+`
+	if got != want {
+		t.Errorf("Repeat =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -11,6 +11,13 @@ type TurnsOption struct {
 	Turns int
 }
 
+func (t *TurnsOption) turns() int {
+	if t == nil {
+		return 0
+	}
+	return t.Turns
+}
+
 type arcFnEnumT int
 
 const (
@@ -20,7 +27,12 @@ const (
 	fnArcCCWRel
 )
 
-func (g *GCode) allArcs(endP Tuple, origRad float64, relative bool, ft arcFnEnumT, opCode string, opts *TurnsOption) *Step {
+func (g *GCode) allArcs(endP Tuple, origRad float64, relative bool, ft arcFnEnumT, opCode string, opts *TurnsOption) {
+	if g.isSym(endP.X(), endP.Y(), endP.Z(), origRad) {
+		g.symArc(endP, origRad, relative, opCode, opts)
+		return
+	}
+
 	radius := origRad
 	if ft == fnArcCCW || ft == fnArcCCWRel {
 		radius *= -1.0
@@ -125,10 +137,18 @@ func (g *GCode) allArcs(endP Tuple, origRad float64, relative bool, ft arcFnEnum
 	}
 
 	pos := g.Position()
+	if g.xform != nil {
+		g.emitArc(opCode, pos, pos.Add(vecab), pos.Add(center), opts)
+		return
+	}
+	m := &motion{opCode: opCode, axes: forceXY, arc: true, center: pos.Add(center), turns: opts.turns(), extra: g.extra}
+	g.laserSwitch(opCode)
+
 	xyz := pos.Add(vecab)
 	s := fmt.Sprintf("%v X%.8f Y%.8f", opCode, xyz.X(), xyz.Y())
 	if math.Abs(xyz.Z()-pos.Z()) >= epsilon {
 		s += fmt.Sprintf(" Z%.8f", xyz.Z())
+		m.axes |= forceZ
 	}
 
 	if relative {
@@ -150,7 +170,8 @@ func (g *GCode) allArcs(endP Tuple, origRad float64, relative bool, ft arcFnEnum
 		s += fmt.Sprintf(" P%v", opts.Turns)
 	}
 
-	return &Step{s: s, pos: pos}
+	s += g.inverseTimeWord(m, g.lastPos(), pos)
+	g.steps = append(g.steps, &Step{s: s, pos: pos, motion: m})
 }
 
 // ArcCCW performs a counter clockwise arc from the current position
@@ -159,8 +180,7 @@ func (g *GCode) allArcs(endP Tuple, origRad float64, relative bool, ft arcFnEnum
 // the largest angular movement with negative radius.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) ArcCCW(endPoint Tuple, radius float64, opts *TurnsOption) *GCode {
-	step := g.allArcs(endPoint, radius, false, fnArcCCW, "G3", opts)
-	g.steps = append(g.steps, step)
+	g.allArcs(endPoint, radius, false, fnArcCCW, "G3", opts)
 	return g
 }
 
@@ -170,8 +190,7 @@ func (g *GCode) ArcCCW(endPoint Tuple, radius float64, opts *TurnsOption) *GCode
 // the largest angular movement with negative radius.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) ArcCCWRel(endPoint Tuple, radius float64, opts *TurnsOption) *GCode {
-	step := g.allArcs(endPoint, radius, true, fnArcCCWRel, "G3", opts)
-	g.steps = append(g.steps, step)
+	g.allArcs(endPoint, radius, true, fnArcCCWRel, "G3", opts)
 	return g
 }
 
@@ -181,8 +200,7 @@ func (g *GCode) ArcCCWRel(endPoint Tuple, radius float64, opts *TurnsOption) *GC
 // the largest angular movement with negative radius.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) ArcCW(endPoint Tuple, radius float64, opts *TurnsOption) *GCode {
-	step := g.allArcs(endPoint, radius, false, fnArcCW, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allArcs(endPoint, radius, false, fnArcCW, "G2", opts)
 	return g
 }
 
@@ -192,8 +210,7 @@ func (g *GCode) ArcCW(endPoint Tuple, radius float64, opts *TurnsOption) *GCode
 // the largest angular movement with negative radius.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) ArcCWRel(endPoint Tuple, radius float64, opts *TurnsOption) *GCode {
-	step := g.allArcs(endPoint, radius, true, fnArcCWRel, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allArcs(endPoint, radius, true, fnArcCWRel, "G2", opts)
 	return g
 }
 
@@ -202,8 +219,7 @@ func (g *GCode) ArcCWRel(endPoint Tuple, radius float64, opts *TurnsOption) *GCo
 // The non-active plane coordinate may be used to create a helical movement.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) CircleCW(centerPoint Tuple, opts *TurnsOption) *GCode {
-	step := g.allCircles(centerPoint, false, fnCircleCW, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allCircles(centerPoint, false, fnCircleCW, "G2", opts)
 	return g
 }
 
@@ -213,29 +229,26 @@ func (g *GCode) CircleCW(centerPoint Tuple, opts *TurnsOption) *GCode {
 // The non-active plane coordinate may be used to create a helical movement.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) CircleCWRel(centerPoint Tuple, opts *TurnsOption) *GCode {
-	step := g.allCircles(centerPoint, true, fnCircleCWRel, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allCircles(centerPoint, true, fnCircleCWRel, "G2", opts)
 	return g
 }
 
-// CircleCCWRel performs a clockwise circle with radius length(centerPoint)
+// CircleCCW performs a counter-clockwise circle with radius length(centerPoint)
 // and where centerPoint is the center point of the circle.
 // The non-active plane coordinate may be used to create a helical movement.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) CircleCCW(centerPoint Tuple, opts *TurnsOption) *GCode {
-	step := g.allCircles(centerPoint, false, fnCircleCCW, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allCircles(centerPoint, false, fnCircleCCW, "G3", opts)
 	return g
 }
 
-// CircleCCWRel performs a clockwise circle with radius length(centerPoint)
+// CircleCCWRel performs a counter-clockwise circle with radius length(centerPoint)
 // and where centerPoint is the center point of the circle.
 // The specified centerPoint is a relative position.
 // The non-active plane coordinate may be used to create a helical movement.
 // Optional turns sets the number of turns to perform.
 func (g *GCode) CircleCCWRel(centerPoint Tuple, opts *TurnsOption) *GCode {
-	step := g.allCircles(centerPoint, true, fnCircleCCWRel, "G2", opts)
-	g.steps = append(g.steps, step)
+	g.allCircles(centerPoint, true, fnCircleCCWRel, "G3", opts)
 	return g
 }
 
@@ -248,7 +261,12 @@ const (
 	fnCircleCCWRel
 )
 
-func (g *GCode) allCircles(arg0 Tuple, relative bool, ft circleFnEnumT, opCode string, opts *TurnsOption) *Step {
+func (g *GCode) allCircles(arg0 Tuple, relative bool, ft circleFnEnumT, opCode string, opts *TurnsOption) {
+	if g.isSym(arg0.X(), arg0.Y(), arg0.Z()) {
+		g.symCircle(arg0, relative, opCode, opts)
+		return
+	}
+
 	endP := g.Position()
 	var coor1, coor2 float64
 
@@ -286,9 +304,29 @@ func (g *GCode) allCircles(arg0 Tuple, relative bool, ft circleFnEnumT, opCode s
 		log.Fatal("radius is zero")
 	}
 
+	center := g.Position()
+	switch g.activePlane {
+	default: // XY
+		center[0] += coor1
+		center[1] += coor2
+	case PlaneXZ:
+		center[0] += coor1
+		center[2] += coor2
+	case PlaneYZ:
+		center[1] += coor1
+		center[2] += coor2
+	}
+	if g.xform != nil {
+		g.emitArc(opCode, g.Position(), endP, center, opts)
+		return
+	}
+	m := &motion{opCode: opCode, axes: forceXY, arc: true, center: center, turns: opts.turns(), extra: g.extra}
+	g.laserSwitch(opCode)
+
 	s := fmt.Sprintf("%v X%.8f Y%.8f", opCode, endP.X(), endP.Y())
 	if math.Abs(endP.Z()-g.Position().Z()) >= epsilon {
 		s += fmt.Sprintf(" Z%.8f", endP.Z())
+		m.axes |= forceZ
 	}
 	pos := endP
 
@@ -305,5 +343,6 @@ func (g *GCode) allCircles(arg0 Tuple, relative bool, ft circleFnEnumT, opCode s
 		s += fmt.Sprintf(" P%v", opts.Turns)
 	}
 
-	return &Step{s: s, pos: pos}
+	s += g.inverseTimeWord(m, g.lastPos(), pos)
+	g.steps = append(g.steps, &Step{s: s, pos: pos, motion: m})
 }
@@ -13,7 +13,7 @@ func (g *GCode) Comment(args ...interface{}) *GCode {
 	}
 	s := fmt.Sprintf(g.commentFmt, strings.Join(parts, ""))
 
-	step := &Step{s: s, pos: g.Position()}
+	step := &Step{s: s, pos: g.lastPos()}
 	g.steps = append(g.steps, step)
 	return g
 }
@@ -0,0 +1,101 @@
+package gcode
+
+import "fmt"
+
+// Expr is a numeric expression that may refer to # parameters.
+// It keeps both its G-Code representation and its value, which is
+// used to simulate the program (for example, to track Position).
+type Expr struct {
+	s   string
+	v   float64
+	sym bool // true if the expression refers to parameters.
+
+	decls *declTable // declarations of the parameters, if sym.
+}
+
+// Num returns a numeric constant expression.
+func Num(v float64) Expr {
+	return Expr{s: fmt.Sprintf("%.8f", v), v: v}
+}
+
+// String returns the G-Code representation of the expression.
+func (e Expr) String() string { return e.s }
+
+// Value returns the (simulated) value of the expression.
+func (e Expr) Value() float64 { return e.v }
+
+func (e Expr) binary(op string, other Expr, v float64) Expr {
+	decls := e.decls
+	if decls == nil {
+		decls = other.decls
+	}
+	return Expr{s: fmt.Sprintf("[%v %v %v]", e.s, op, other.s), v: v, sym: e.sym || other.sym, decls: decls}
+}
+
+// Add returns the expression e + other.
+func (e Expr) Add(other Expr) Expr { return e.binary("+", other, e.v+other.v) }
+
+// Sub returns the expression e - other.
+func (e Expr) Sub(other Expr) Expr { return e.binary("-", other, e.v-other.v) }
+
+// Mul returns the expression e * other.
+func (e Expr) Mul(other Expr) Expr { return e.binary("*", other, e.v*other.v) }
+
+// Div returns the expression e / other.
+func (e Expr) Div(other Expr) Expr { return e.binary("/", other, e.v/other.v) }
+
+// Cond is a comparison of two expressions used by the
+// If and While control flow methods.
+type Cond struct {
+	a  Expr
+	op string
+	b  Expr
+}
+
+// LT returns the condition e < other.
+func (e Expr) LT(other Expr) Cond { return Cond{a: e, op: "LT", b: other} }
+
+// LE returns the condition e <= other.
+func (e Expr) LE(other Expr) Cond { return Cond{a: e, op: "LE", b: other} }
+
+// GT returns the condition e > other.
+func (e Expr) GT(other Expr) Cond { return Cond{a: e, op: "GT", b: other} }
+
+// GE returns the condition e >= other.
+func (e Expr) GE(other Expr) Cond { return Cond{a: e, op: "GE", b: other} }
+
+// EQ returns the condition e == other.
+func (e Expr) EQ(other Expr) Cond { return Cond{a: e, op: "EQ", b: other} }
+
+// NE returns the condition e != other.
+func (e Expr) NE(other Expr) Cond { return Cond{a: e, op: "NE", b: other} }
+
+// String returns the G-Code representation of the condition.
+func (c Cond) String() string {
+	return fmt.Sprintf("[%v %v %v]", c.a.s, c.op, c.b.s)
+}
+
+// Value returns the (simulated) value of the condition.
+func (c Cond) Value() bool {
+	a, b := c.a.v, c.b.v
+	switch c.op {
+	case "LT":
+		return a < b
+	case "LE":
+		return a <= b
+	case "GT":
+		return a > b
+	case "GE":
+		return a >= b
+	case "EQ":
+		return a == b
+	default: // NE
+		return a != b
+	}
+}
+
+// Not returns the inverse of the condition.
+func (c Cond) Not() Cond {
+	inverse := map[string]string{"LT": "GE", "LE": "GT", "GT": "LE", "GE": "LT", "EQ": "NE", "NE": "EQ"}
+	return Cond{a: c.a, op: inverse[c.op], b: c.b}
+}
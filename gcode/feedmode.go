@@ -0,0 +1,91 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// FeedmodeT represents the feed rate mode.
+type FeedmodeT string
+
+const (
+	FeedUnitsPerMinute FeedmodeT = "G94"
+	FeedInverseTime    FeedmodeT = "G93"
+	FeedUnitsPerRev    FeedmodeT = "G95"
+)
+
+// Feedmode sets the feed rate mode, which determines how the rate
+// passed to Feedrate (and the WithF methods) is interpreted:
+//
+//   - FeedUnitsPerMinute (G94, the default): units per minute.
+//   - FeedUnitsPerRev (G95): units per revolution of the spindle.
+//   - FeedInverseTime (G93): the rate is the desired speed in units
+//     per minute, and the F word of every following feed move is
+//     computed from the length of the move as required by G93.
+//     The extra axes count towards the length in their own units
+//     (such as degrees for A, B, and C).
+//
+// When leaving inverse time mode for units per minute mode,
+// the last feedrate is restored.
+func (g *GCode) Feedmode(mode FeedmodeT) *GCode {
+	wasInverseTime := g.feedMode == FeedInverseTime
+	g.feedMode = mode
+	g.sendOpCode(string(mode))
+	if wasInverseTime && mode == FeedUnitsPerMinute && g.feedrate > 0 {
+		g.Feedrate(g.feedrate)
+	}
+	return g
+}
+
+// withF performs fn, which emits moves, using the provided feedrate.
+func (g *GCode) withF(feedrate float64, fn func()) {
+	if g.feedMode == FeedInverseTime {
+		g.setInverseTimeRate(feedrate)
+		fn()
+		return
+	}
+	n := len(g.steps)
+	fn()
+	if len(g.steps) > n {
+		g.appendWords(" F" + g.fmtSym("%v", feedrate))
+		g.feedrate = feedrate
+	}
+}
+
+func (g *GCode) setInverseTimeRate(rate float64) {
+	if g.isSym(rate) {
+		log.Fatal("symbolic feedrates are not supported in inverse time mode")
+	}
+	g.feedrate = rate
+}
+
+// inverseTimeWord returns the F word of a feed move (or arc) from start
+// to end in inverse time mode and is empty otherwise.
+// The word is not added to the words of m, which records the desired
+// speed instead so that the word can be recomputed for each segment
+// when the move is subdivided.
+func (g *GCode) inverseTimeWord(m *motion, start, end Tuple) string {
+	if g.feedMode != FeedInverseTime || m.opCode == "G0" {
+		return ""
+	}
+	if g.feedrate <= 0 {
+		log.Fatal("inverse time mode requires a Feedrate")
+	}
+	m.rate = g.feedrate
+
+	var length float64
+	if m.arc {
+		length = arcLength(g.activePlane, m.opCode, start, end, m.center, m.turns)
+	} else {
+		a, b := allAxes(start, g.extra), allAxes(end, m.extra)
+		for i := range a {
+			length += (b[i] - a[i]) * (b[i] - a[i])
+		}
+		length = math.Sqrt(length)
+	}
+	if length < epsilon {
+		return ""
+	}
+	return fmt.Sprintf(" F%.8f", g.feedrate/length)
+}
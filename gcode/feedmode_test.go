@@ -0,0 +1,37 @@
+package gcode
+
+import "testing"
+
+func TestFeedmode(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 1))
+	g.Feedrate(100)
+	g.Feedmode(FeedInverseTime)
+	g.MoveZ(Z(-1))
+	g.Move(AxesT{"X": 10, "A": 90})
+	g.Feedrate(200)
+	g.ArcCW(XYZ(20, 0, -1), 5, nil)
+	g.MoveZWithF(50, Z(1))
+	g.Feedmode(FeedUnitsPerMinute)
+	g.Feedmode(FeedUnitsPerRev)
+	g.Feedrate(0.1)
+	g.MoveXY(XY(0, 0))
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z1.00000000
+F100.00000000
+G93
+G1 Z-1.00000000 F50.00000000
+G1 X10.00000000 A90.00000000 F1.10431526
+G2 X20.00000000 Y0.00000000 I5.00000000 J0.00000000 F12.73239545
+G1 Z1.00000000 F25.00000000
+G94
+F50.00000000
+G95
+F0.10000000
+G1 X0.00000000
+`
+	if got != want {
+		t.Errorf("Feedmode =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -14,11 +14,56 @@ type GCode struct {
 	epilogue   string
 	commentFmt string
 
+	hasMoved bool
+	unknown  int // axes whose position at the machine is not known (see forgetPosition).
+	steps    []*Step
+
+	xform    *M4   // current transform, nil for identity.
+	xformInv M4    // inverse of the current transform.
+	xforms   []*M4 // saved transforms (see PushTransform).
+
+	dialect    dialectT
+	subs       []*Sub
+	params     map[string]float64 // simulated values of # parameters.
+	labels     *int               // next control flow label, shared with sub-programs.
+	decls      *declTable         // declared variables, shared with sub-programs.
+	flatten    int                // > 0 while control flow is evaluated instead of emitted.
+	defining   bool               // true while recording a sub-program definition.
+	whileDepth int
+
+	modalState // copied as a unit to sub-programs and simulators.
+}
+
+// modalState represents the modal state of a design, which sub-program
+// definitions and control flow simulations start from, and which is
+// restored after a simulated block.
+type modalState struct {
 	activePlane PlaneT
-	hasMoved    bool
-	steps       []*Step
+
+	wcs        int       // active work coordinate system (1 for G54).
+	wcsOffsets [10]Tuple // modeled machine origin of each work coordinate system.
+	g92Offset  Tuple     // modeled G92 offset.
+
+	extra [6]float64 // current position of the extra axes A, B, C, U, V, and W.
+
+	feedMode FeedmodeT // empty until set by Feedmode.
+	feedrate float64   // last feedrate (or desired speed in inverse time mode).
+
+	diameterMode bool // true when X is programmed as a diameter (G7).
+
+	laser laserState // see LaserMode.
 }
 
+// dialectT represents the G-Code dialect used for
+// sub-programs, parameters, and control flow.
+type dialectT int
+
+const (
+	dialectNone dialectT = iota // no sub-programs; control flow is flattened.
+	dialectLinuxCNC
+	dialectFanuc
+)
+
 // Option represents various options for generating GCode.
 type Option string
 
@@ -27,11 +72,22 @@ const (
 	NoHeader              Option = "NoHeader"
 	UseIVI                Option = "UseIVI"
 	UseGeneric            Option = "UseGeneric"
+	// UseMarlin emits the start and end sequences of a Marlin 3D printer
+	// (see NewPrinter).
+	UseMarlin Option = "UseMarlin"
+	// UseKlipper emits the start and end sequences of a Klipper 3D printer
+	// using its START_PRINT and END_PRINT macros (see NewPrinter).
+	UseKlipper Option = "UseKlipper"
+	// UseLinuxCNC emits sub-programs and control flow using LinuxCNC O-words.
+	UseLinuxCNC Option = "UseLinuxCNC"
+	// UseFanuc emits sub-programs and control flow using Fanuc (and Mach3)
+	// M98/M99, G65, and macro B syntax.
+	UseFanuc Option = "UseFanuc"
 )
 
 // New returns a new gcode design.
 func New(opts ...Option) *GCode {
-	g := &GCode{activePlane: PlaneXY, commentFmt: "(%v)"}
+	g := &GCode{commentFmt: "(%v)", params: map[string]float64{}, labels: new(int), decls: newDeclTable(), modalState: modalState{activePlane: PlaneXY, wcs: 1}}
 
 	for _, opt := range opts {
 		switch opt {
@@ -44,9 +100,21 @@ func New(opts ...Option) *GCode {
 			g.hasMoved = true
 			g.epilogue = iviEpilogue
 			g.commentFmt = ";%v"
+		case UseMarlin:
+			g.prologue = marlinPrologue
+			g.epilogue = marlinEpilogue
+			g.commentFmt = ";%v"
+		case UseKlipper:
+			g.prologue = klipperPrologue
+			g.epilogue = klipperEpilogue
+			g.commentFmt = ";%v"
 		case UseGeneric:
 			g.prologue = genericPrologue
 			g.epilogue = genericEpilogue
+		case UseLinuxCNC:
+			g.dialect = dialectLinuxCNC
+		case UseFanuc:
+			g.dialect = dialectFanuc
 		}
 	}
 
@@ -64,12 +132,22 @@ func (g *GCode) String() string {
 	if g.prologue != "" {
 		lines = append(lines, g.prologue)
 	}
+	lines = append(lines, g.declarations()...)
+	if g.dialect == dialectLinuxCNC {
+		lines = append(lines, g.subDefinitions()...)
+	}
 	for _, step := range g.steps {
 		lines = append(lines, step.s)
 	}
 	if g.epilogue != "" {
 		lines = append(lines, g.epilogue)
 	}
+	if g.dialect == dialectFanuc && len(g.subs) > 0 {
+		if !strings.Contains(g.epilogue, "M30") {
+			lines = append(lines, "M30")
+		}
+		lines = append(lines, g.subDefinitions()...)
+	}
 	return strings.Join(lines, "\n") + "\n"
 }
 
@@ -77,10 +155,41 @@ func (g *GCode) String() string {
 type Step struct {
 	s   string
 	pos Tuple // position after performing the step.
+
+	motion *motion // non-nil for G0, G1, G2, and G3 steps.
+	plane  PlaneT  // non-empty if the step changes the active plane.
+}
+
+// motion describes a move or arc step so that it can be
+// replayed or post-processed after it has been generated.
+type motion struct {
+	opCode string
+	axes   int // axes mentioned by the step (forceX, forceY, forceZ).
+	arc    bool
+	center Tuple      // absolute center of an arc.
+	turns  int        // number of turns (P) of an arc.
+	words  string     // additional words (such as F) appended to the step.
+	rate   float64    // desired speed of a feed move in inverse time mode, 0 otherwise.
+	extra  [6]float64 // position of the extra axes after the step.
+	sym    bool       // true if the step refers to parameters.
 }
 
 // Position returns the current tool position (defaulting to home 0,0,0).
+// When a transform is active (see PushTransform), the position is
+// reported in the coordinate system of the current transform.
 func (g *GCode) Position() Tuple {
+	pos := g.lastPos()
+	if g == nil || g.xform == nil {
+		return pos
+	}
+	pos = g.xformInv.MultTuple(pos)
+	pos[3] = 1
+	return pos
+}
+
+// lastPos returns the tool position as emitted in the G-Code,
+// without regard to the current transform.
+func (g *GCode) lastPos() Tuple {
 	if g == nil || len(g.steps) == 0 {
 		return XYZ(0, 0, 0)
 	}
@@ -118,3 +227,33 @@ G0 Z5.00 F3000
 var iviEpilogue = `;-- epilogue begin --
 M5 ;Stop spindle
 ;-- epilogue end --`
+
+var marlinPrologue = `;-- prologue begin --
+G21 ;Use mm
+G90 ;Use absolute distance mode
+M82 ;Use absolute extrusion mode
+G28 ;Home all axes
+G92 E0 ;Reset extruder
+;-- prologue end --`
+
+var marlinEpilogue = `;-- epilogue begin --
+M104 S0 ;Turn off hotend
+M140 S0 ;Turn off bed
+M107 ;Turn off fan
+G91 ;Use relative distance mode
+G0 Z10 ;Raise nozzle
+G90 ;Use absolute distance mode
+M84 ;Disable steppers
+;-- epilogue end --`
+
+var klipperPrologue = `;-- prologue begin --
+G21 ;Use mm
+G90 ;Use absolute distance mode
+M82 ;Use absolute extrusion mode
+START_PRINT
+G92 E0 ;Reset extruder
+;-- prologue end --`
+
+var klipperEpilogue = `;-- epilogue begin --
+END_PRINT
+;-- epilogue end --`
@@ -7,7 +7,7 @@ func (g *GCode) home(opCode string, p Tuple) {
 
 // HomeX homes the X axis.
 func (g *GCode) HomeX() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(0, pos.Y(), pos.Z())
 	g.home("G28 X", newPos)
 	return g
@@ -15,7 +15,7 @@ func (g *GCode) HomeX() *GCode {
 
 // HomeY homes the Y axis.
 func (g *GCode) HomeY() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(pos.X(), 0, pos.Z())
 	g.home("G28 Y", newPos)
 	return g
@@ -23,7 +23,7 @@ func (g *GCode) HomeY() *GCode {
 
 // HomeZ homes the Z axis.
 func (g *GCode) HomeZ() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(pos.X(), pos.Y(), 0)
 	g.home("G28 Z", newPos)
 	return g
@@ -31,7 +31,7 @@ func (g *GCode) HomeZ() *GCode {
 
 // HomeXY homes the X and Y axes.
 func (g *GCode) HomeXY() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(0, 0, pos.Z())
 	g.home("G28 X Y", newPos)
 	return g
@@ -39,7 +39,7 @@ func (g *GCode) HomeXY() *GCode {
 
 // HomeYZ homes the Y and Z axes.
 func (g *GCode) HomeYZ() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(pos.X(), 0, 0)
 	g.home("G28 Y Z", newPos)
 	return g
@@ -47,7 +47,7 @@ func (g *GCode) HomeYZ() *GCode {
 
 // HomeXZ homes the X and Z axes.
 func (g *GCode) HomeXZ() *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	newPos := XYZ(0, pos.Y(), 0)
 	g.home("G28 X Z", newPos)
 	return g
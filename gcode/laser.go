@@ -0,0 +1,117 @@
+package gcode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// defaultLaserMaxPower is the default S value of full laser power.
+const defaultLaserMaxPower = 1000
+
+// LaserOptions represents options for the LaserMode method.
+type LaserOptions struct {
+	// MaxPower is the S value of full power. Default is 1000.
+	MaxPower *float64
+	// Dynamic uses dynamic power (M4), which scales the power with the
+	// actual speed of the machine, instead of constant power (M3).
+	Dynamic bool
+}
+
+// laserState represents the state of laser mode.
+type laserState struct {
+	enabled  bool
+	maxPower float64
+	dynamic  bool
+	power    float64 // power (0-1) of cutting moves.
+	on       bool
+}
+
+// LaserMode makes the design drive a laser instead of a spindle.
+// The laser is switched on (M3 or M4) at the current power before each
+// cutting move (G1, G2, or G3) and switched off (M5) before each rapid,
+// so the design does not need to move Z between cuts.
+func (g *GCode) LaserMode(opts *LaserOptions) *GCode {
+	if opts == nil {
+		opts = &LaserOptions{}
+	}
+	g.laser = laserState{
+		enabled:  true,
+		maxPower: getFloat(opts.MaxPower, defaultLaserMaxPower),
+		dynamic:  opts.Dynamic,
+		power:    1,
+	}
+	return g
+}
+
+// IsLaserMode reports whether the design drives a laser (see LaserMode).
+func (g *GCode) IsLaserMode() bool { return g.laser.enabled }
+
+// LaserPower sets the power (0-1) of the following cutting moves.
+func (g *GCode) LaserPower(power float64) *GCode {
+	power = math.Max(0, math.Min(1, power))
+	if g.laser.on && power != g.laser.power {
+		g.sendOpCode("S" + g.laserS(power))
+	}
+	g.laser.power = power
+	return g
+}
+
+// LaserOff switches the laser off (M5).
+func (g *GCode) LaserOff() *GCode {
+	g.laser.on = false
+	return g.sendOpCode("M5")
+}
+
+// MoveXYWithPower performs one or more move(s) on the XY axes
+// at the current feed-rate with the laser at the given power (0-1).
+func (g *GCode) MoveXYWithPower(power float64, ps ...Tuple) *GCode {
+	if len(ps) == 0 {
+		return g
+	}
+	power = math.Max(0, math.Min(1, power))
+	if !g.laser.on || power == g.laser.power {
+		g.laser.power = power
+		return g.MoveXY(ps...)
+	}
+	g.laser.power = power
+	n := len(g.steps)
+	g.MoveXY(ps[0])
+	if len(g.steps) > n {
+		g.appendWords(" S" + g.laserS(power))
+	}
+	return g.MoveXY(ps[1:]...)
+}
+
+// AirAssist switches the air assist (or coolant) on (M8) or off (M9).
+func (g *GCode) AirAssist(on bool) *GCode {
+	if on {
+		return g.sendOpCode("M8")
+	}
+	return g.sendOpCode("M9")
+}
+
+// laserSwitch switches the laser on before a cutting move
+// and off before a rapid move in laser mode.
+func (g *GCode) laserSwitch(opCode string) {
+	if !g.laser.enabled {
+		return
+	}
+	switch {
+	case opCode == "G0" && g.laser.on:
+		g.LaserOff()
+	case opCode != "G0" && !g.laser.on:
+		g.laser.on = true
+		code := "M3"
+		if g.laser.dynamic {
+			code = "M4"
+		}
+		g.sendOpCode(fmt.Sprintf("%v S%v", code, g.laserS(g.laser.power)))
+	}
+}
+
+// laserS returns the S value of the given power (0-1).
+func (g *GCode) laserS(power float64) string {
+	s := math.Round(power*g.laser.maxPower*1000) / 1000
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
@@ -0,0 +1,37 @@
+package gcode
+
+import "testing"
+
+func TestLaserMode(t *testing.T) {
+	g := New(NoHeader)
+	g.LaserMode(&LaserOptions{Dynamic: true})
+	g.AirAssist(true)
+	g.LaserPower(0.5)
+	g.GotoXY(XY(0, 0))
+	g.MoveXY(XY(10, 0))
+	g.MoveXYWithPower(0.25, XY(10, 10), XY(0, 10))
+	g.LaserPower(0.75)
+	g.GotoXY(XY(20, 20))
+	g.ArcCW(XYZ(30, 20, 0), 5, nil)
+	g.LaserOff()
+	g.AirAssist(false)
+
+	got := g.String()
+	want := `M8
+G0 X0.00000000 Y0.00000000
+M4 S500
+G1 X10.00000000
+G1 Y10.00000000 S250
+G1 X0.00000000
+S750
+M5
+G0 X20.00000000 Y20.00000000
+M4 S750
+G2 X30.00000000 Y20.00000000 I5.00000000 J0.00000000
+M5
+M9
+`
+	if got != want {
+		t.Errorf("LaserMode =\n%v\nwant:\n%v", got, want)
+	}
+}
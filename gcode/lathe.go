@@ -0,0 +1,221 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// ThreadOptions represents the parameters of the ThreadCycle method.
+// All depths are radial, even in diameter mode.
+type ThreadOptions struct {
+	// Pitch is the distance the thread advances per revolution.
+	Pitch float64
+	// Depth is the full depth of the thread.
+	Depth float64
+	// PeakOffset is the distance from the drive line (the X position
+	// of the tool when the cycle starts) to the crest of the thread.
+	PeakOffset float64
+	// FirstCut is the depth of the first pass.
+	FirstCut float64
+	// MinCut, if positive, is the minimum depth cut by each pass.
+	// It is not supported by the LinuxCNC G76 cycle.
+	MinCut float64
+	// Degression determines the depth of the following passes, such
+	// that pass n is cut to FirstCut * n^(1/Degression). 1 (the default)
+	// cuts constant depths and 2 cuts constant areas.
+	Degression float64
+	// CompoundAngle is the angle of the infeed from the radial direction
+	// in degrees, such as 29.5 for 60° threads. Default is 0.
+	CompoundAngle float64
+	// SpringPasses is the number of passes repeated at the full depth.
+	SpringPasses int
+	// Internal cuts an internal thread, away from the axis.
+	Internal bool
+}
+
+// MetricThread returns the options to cut an external 60° ISO metric
+// thread of the given pitch (in mm).
+func MetricThread(pitch float64) *ThreadOptions {
+	depth := 0.61343 * pitch
+	return &ThreadOptions{
+		Pitch:         pitch,
+		Depth:         depth,
+		FirstCut:      depth / 4,
+		Degression:    2,
+		CompoundAngle: 29.5,
+		SpringPasses:  1,
+	}
+}
+
+// UnifiedThread returns the options to cut an external 60° unified
+// (UNC/UNF) thread with the given number of threads per inch
+// in a program using millimeters.
+func UnifiedThread(tpi float64) *ThreadOptions {
+	return MetricThread(25.4 / tpi)
+}
+
+// LatheMode sets up the program for a lathe by selecting the XZ plane
+// (G18) and either diameter (G7) or radius (G8) mode, which determines
+// whether X is programmed as a diameter or as a radius.
+//
+// On Fanuc controls diameter programming is a machine parameter (and
+// G7 selects cylindrical interpolation instead), so only G18 is emitted
+// and diameter only selects how X is interpreted by this package.
+func (g *GCode) LatheMode(diameter bool) *GCode {
+	g.Plane(PlaneXZ)
+	g.diameterMode = diameter
+	if g.dialect == dialectFanuc {
+		return g
+	}
+	if diameter {
+		return g.sendOpCode("G7")
+	}
+	return g.sendOpCode("G8")
+}
+
+// IsDiameterMode reports whether X is programmed as a diameter
+// (see LatheMode).
+func (g *GCode) IsDiameterMode() bool { return g.diameterMode }
+
+// ConstantSurfaceSpeed sets the spindle speed to maintain the given
+// surface speed (G96) in units per minute, limited to maxRPM if positive.
+func (g *GCode) ConstantSurfaceSpeed(speed, maxRPM float64) *GCode {
+	if g.dialect == dialectFanuc {
+		if maxRPM > 0 {
+			g.sendOpCode(fmt.Sprintf("G50 S%v", maxRPM))
+		}
+		return g.sendOpCode(fmt.Sprintf("G96 S%v", speed))
+	}
+	if maxRPM > 0 {
+		return g.sendOpCode(fmt.Sprintf("G96 D%v S%v", maxRPM, speed))
+	}
+	return g.sendOpCode(fmt.Sprintf("G96 S%v", speed))
+}
+
+// ConstantRPM cancels constant surface speed and sets
+// the spindle speed to rpm (G97).
+func (g *GCode) ConstantRPM(rpm float64) *GCode {
+	return g.sendOpCode(fmt.Sprintf("G97 S%v", rpm))
+}
+
+// SpindleSyncMove performs a move to p in XZ that is synchronized with
+// the spindle, advancing pitch per revolution (G33, or G32 for Fanuc),
+// such as a threading pass.
+func (g *GCode) SpindleSyncMove(p Tuple, pitch float64) *GCode {
+	if g.xform != nil {
+		log.Fatal("SpindleSyncMove: spindle synchronized moves can not be transformed")
+	}
+	pos := g.lastPos()
+	newPos := XYZ(p.X(), pos.Y(), p.Z())
+	opCode, word := "G33", "K"
+	if g.dialect == dialectFanuc {
+		opCode, word = "G32", "F"
+	}
+	s, _ := g.genChanged(opCode, newPos, g.extra, forceZ)
+	if s == "" {
+		return g
+	}
+	s += fmt.Sprintf(" %v%v", word, pitch)
+	g.steps = append(g.steps, &Step{s: s, pos: newPos})
+	g.hasMoved = true
+	return g
+}
+
+// ThreadCycle cuts a thread from the current position, which is the
+// start of the thread on the drive line, to zEnd in multiple passes.
+//
+// LinuxCNC uses its G76 cycle and Fanuc uses its two-block G76 cycle.
+// Without a dialect, the passes are expanded into rapid moves and
+// spindle synchronized moves (G33) following the G76 cycle of LinuxCNC.
+// The tool returns to the starting position.
+func (g *GCode) ThreadCycle(zEnd float64, opts *ThreadOptions) *GCode {
+	if g.xform != nil {
+		log.Fatal("ThreadCycle: threading cycles can not be transformed")
+	}
+	if opts == nil || opts.Pitch <= 0 || opts.Depth <= 0 || opts.FirstCut <= 0 {
+		log.Fatal("ThreadCycle: Pitch, Depth, and FirstCut must be positive")
+	}
+	degression := opts.Degression
+	if degression <= 0 {
+		degression = 1
+	}
+
+	pos := g.Position()
+	dir, scale := -1.0, 1.0
+	if opts.Internal {
+		dir = 1
+	}
+	if g.diameterMode {
+		scale = 2
+	}
+	peakOffset := dir * opts.PeakOffset
+
+	switch g.dialect {
+	case dialectLinuxCNC:
+		s := fmt.Sprintf("G76 P%v Z%.8f I%.8f J%.8f R%v K%.8f Q%v H%v",
+			opts.Pitch, zEnd, peakOffset, opts.FirstCut, degression, opts.Depth, opts.CompoundAngle, opts.SpringPasses)
+		return g.sendOpCode(s)
+	case dialectFanuc:
+		root := pos.X() + dir*scale*(opts.PeakOffset+opts.Depth)
+		g.sendOpCode(fmt.Sprintf("G76 P%02d00%02d Q%v R0", opts.SpringPasses+1, fanucThreadAngle(opts.CompoundAngle), microns(opts.MinCut)))
+		s := fmt.Sprintf("G76 X%.8f Z%.8f P%v Q%v F%v", root, zEnd, microns(opts.Depth), microns(opts.FirstCut), opts.Pitch)
+		return g.sendOpCode(s)
+	}
+
+	shiftDir := 1.0
+	if zEnd > pos.Z() {
+		shiftDir = -1
+	}
+	tan := math.Tan(ToRad(opts.CompoundAngle))
+	pass := func(depth float64) {
+		shift := shiftDir * depth * tan
+		g.GotoZ(Z(pos.Z() + shift))
+		g.GotoX(X(pos.X() + dir*scale*(opts.PeakOffset+depth)))
+		g.SpindleSyncMove(XZ(g.Position().X(), zEnd+shift), opts.Pitch)
+		g.GotoX(X(pos.X()))
+		g.GotoZ(Z(pos.Z()))
+	}
+	for _, depth := range threadPassDepths(opts.FirstCut, opts.MinCut, opts.Depth, degression) {
+		pass(depth)
+	}
+	for i := 0; i < opts.SpringPasses; i++ {
+		pass(opts.Depth)
+	}
+	return g
+}
+
+// threadPassDepths returns the depths of the threading passes.
+func threadPassDepths(firstCut, minCut, depth, degression float64) []float64 {
+	var result []float64
+	var last float64
+	for n := 1; last < depth-epsilon; n++ {
+		d := firstCut * math.Pow(float64(n), 1/degression)
+		if d < last+minCut {
+			d = last + minCut
+		}
+		if d > depth {
+			d = depth
+		}
+		result = append(result, d)
+		last = d
+	}
+	return result
+}
+
+// fanucThreadAngle returns the tool angle supported by the Fanuc G76
+// cycle that is closest to twice the compound angle.
+func fanucThreadAngle(compoundAngle float64) int {
+	best := 0
+	for _, a := range []int{0, 29, 30, 55, 60, 80} {
+		if math.Abs(float64(a)-2*compoundAngle) < math.Abs(float64(best)-2*compoundAngle) {
+			best = a
+		}
+	}
+	return best
+}
+
+// microns returns v in thousandths of a unit, as used by the Fanuc G76 cycle.
+func microns(v float64) int {
+	return int(math.Round(1000 * v))
+}
@@ -0,0 +1,73 @@
+package gcode
+
+import "testing"
+
+func TestLatheMode(t *testing.T) {
+	g := New(NoHeader, UseFanuc)
+	g.LatheMode(true)
+	g.ConstantSurfaceSpeed(200, 3000)
+	g.GotoXZ(XZ(22, 2))
+	g.ThreadCycle(-20, &ThreadOptions{Pitch: 1.5, Depth: 0.92, PeakOffset: 1, FirstCut: 0.2, MinCut: 0.05, CompoundAngle: 29.5, SpringPasses: 1})
+	g.ConstantRPM(500)
+
+	got := g.String()
+	want := `G18
+G50 S3000
+G96 S200
+G0 X22.00000000 Z2.00000000
+G76 P020060 Q50 R0
+G76 X18.16000000 Z-20.00000000 P920 Q200 F1.5
+G97 S500
+`
+	if got != want {
+		t.Errorf("LatheMode =\n%v\nwant:\n%v", got, want)
+	}
+	if !g.IsDiameterMode() {
+		t.Error("IsDiameterMode = false, want true")
+	}
+}
+
+func TestThreadCycle(t *testing.T) {
+	opts := &ThreadOptions{Pitch: 1, Depth: 0.6, PeakOffset: 0.5, FirstCut: 0.3, SpringPasses: 1}
+
+	g := New(NoHeader, UseLinuxCNC)
+	g.LatheMode(false)
+	g.GotoXZ(XZ(10.5, 1))
+	g.ThreadCycle(-10, opts)
+
+	got := g.String()
+	want := `G18
+G8
+G0 X10.50000000 Z1.00000000
+G76 P1 Z-10.00000000 I-0.50000000 J0.30000000 R1 K0.60000000 Q0 H1
+`
+	if got != want {
+		t.Errorf("ThreadCycle(LinuxCNC) =\n%v\nwant:\n%v", got, want)
+	}
+
+	g = New(NoHeader)
+	g.LatheMode(false)
+	g.GotoXZ(XZ(10.5, 1))
+	g.ThreadCycle(-10, opts)
+
+	got = g.String()
+	want = `G18
+G8
+G0 X10.50000000 Z1.00000000
+G0 X9.70000000
+G33 Z-10.00000000 K1
+G0 X10.50000000
+G0 Z1.00000000
+G0 X9.40000000
+G33 Z-10.00000000 K1
+G0 X10.50000000
+G0 Z1.00000000
+G0 X9.40000000
+G33 Z-10.00000000 K1
+G0 X10.50000000
+G0 Z1.00000000
+`
+	if got != want {
+		t.Errorf("ThreadCycle =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -44,6 +44,7 @@ func (m M4) Mult(other M4) M4 {
 
 // MultTuple multiples an M4 matrix by a tuple.
 func (m M4) MultTuple(other Tuple) Tuple {
+	checkNumeric("MultTuple", other)
 	return Tuple{
 		m[0].full4Dot(other),
 		m[1].full4Dot(other),
@@ -1,16 +1,20 @@
 package gcode
 
-import (
-	"fmt"
-	"math"
-)
+import "math"
 
 // Feedrate sets the feedrate (F) to rate.
 // The rate is interpreted following the setting of the Feedmode function.
+// In inverse time mode, nothing is emitted and the rate is used to
+// compute the F word of each following feed move.
 func (g *GCode) Feedrate(rate float64) *GCode {
+	if g.feedMode == FeedInverseTime {
+		g.setInverseTimeRate(rate)
+		return g
+	}
+	g.feedrate = rate
 	g.steps = append(g.steps, &Step{
-		s:   fmt.Sprintf("F%.8f", rate),
-		pos: g.Position(),
+		s:   "F" + g.fmtSym("%.8f", rate),
+		pos: g.lastPos(),
 	})
 	return g
 }
@@ -19,7 +23,7 @@ func (g *GCode) Feedrate(rate float64) *GCode {
 // If newPos is non-nil, the internal new position will be updated.
 func (g *GCode) Literal(s string, newPos *Tuple) *GCode {
 	if newPos == nil {
-		v := g.Position()
+		v := g.lastPos()
 		newPos = &v
 	}
 	g.steps = append(g.steps, &Step{s: s, pos: *newPos})
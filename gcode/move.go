@@ -10,30 +10,45 @@ const (
 	forceX = 1 << iota
 	forceY
 	forceZ
+	forceA
+	forceB
+	forceC
+	forceU
+	forceV
+	forceW
 
 	forceXY  = forceX | forceY
 	forceYZ  = forceY | forceZ
 	forceXZ  = forceX | forceZ
 	forceXYZ = forceX | forceY | forceZ
+	forceAll = 1<<len(axisNames) - 1
 )
 
-func (g *GCode) genChangedXYZ(opCode string, p Tuple, force int) string {
-	pos := g.Position()
+// genChanged returns the move to p and extra mentioning the axes that
+// have changed and the mask of the mentioned axes.
+func (g *GCode) genChanged(opCode string, p Tuple, extra [6]float64, force int) (string, int) {
+	want, have := allAxes(p, extra), allAxes(g.lastPos(), g.extra)
 	var parts []string
-	if (!g.hasMoved && (force&forceX) != 0) || math.Abs(p.X()-pos.X()) >= epsilon {
-		parts = append(parts, fmt.Sprintf("X%.8f", p.X()))
-	}
-	if (!g.hasMoved && (force&forceY) != 0) || math.Abs(p.Y()-pos.Y()) >= epsilon {
-		parts = append(parts, fmt.Sprintf("Y%.8f", p.Y()))
-	}
-	if (!g.hasMoved && (force&forceZ) != 0) || math.Abs(p.Z()-pos.Z()) >= epsilon {
-		parts = append(parts, fmt.Sprintf("Z%.8f", p.Z()))
+	var axes int
+	for i, name := range axisNames {
+		// Symbolic values are always emitted since their
+		// value at the machine is not known.
+		if e, ok := g.symExpr(want[i]); ok && (force&(1<<i)) != 0 {
+			parts = append(parts, fmt.Sprintf("%c%v", name, e))
+			axes |= 1 << i
+			continue
+		}
+		unknown := !g.hasMoved || g.unknown&(1<<i) != 0
+		if (unknown && (force&(1<<i)) != 0) || math.Abs(want[i]-have[i]) >= epsilon {
+			parts = append(parts, fmt.Sprintf("%c%.8f", name, want[i]))
+			axes |= 1 << i
+		}
 	}
 	if len(parts) == 0 {
-		return ""
+		return "", 0
 	}
 	s := fmt.Sprintf("%v %v", opCode, strings.Join(parts, " "))
-	return s
+	return s, axes
 }
 
 // moveOrGo optimizes the movement to only include the
@@ -41,13 +56,58 @@ func (g *GCode) genChangedXYZ(opCode string, p Tuple, force int) string {
 // As a special case, for the very first move/goto command,
 // force the output of all the mentioned axes, even if 0.
 func (g *GCode) moveOrGo(opCode string, p Tuple, force int) {
-	s := g.genChangedXYZ(opCode, p, force)
+	g.moveOrGoAxes(opCode, p, g.extra, force)
+}
+
+// moveOrGoAxes is like moveOrGo but also moves the extra axes to extra.
+func (g *GCode) moveOrGoAxes(opCode string, p Tuple, extra [6]float64, force int) {
+	if g.xform != nil {
+		if g.isSym(p[:3]...) {
+			p = g.symMultTuple(*g.xform, p)
+		} else {
+			p = g.xform.MultTuple(p)
+		}
+		force = g.xform.forceAxes(force)
+	}
+	g.emitMoveAxes(opCode, p, extra, force)
+}
+
+// emitMove is like moveOrGo but p is already in emitted coordinates.
+func (g *GCode) emitMove(opCode string, p Tuple, force int) {
+	g.emitMoveAxes(opCode, p, g.extra, force)
+}
+
+// emitMoveAxes is like emitMove but also moves the extra axes to extra.
+func (g *GCode) emitMoveAxes(opCode string, p Tuple, extra [6]float64, force int) {
+	s, axes := g.genChanged(opCode, p, extra, force)
 	if s == "" {
 		return
 	}
+	sym := g.isSym(p[:3]...) || g.isSym(extra[:]...)
+	p = g.resolveSym(p)
 	p[3] = 1
-	g.steps = append(g.steps, &Step{s: s, pos: p})
+	for i, v := range extra {
+		if e, ok := g.symExpr(v); ok {
+			extra[i] = e.v
+		}
+	}
+	m := &motion{opCode: opCode, axes: axes, extra: extra, sym: sym}
+	g.laserSwitch(opCode)
+	s += g.inverseTimeWord(m, g.lastPos(), p)
+	g.steps = append(g.steps, &Step{s: s, pos: p, motion: m})
+	g.extra = extra
 	g.hasMoved = true
+	g.unknown &^= axes
+}
+
+// appendWords appends additional words (such as a feedrate)
+// to the last step.
+func (g *GCode) appendWords(s string) {
+	step := g.steps[len(g.steps)-1]
+	step.s += s
+	if step.motion != nil {
+		step.motion.words += s
+	}
 }
 
 // GotoX performs one or more rapid move(s) on the X axis.
@@ -120,12 +180,12 @@ func (g *GCode) GotoXYZ(ps ...Tuple) *GCode {
 
 // GotoXYZWithF performs one or more move(s) on the XYZ axes using the provided feed-rate.
 func (g *GCode) GotoXYZWithF(feedrate float64, ps ...Tuple) *GCode {
-	for i, p := range ps {
+	if len(ps) == 0 {
+		return g
+	}
+	g.withF(feedrate, func() { g.moveOrGo("G0", ps[0], forceXYZ) })
+	for _, p := range ps[1:] {
 		g.moveOrGo("G0", p, forceXYZ)
-		if i == 0 {
-			lastStep := len(g.steps) - 1
-			g.steps[lastStep].s += fmt.Sprintf(" F%v", feedrate)
-		}
 	}
 	return g
 }
@@ -165,11 +225,11 @@ func (g *GCode) MoveZWithF(feedrate float64, ps ...Tuple) *GCode {
 	pos := g.Position()
 	for i, p := range ps {
 		newPos := XYZ(pos.X(), pos.Y(), p.Z())
-		g.moveOrGo("G1", newPos, forceZ)
 		if i == 0 {
-			lastStep := len(g.steps) - 1
-			g.steps[lastStep].s += fmt.Sprintf(" F%v", feedrate)
+			g.withF(feedrate, func() { g.moveOrGo("G1", newPos, forceZ) })
+			continue
 		}
+		g.moveOrGo("G1", newPos, forceZ)
 	}
 	return g
 }
@@ -217,7 +277,7 @@ func (g *GCode) MoveXYZ(ps ...Tuple) *GCode {
 func (g *GCode) MoveXYZRel(ps ...Tuple) *GCode {
 	for _, p := range ps {
 		pos := g.Position()
-		g.moveOrGo("G1", pos.Add(p), forceXYZ)
+		g.moveOrGo("G1", XYZ(g.addSym(pos.X(), p.X()), g.addSym(pos.Y(), p.Y()), g.addSym(pos.Z(), p.Z())), forceXYZ)
 	}
 	return g
 }
@@ -5,7 +5,7 @@ func (g *GCode) Pathmode(exact bool) *GCode {
 	// TODO: support G64.
 	if exact {
 		s := "G61"
-		step := &Step{s: s, pos: g.Position()}
+		step := &Step{s: s, pos: g.lastPos()}
 		g.steps = append(g.steps, step)
 	}
 	return g
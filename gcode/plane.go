@@ -23,8 +23,9 @@ func (g *GCode) Plane(p PlaneT) *GCode {
 	g.activePlane = p
 
 	g.steps = append(g.steps, &Step{
-		s:   s,
-		pos: g.Position(),
+		s:     s,
+		pos:   g.lastPos(),
+		plane: p,
 	})
 	return g
 }
@@ -0,0 +1,229 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// Default printer options.
+const (
+	defaultFilamentDiameter = 1.75
+	defaultLayerHeight      = 0.2
+	defaultLineWidth        = 0.4
+	defaultRetractLength    = 1
+	defaultRetractFeedrate  = 2100
+	defaultTravelFeedrate   = 6000
+)
+
+// PrinterOptions represents options for a 3D printer (see NewPrinter).
+type PrinterOptions struct {
+	// FilamentDiameter is the diameter of the filament. Default is 1.75.
+	FilamentDiameter *float64
+	// LayerHeight is the height of the printed lines. Default is 0.2.
+	LayerHeight *float64
+	// LineWidth is the width of the printed lines. Default is 0.4.
+	LineWidth *float64
+	// Flow is the extrusion multiplier. Default is 1.
+	Flow *float64
+	// RelativeExtrusion selects relative extrusion mode (M83).
+	// Otherwise, absolute extrusion mode (M82) is used.
+	RelativeExtrusion bool
+	// RetractLength is the length of filament retracted by Retract.
+	// Default is 1.
+	RetractLength *float64
+	// RetractFeedrate is the feedrate of retracting. Default is 2100.
+	RetractFeedrate *float64
+	// ZHop is the distance the nozzle is raised while retracted.
+	ZHop float64
+	// TravelFeedrate is the feedrate of Travel moves. Default is 6000.
+	TravelFeedrate *float64
+}
+
+// Printer represents a 3D printer design, which extrudes filament
+// on the E axis while moving in XY.
+type Printer struct {
+	*GCode
+
+	filamentArea    float64
+	layerHeight     float64
+	lineWidth       float64
+	flow            float64
+	relative        bool
+	retractLength   float64
+	retractFeedrate float64
+	zHop            float64
+	travelFeedrate  float64
+
+	e         float64 // position of the E axis (in absolute extrusion mode).
+	retracted bool
+	restoreF  bool // true if the feedrate must be restored on the next move.
+}
+
+// NewPrinter returns a printer design built on g,
+// such as New(UseMarlin).
+func NewPrinter(g *GCode, opts *PrinterOptions) *Printer {
+	if opts == nil {
+		opts = &PrinterOptions{}
+	}
+	d := getFloat(opts.FilamentDiameter, defaultFilamentDiameter)
+	p := &Printer{
+		GCode:           g,
+		filamentArea:    math.Pi * d * d / 4,
+		layerHeight:     getFloat(opts.LayerHeight, defaultLayerHeight),
+		lineWidth:       getFloat(opts.LineWidth, defaultLineWidth),
+		flow:            getFloat(opts.Flow, 1),
+		retractLength:   getFloat(opts.RetractLength, defaultRetractLength),
+		retractFeedrate: getFloat(opts.RetractFeedrate, defaultRetractFeedrate),
+		zHop:            opts.ZHop,
+		travelFeedrate:  getFloat(opts.TravelFeedrate, defaultTravelFeedrate),
+	}
+	if p.filamentArea <= 0 || p.layerHeight <= 0 || p.lineWidth <= 0 {
+		log.Fatal("NewPrinter: FilamentDiameter, LayerHeight, and LineWidth must be positive")
+	}
+	if opts.RelativeExtrusion {
+		p.ExtrusionMode(true)
+	}
+	return p
+}
+
+// HotendTemperature sets the temperature of the hotend (M104) and,
+// if wait is true, waits for it to be reached (M109).
+func (p *Printer) HotendTemperature(temp float64, wait bool) *Printer {
+	if wait {
+		p.sendOpCode(fmt.Sprintf("M109 S%v", temp))
+	} else {
+		p.sendOpCode(fmt.Sprintf("M104 S%v", temp))
+	}
+	return p
+}
+
+// BedTemperature sets the temperature of the bed (M140) and,
+// if wait is true, waits for it to be reached (M190).
+func (p *Printer) BedTemperature(temp float64, wait bool) *Printer {
+	if wait {
+		p.sendOpCode(fmt.Sprintf("M190 S%v", temp))
+	} else {
+		p.sendOpCode(fmt.Sprintf("M140 S%v", temp))
+	}
+	return p
+}
+
+// ExtrusionMode selects relative (M83) or absolute (M82) extrusion mode.
+func (p *Printer) ExtrusionMode(relative bool) *Printer {
+	p.relative = relative
+	if relative {
+		p.sendOpCode("M83")
+	} else {
+		p.sendOpCode("M82")
+	}
+	return p
+}
+
+// ResetExtruder sets the position of the E axis to zero (G92 E0).
+func (p *Printer) ResetExtruder() *Printer {
+	p.e = 0
+	p.sendOpCode("G92 E0")
+	return p
+}
+
+// SetLayerHeight sets the layer height used to compute extrusion.
+func (p *Printer) SetLayerHeight(h float64) *Printer {
+	p.layerHeight = h
+	return p
+}
+
+// SetLineWidth sets the line width used to compute extrusion.
+func (p *Printer) SetLineWidth(w float64) *Printer {
+	p.lineWidth = w
+	return p
+}
+
+// Extrusion returns the length of filament extruded to print a line of
+// the given length, whose cross section is a rectangle with semicircular
+// ends (as used by Slic3r) of the current line width and layer height.
+func (p *Printer) Extrusion(length float64) float64 {
+	h, w := p.layerHeight, p.lineWidth
+	area := (w-h)*h + math.Pi*h*h/4
+	return p.flow * length * area / p.filamentArea
+}
+
+// MoveXY performs one or more printing move(s) on the XY axes
+// at the current feed-rate, extruding filament along the way.
+func (p *Printer) MoveXY(ps ...Tuple) *Printer {
+	if p.retracted {
+		p.Unretract()
+	}
+	for _, pt := range ps {
+		from := p.lastPos()
+		n := len(p.steps)
+		p.GCode.MoveXY(pt)
+		if len(p.steps) == n {
+			continue
+		}
+		to := p.lastPos()
+		p.appendWords(p.eWord(p.Extrusion(math.Hypot(to.X()-from.X(), to.Y()-from.Y()))))
+		if p.restoreF && p.feedrate > 0 {
+			p.appendWords(" F" + p.fmtSym("%v", p.feedrate))
+			p.restoreF = false
+		}
+	}
+	return p
+}
+
+// Travel performs one or more rapid move(s) on the XY axes without
+// printing, retracting the filament first and at the TravelFeedrate.
+// The filament is unretracted by the next MoveXY.
+func (p *Printer) Travel(ps ...Tuple) *Printer {
+	if len(ps) == 0 {
+		return p
+	}
+	p.Retract()
+	feedrate := p.feedrate
+	p.withF(p.travelFeedrate, func() { p.GCode.GotoXY(ps[0]) })
+	p.GCode.GotoXY(ps[1:]...)
+	p.feedrate = feedrate
+	p.restoreF = true
+	return p
+}
+
+// Retract retracts the filament and raises the nozzle by ZHop.
+func (p *Printer) Retract() *Printer {
+	if p.retracted {
+		return p
+	}
+	p.retracted = true
+	p.extrude(-p.retractLength)
+	if p.zHop > 0 {
+		p.GotoZ(Z(p.Position().Z() + p.zHop))
+	}
+	return p
+}
+
+// Unretract lowers the nozzle by ZHop and restores the retracted filament.
+func (p *Printer) Unretract() *Printer {
+	if !p.retracted {
+		return p
+	}
+	p.retracted = false
+	if p.zHop > 0 {
+		p.GotoZ(Z(p.Position().Z() - p.zHop))
+	}
+	p.extrude(p.retractLength)
+	return p
+}
+
+// extrude moves only the E axis by length at the RetractFeedrate.
+func (p *Printer) extrude(length float64) {
+	p.sendOpCode("G1" + p.eWord(length) + fmt.Sprintf(" F%v", p.retractFeedrate))
+	p.restoreF = true
+}
+
+// eWord returns the E word extruding length.
+func (p *Printer) eWord(length float64) string {
+	if p.relative {
+		return fmt.Sprintf(" E%.5f", length)
+	}
+	p.e += length
+	return fmt.Sprintf(" E%.5f", p.e)
+}
@@ -0,0 +1,66 @@
+package gcode
+
+import "testing"
+
+func TestPrinter(t *testing.T) {
+	p := NewPrinter(New(NoHeader, UseMarlin), &PrinterOptions{ZHop: 0.4})
+	p.BedTemperature(60, true)
+	p.HotendTemperature(210, true)
+	p.GotoXYZ(XYZ(0, 0, 0.2))
+	p.Feedrate(1200)
+	p.MoveXY(XY(10, 0), XY(10, 10))
+	p.Travel(XY(20, 20))
+	p.MoveXY(XY(30, 20))
+	p.ResetExtruder()
+
+	got := p.String()
+	want := `;-- prologue begin --
+G21 ;Use mm
+G90 ;Use absolute distance mode
+M82 ;Use absolute extrusion mode
+G28 ;Home all axes
+G92 E0 ;Reset extruder
+;-- prologue end --
+M190 S60
+M109 S210
+G0 X0.00000000 Y0.00000000 Z0.20000000
+F1200.00000000
+G1 X10.00000000 E0.29691
+G1 Y10.00000000 E0.59383
+G1 E-0.40617 F2100
+G0 Z0.60000000
+G0 X20.00000000 Y20.00000000 F6000
+G0 Z0.20000000
+G1 E0.59383 F2100
+G1 X30.00000000 E0.89074 F1200
+G92 E0
+;-- epilogue begin --
+M104 S0 ;Turn off hotend
+M140 S0 ;Turn off bed
+M107 ;Turn off fan
+G91 ;Use relative distance mode
+G0 Z10 ;Raise nozzle
+G90 ;Use absolute distance mode
+M84 ;Disable steppers
+;-- epilogue end --
+`
+	if got != want {
+		t.Errorf("Printer =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestPrinter_RelativeExtrusion(t *testing.T) {
+	p := NewPrinter(New(NoHeader), &PrinterOptions{RelativeExtrusion: true, LineWidth: Float(0.5)})
+	p.MoveXY(XY(10, 0), XY(20, 0))
+	p.Retract()
+
+	got := p.String()
+	want := `M83
+G1 X10.00000000 Y0.00000000 E0.38006
+G1 X20.00000000 E0.38006
+G1 E-1.00000 F2100
+`
+	if got != want {
+		t.Errorf("Printer =\n%v\nwant:\n%v", got, want)
+	}
+}
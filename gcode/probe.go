@@ -0,0 +1,426 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Default probing options.
+const (
+	defaultProbeFeedrate = 100
+	defaultProbeDistance = 10
+	defaultProbeRetract  = 2
+)
+
+// probeParams are the parameters holding the X, Y, and Z position
+// of the last probe trigger for both LinuxCNC and Fanuc.
+var probeParams = []string{"#5061", "#5062", "#5063"}
+
+// ProbeOptions represents options for the probing cycles.
+type ProbeOptions struct {
+	// Feedrate is the feedrate of the initial probe. Default is 100.
+	Feedrate *float64
+	// SlowFeedrate, if non-nil, is the feedrate used to reprobe
+	// after retracting from the initial contact.
+	SlowFeedrate *float64
+	// Distance is the maximum probing travel. Default is 10.
+	Distance *float64
+	// Retract is the distance to back off after contact. Default is 2.
+	Retract *float64
+	// TipDiameter is the diameter of the probe tip, used to compensate
+	// the probed X and Y positions.
+	TipDiameter float64
+	// ZOffset is the Z coordinate of the probed surface, such as the
+	// thickness of a touch plate or the height of a tool setter.
+	ZOffset float64
+	// Param, if not empty, is the variable (see Declare and SetVar) in
+	// which the result is stored. Cycles with more than one result use
+	// consecutive parameters when Param is a number such as "#500",
+	// or otherwise append "_x", "_y", "_z", and "_d" (diameter) to Param.
+	// Storing results requires UseLinuxCNC or UseFanuc.
+	Param string
+	// SetOrigin sets the probed feature as the origin of WorkOffset
+	// using G10 L20.
+	SetOrigin bool
+	// WorkOffset is the work coordinate system (1-9 for G54-G59.3) set
+	// by SetOrigin. Zero means the active work coordinate system.
+	WorkOffset int
+	// NoError probes using G38.3 (or G38.5 with Away) so that the
+	// machine does not stop with an error when the probe does not trip.
+	// Fanuc always probes using the G31 skip function, which does not
+	// raise an error.
+	NoError bool
+	// Away probes along the direction until the probe loses contact
+	// using G38.4 (or G38.5 with NoError), for example to find the far
+	// side of the edge that the probe touches. The edge position is then
+	// compensated by TipDiameter towards the work piece and the probe
+	// retracts further away. It is only supported by ProbeEdge, without
+	// SlowFeedrate, and not with UseFanuc.
+	Away bool
+}
+
+func getFloat(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func (p *ProbeOptions) feedrate() float64  { return getFloat(p.Feedrate, defaultProbeFeedrate) }
+func (p *ProbeOptions) distance() float64  { return getFloat(p.Distance, defaultProbeDistance) }
+func (p *ProbeOptions) retract() float64   { return getFloat(p.Retract, defaultProbeRetract) }
+func (p *ProbeOptions) tipRadius() float64 { return 0.5 * p.TipDiameter }
+
+// toward returns the direction towards the work piece when probing
+// in direction s.
+func (p *ProbeOptions) toward(s float64) float64 {
+	if p.Away {
+		return -s
+	}
+	return s
+}
+
+// resultParams returns the names of the parameters storing the
+// results, or nil if results are not stored.
+func (p *ProbeOptions) resultParams(suffixes ...string) []string {
+	if p.Param == "" {
+		return nil
+	}
+	if len(suffixes) == 1 {
+		return []string{p.Param}
+	}
+	var names []string
+	if n, err := strconv.Atoi(strings.TrimPrefix(p.Param, "#")); err == nil && strings.HasPrefix(p.Param, "#") {
+		for i := range suffixes {
+			names = append(names, fmt.Sprintf("#%v", n+i))
+		}
+		return names
+	}
+	for _, suffix := range suffixes {
+		names = append(names, p.Param+"_"+suffix)
+	}
+	return names
+}
+
+// ProbeZ probes down to the surface below the tool using G38.2 (G31
+// with UseFanuc, see ProbeOptions), for example to touch off on a
+// touch plate of thickness ZOffset.
+// The Z at contact is stored in Param and SetOrigin sets the
+// surface to ZOffset. The probe then retracts.
+func (g *GCode) ProbeZ(opts *ProbeOptions) *GCode {
+	opts = orEmpty(opts)
+	g.checkProbe("ProbeZ", opts)
+	g.probeAxis(2, -1, opts.distance(), opts)
+	g.storeProbe(opts, []Expr{g.probeResult(2, 0)}, "z")
+	if opts.SetOrigin {
+		g.setWorkPosition(opts.WorkOffset, Z(opts.ZOffset), forceZ)
+	}
+	g.probeRetract(2, 1, opts)
+	return g
+}
+
+// ProbeEdge probes along dir (for example, X(1) or Y(-1)) until
+// the probe touches an edge of the work piece using G38.2 (G31 with
+// UseFanuc), or until it loses contact with Away (see ProbeOptions).
+// The edge position, compensated by TipDiameter, is stored in Param
+// and SetOrigin sets the edge as the origin of its axis.
+// The probe then retracts.
+func (g *GCode) ProbeEdge(dir Tuple, opts *ProbeOptions) *GCode {
+	opts = orEmpty(opts)
+	g.checkProbe("ProbeEdge", opts)
+	axis, s := probeDir("ProbeEdge", dir)
+	g.probeEdge(axis, s, opts.distance(), opts, axisSuffix(axis))
+	g.probeRetract(axis, -opts.toward(s), opts)
+	return g
+}
+
+// ProbeCorner finds an outside corner of the work piece. The probe
+// starts diagonally outside the corner at probing depth, less than
+// Distance from each face, and sides (for example, XY(1, 1) for the
+// lower left corner) points towards the work piece. Each face is probed
+// after moving Distance along the other face.
+// The corner is stored in Param and SetOrigin sets it as the XY origin,
+// in which case the probe finishes outside the corner at Retract from
+// both faces. Otherwise, the probe returns to its starting position.
+func (g *GCode) ProbeCorner(sides Tuple, opts *ProbeOptions) *GCode {
+	opts = orEmpty(opts)
+	g.checkProbe("ProbeCorner", opts)
+	ss := []float64{sign(sides.X()), sign(sides.Y())}
+	if ss[0] == 0 || ss[1] == 0 {
+		log.Fatalf("ProbeCorner: invalid sides %v", sides)
+	}
+	start := g.lastPos()
+	d := opts.distance()
+	r := opts.tipRadius()
+	names := opts.resultParams("x", "y")
+	for axis, s := range ss {
+		// Coordinates of the other axis are only known relative to
+		// the new origin once it has been set.
+		other := 1 - axis
+		approach, finish := start[other]+ss[other]*d, start[other]
+		if opts.SetOrigin && axis == 1 {
+			approach, finish = ss[other]*d, -ss[other]*(r+opts.retract())
+		}
+
+		p := g.lastPos()
+		p[other] = approach
+		g.hasMoved = false
+		g.emitMove("G0", p, 1<<other)
+
+		o := *opts
+		o.Param = ""
+		if len(names) > 0 {
+			o.Param = names[axis]
+		}
+		g.probeEdge(axis, s, d, &o, "")
+		g.probeRetract(axis, -s, &o)
+
+		p = g.lastPos()
+		p[other] = finish
+		g.hasMoved = false
+		g.emitMove("G0", p, 1<<other)
+	}
+	return g
+}
+
+// ProbeBore finds the center of a bore using G38.2 (G31 with UseFanuc,
+// see ProbeOptions) by probing in
+// +X, -X, +Y, and -Y from a starting position near its center at
+// probing depth, and then moves to the center.
+// The center and diameter are stored in Param and SetOrigin sets the
+// center as the XY origin. This requires UseLinuxCNC or UseFanuc.
+func (g *GCode) ProbeBore(opts *ProbeOptions) *GCode {
+	return g.probeCenter("ProbeBore", false, 0, 0, opts)
+}
+
+// ProbeBoss finds the center of a boss of approximately the given
+// diameter using G38.2 (G31 with UseFanuc, see ProbeOptions). The probe
+// starts above the center of the boss,
+// lowers by depth outside each of its +X, -X, +Y, and -Y sides, probes
+// towards its center, and finally moves above the center.
+// The center and diameter are stored in Param and SetOrigin sets the
+// center as the XY origin. This requires UseLinuxCNC or UseFanuc.
+func (g *GCode) ProbeBoss(diameter, depth float64, opts *ProbeOptions) *GCode {
+	return g.probeCenter("ProbeBoss", true, diameter, depth, opts)
+}
+
+// ProbeToolLength moves to the tool setter at the machine XY position
+// setter using G53 at the current height and probes down using G38.2
+// (G31 with UseFanuc, see ProbeOptions).
+// The probed Z is stored in Param and SetOrigin sets the top of the
+// tool setter to ZOffset (typically measured with the first tool).
+// The probe then retracts.
+func (g *GCode) ProbeToolLength(setter Tuple, opts *ProbeOptions) *GCode {
+	opts = orEmpty(opts)
+	g.checkProbe("ProbeToolLength", opts)
+	g.GotoMachineXY(setter)
+	return g.ProbeZ(opts)
+}
+
+func (g *GCode) checkProbe(name string, opts *ProbeOptions) {
+	if g.xform != nil {
+		log.Fatalf("%v: probing cycles can not be transformed", name)
+	}
+	if opts.Param != "" && g.dialect == dialectNone {
+		log.Fatalf("%v: storing results in %q requires UseLinuxCNC or UseFanuc", name, opts.Param)
+	}
+	if opts.Away && (name != "ProbeEdge" || opts.SlowFeedrate != nil || g.dialect == dialectFanuc) {
+		log.Fatalf("%v: probing away is only supported by ProbeEdge, without SlowFeedrate, and not with UseFanuc", name)
+	}
+}
+
+// probeCenter probes the four sides of a bore or boss.
+func (g *GCode) probeCenter(name string, boss bool, diameter, depth float64, opts *ProbeOptions) *GCode {
+	opts = orEmpty(opts)
+	g.checkProbe(name, opts)
+	if g.dialect == dialectNone {
+		log.Fatalf("%v requires UseLinuxCNC or UseFanuc", name)
+	}
+
+	d := opts.distance()
+	r := opts.tipRadius()
+	o := *opts
+	o.SetOrigin = false
+
+	// The center of each axis is only known symbolically once probed.
+	base := g.lastPos()
+	var results []Expr
+	for axis := 0; axis < 2; axis++ {
+		var sides []Expr
+		for _, s := range []float64{1, -1} {
+			if boss {
+				p := base
+				p[axis] += s * (0.5*diameter + d)
+				g.hasMoved = false
+				g.emitMove("G0", p, forceXY)
+				p[2] -= depth
+				g.emitMove("G1", p, forceZ)
+				o.Param = g.probeTemp(axis, s)
+				g.probeAxis(axis, -s, 2*d, &o)
+				g.storeProbe(&o, []Expr{g.probeResult(axis, -s*r)}, "")
+				g.probeRetract(axis, s, &o)
+				p = g.lastPos()
+				p[2] += depth
+				g.emitMove("G0", p, forceZ)
+			} else {
+				o.Param = g.probeTemp(axis, s)
+				g.probeAxis(axis, s, d, &o)
+				g.storeProbe(&o, []Expr{g.probeResult(axis, s*r)}, "")
+				g.probeRetract(axis, -s, &o)
+				g.hasMoved = false
+				g.emitMove("G0", base, 1<<axis)
+			}
+			sides = append(sides, g.Var(o.Param))
+		}
+		c := sides[0].Add(sides[1]).Div(Num(2))
+		results = append(results, c)
+		if axis == 0 {
+			results = append(results, sides[0].Sub(sides[1]))
+		}
+		base[axis] = c.Sym()
+		g.hasMoved = false
+		g.emitMove("G0", base, 1<<axis)
+	}
+
+	results = []Expr{results[0], results[2], results[1]}
+	g.storeProbe(opts, results, "x", "y", "d")
+	if opts.SetOrigin {
+		g.setWorkPosition(opts.WorkOffset, XY(0, 0), forceXY)
+	}
+	g.hasMoved = false
+	return g
+}
+
+// probeTemp returns the name of the variable holding an intermediate
+// probing result.
+func (g *GCode) probeTemp(axis int, s float64) string {
+	dir := "p"
+	if s < 0 {
+		dir = "m"
+	}
+	return fmt.Sprintf("probe_%v%v", axisSuffix(axis), dir)
+}
+
+// probeEdge probes an edge and stores the result.
+func (g *GCode) probeEdge(axis int, s, distance float64, opts *ProbeOptions, suffix string) {
+	r := opts.tipRadius() * opts.toward(s)
+	g.probeAxis(axis, s, distance, opts)
+	g.storeProbe(opts, []Expr{g.probeResult(axis, r)}, suffix)
+	if opts.SetOrigin {
+		var p Tuple
+		p[axis] = -r
+		g.setWorkPosition(opts.WorkOffset, p, 1<<axis)
+	}
+}
+
+// probeAxis probes along the axis in direction s (1 or -1) using
+// relative moves, optionally reprobing at the slow feedrate.
+// The simulated contact is at the end of the probing travel.
+func (g *GCode) probeAxis(axis int, s, distance float64, opts *ProbeOptions) {
+	name := string("XYZ"[axis])
+	contact := g.lastPos()
+	contact[axis] += s * distance
+
+	code := g.probeCode(opts)
+	g.sendOpCode("G91")
+	g.sendOpCode(fmt.Sprintf("%v %v%.8f F%.8f", code, name, s*distance, opts.feedrate()))
+	if opts.SlowFeedrate != nil {
+		r := opts.retract()
+		g.sendOpCode(fmt.Sprintf("G0 %v%.8f", name, -s*r))
+		g.sendOpCode(fmt.Sprintf("%v %v%.8f F%.8f", code, name, 2*s*r, *opts.SlowFeedrate))
+	}
+	g.steps = append(g.steps, &Step{s: "G90", pos: contact})
+	for i, param := range probeParams {
+		g.params[param] = contact[i]
+	}
+	g.hasMoved = false
+}
+
+// probeCode returns the probing G-code of the dialect for opts.
+func (g *GCode) probeCode(opts *ProbeOptions) string {
+	if g.dialect == dialectFanuc {
+		return "G31"
+	}
+	n := 2
+	if opts.Away {
+		n = 4
+	}
+	if opts.NoError {
+		n++
+	}
+	return fmt.Sprintf("G38.%v", n)
+}
+
+// probeRetract backs off along the axis in direction s (1 or -1).
+func (g *GCode) probeRetract(axis int, s float64, opts *ProbeOptions) {
+	r := opts.retract()
+	pos := g.lastPos()
+	pos[axis] += s * r
+	g.sendOpCode("G91")
+	g.sendOpCode(fmt.Sprintf("G0 %c%.8f", "XYZ"[axis], s*r))
+	g.steps = append(g.steps, &Step{s: "G90", pos: pos})
+	g.hasMoved = false
+}
+
+// probeResult returns the probed position along axis plus offset.
+func (g *GCode) probeResult(axis int, offset float64) Expr {
+	if g.dialect == dialectNone {
+		return Num(g.params[probeParams[axis]] + offset)
+	}
+	e := g.Var(probeParams[axis])
+	switch {
+	case offset > 0:
+		e = e.Add(Num(offset))
+	case offset < 0:
+		e = e.Sub(Num(-offset))
+	}
+	return e
+}
+
+// storeProbe stores the results in the variables named by opts.Param.
+func (g *GCode) storeProbe(opts *ProbeOptions, results []Expr, suffixes ...string) {
+	names := opts.resultParams(suffixes...)
+	for i, name := range names {
+		g.SetVar(name, results[i])
+	}
+}
+
+func probeDir(name string, dir Tuple) (int, float64) {
+	axis := -1
+	for i := 0; i < 3; i++ {
+		if dir[i] == 0 {
+			continue
+		}
+		if axis >= 0 {
+			log.Fatalf("%v: direction %v must be along a single axis", name, dir)
+		}
+		axis = i
+	}
+	if axis < 0 {
+		log.Fatalf("%v: invalid direction %v", name, dir)
+	}
+	return axis, sign(dir[axis])
+}
+
+func axisSuffix(axis int) string {
+	return string("xyz"[axis])
+}
+
+func sign(v float64) float64 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+func orEmpty(opts *ProbeOptions) *ProbeOptions {
+	if opts == nil {
+		return &ProbeOptions{}
+	}
+	return opts
+}
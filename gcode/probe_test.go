@@ -0,0 +1,158 @@
+package gcode
+
+import "testing"
+
+func TestProbeZ(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.ProbeZ(&ProbeOptions{SlowFeedrate: Float(25), ZOffset: 1, SetOrigin: true})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z5.00000000
+G91
+G38.2 Z-10.00000000 F100.00000000
+G0 Z2.00000000
+G38.2 Z-4.00000000 F25.00000000
+G90
+G10 L20 P1 Z1.00000000
+G91
+G0 Z2.00000000
+G90
+`
+	if got != want {
+		t.Errorf("ProbeZ =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(0, 0, 3); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestProbeBore(t *testing.T) {
+	g := New(NoHeader, UseLinuxCNC)
+	g.GotoXYZ(XYZ(0, 0, -5))
+	g.ProbeBore(&ProbeOptions{Param: "bore", TipDiameter: 2})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z-5.00000000
+G91
+G38.2 X10.00000000 F100.00000000
+G90
+#<probe_xp> = [#5061 + 1.00000000]
+G91
+G0 X-2.00000000
+G90
+G0 X0.00000000
+G91
+G38.2 X-10.00000000 F100.00000000
+G90
+#<probe_xm> = [#5061 - 1.00000000]
+G91
+G0 X2.00000000
+G90
+G0 X0.00000000
+G0 X[[#<probe_xp> + #<probe_xm>] / 2.00000000]
+G91
+G38.2 Y10.00000000 F100.00000000
+G90
+#<probe_yp> = [#5062 + 1.00000000]
+G91
+G0 Y-2.00000000
+G90
+G0 Y0.00000000
+G91
+G38.2 Y-10.00000000 F100.00000000
+G90
+#<probe_ym> = [#5062 - 1.00000000]
+G91
+G0 Y2.00000000
+G90
+G0 Y0.00000000
+G0 Y[[#<probe_yp> + #<probe_ym>] / 2.00000000]
+#<bore_x> = [[#<probe_xp> + #<probe_xm>] / 2.00000000]
+#<bore_y> = [[#<probe_yp> + #<probe_ym>] / 2.00000000]
+#<bore_d> = [#<probe_xp> - #<probe_xm>]
+`
+	if got != want {
+		t.Errorf("ProbeBore =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(0, 0, -5); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestProbeCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		dir  Tuple
+		po   ProbeOptions
+		want string
+	}{
+		{
+			name: "Fanuc",
+			opts: []Option{NoHeader, UseFanuc},
+			dir:  X(1),
+			po:   ProbeOptions{SlowFeedrate: Float(25), TipDiameter: 2, Param: "#500"},
+			want: `G91
+G31 X10.00000000 F100.00000000
+G0 X-2.00000000
+G31 X4.00000000 F25.00000000
+G90
+#500 = [#5061 + 1.00000000]
+G91
+G0 X-2.00000000
+G90
+`,
+		},
+		{
+			name: "NoError",
+			opts: []Option{NoHeader, UseLinuxCNC},
+			dir:  X(1),
+			po:   ProbeOptions{NoError: true},
+			want: `G91
+G38.3 X10.00000000 F100.00000000
+G90
+G91
+G0 X-2.00000000
+G90
+`,
+		},
+		{
+			name: "Away",
+			opts: []Option{NoHeader, UseLinuxCNC},
+			dir:  X(1),
+			po:   ProbeOptions{Away: true, TipDiameter: 2, Param: "#500", SetOrigin: true},
+			want: `G91
+G38.4 X10.00000000 F100.00000000
+G90
+#500 = [#5061 - 1.00000000]
+G10 L20 P1 X1.00000000
+G91
+G0 X2.00000000
+G90
+`,
+		},
+		{
+			name: "Away NoError",
+			opts: []Option{NoHeader, UseLinuxCNC},
+			dir:  Y(-1),
+			po:   ProbeOptions{Away: true, NoError: true},
+			want: `G91
+G38.5 Y-10.00000000 F100.00000000
+G90
+G91
+G0 Y-2.00000000
+G90
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(tt.opts...)
+			g.ProbeEdge(tt.dir, &tt.po)
+			if got := g.String(); got != tt.want {
+				t.Errorf("ProbeEdge =\n%v\nwant:\n%v", got, tt.want)
+			}
+		})
+	}
+}
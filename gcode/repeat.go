@@ -0,0 +1,212 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// RepeatMode selects how Repeat positions each copy of a sub-program.
+type RepeatMode int
+
+const (
+	// RepeatTransform re-emits the coordinates of each copy
+	// transformed by its placement (the default).
+	RepeatTransform RepeatMode = iota
+	// RepeatG52 emits each copy unchanged within a G52 local offset.
+	// Placements must be translations only.
+	RepeatG52
+	// RepeatG10L2 emits each copy unchanged within a work offset
+	// set by G10 L2. Placements must be translations with an optional
+	// rotation about the Z axis, which requires the LinuxCNC dialect.
+	RepeatG10L2
+)
+
+// RepeatOptions represents options for the Repeat method.
+type RepeatOptions struct {
+	// Mode selects how each copy is positioned.
+	Mode RepeatMode
+	// SafeZ, if non-nil, is the Z height to retract to between copies.
+	SafeZ *float64
+	// WorkOffset is the coordinate system (1-9 for G54-G59.3) that is
+	// set by G10 L2 for each copy. Zero means 2 (G55).
+	WorkOffset int
+	// Origin is added to each placement for G10 L2 in addition to the
+	// modeled origin of the active work coordinate system (see ModelWorkOffset).
+	Origin Tuple
+}
+
+// workOffsetCodes maps the G10 L2 P number to its G-Code.
+var workOffsetCodes = []string{"G53", "G54", "G55", "G56", "G57", "G58", "G59", "G59.1", "G59.2", "G59.3"}
+
+// Repeat emits a copy of the recorded sub-program sub for each placement.
+//
+// The sub-program is typically recorded with New(NoHeader) and its
+// coordinates are relative to its own origin. Any transform in effect
+// (see PushTransform) is applied in addition to each placement.
+func (g *GCode) Repeat(sub *GCode, placements []M4, opts *RepeatOptions) *GCode {
+	if opts == nil {
+		opts = &RepeatOptions{}
+	}
+
+	for i, placement := range placements {
+		if i > 0 && opts.SafeZ != nil {
+			g.GotoZ(Z(*opts.SafeZ))
+		}
+
+		switch opts.Mode {
+		case RepeatG52:
+			m := g.effectivePlacement(placement)
+			t, a := m.translationRotationZ()
+			if math.Abs(a) >= epsilon {
+				log.Fatalf("Repeat: G52 placement #%v must not rotate: %v", i, placement)
+			}
+			g.sendOpCode(fmt.Sprintf("G52 X%.8f Y%.8f Z%.8f", t.X(), t.Y(), t.Z()))
+			g.replay(sub, &m)
+			g.sendOpCode("G52 X0 Y0 Z0")
+		case RepeatG10L2:
+			m := g.effectivePlacement(placement)
+			t, a := m.translationRotationZ()
+			t = t.Add(opts.Origin).Add(g.wcsOffsets[g.wcs])
+			p := opts.WorkOffset
+			if p == 0 {
+				p = 2
+			}
+			if p < 1 || p >= len(workOffsetCodes) {
+				log.Fatalf("Repeat: invalid WorkOffset %v", p)
+			}
+			code := fmt.Sprintf("G10 L2 P%v X%.8f Y%.8f Z%.8f", p, t.X(), t.Y(), t.Z())
+			if math.Abs(a) >= epsilon {
+				// Only LinuxCNC rotates work offsets with the R word.
+				if g.dialect != dialectLinuxCNC {
+					log.Fatalf("Repeat: G10 L2 placement #%v can only rotate with UseLinuxCNC: %v", i, placement)
+				}
+				code += fmt.Sprintf(" R%.8f", ToDeg(a))
+			}
+			g.sendOpCode(code)
+			g.wcsOffsets[p] = vec(t)
+			g.sendOpCode(workOffsetCodes[p])
+			g.replay(sub, &m)
+			g.sendOpCode(workOffsetCodes[g.wcs])
+		default:
+			g.PushTransform(placement)
+			g.replay(sub, nil)
+			g.PopTransform()
+		}
+	}
+
+	return g
+}
+
+// effectivePlacement combines the current transform with placement.
+func (g *GCode) effectivePlacement(placement M4) M4 {
+	if g.xform == nil {
+		return placement
+	}
+	return g.xform.Mult(placement)
+}
+
+// translationRotationZ splits m into a translation followed by a rotation
+// (in radians) about the Z axis. It is a fatal error if m can not be
+// represented this way.
+func (m M4) translationRotationZ() (Tuple, float64) {
+	a := math.Atan2(m[1][0], m[0][0])
+	t := XYZ(m[0][3], m[1][3], m[2][3])
+	r := RotationZ(a)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(r[i][j]-m[i][j]) >= epsilon {
+				log.Fatalf("placement must be a translation and rotation about Z: %v", m)
+			}
+		}
+	}
+	return t, a
+}
+
+// replay emits the steps of the sub-program sub.
+// If offset is nil, moves and arcs are re-emitted through the current
+// transform. Otherwise, the steps are emitted unchanged and offset is
+// used to keep track of the resulting position.
+func (g *GCode) replay(sub *GCode, offset *M4) {
+	var inv M4
+	if offset != nil {
+		inv = offset.Inverse()
+	}
+	// subPos returns the current position in sub-program coordinates.
+	subPos := func() Tuple {
+		if offset == nil {
+			return g.Position()
+		}
+		p := inv.MultTuple(g.lastPos())
+		p[3] = 1
+		return p
+	}
+
+	for _, step := range sub.steps {
+		if step.plane != "" {
+			g.activePlane = step.plane
+		}
+		m := step.motion
+		if m == nil {
+			g.steps = append(g.steps, &Step{s: step.s, pos: g.lastPos(), plane: step.plane})
+			continue
+		}
+
+		start := subPos()
+		end, extra := start, g.extra
+		for i := 0; i < len(axisNames); i++ {
+			switch {
+			case m.axes&(1<<i) == 0:
+			case i < 3:
+				end[i] = step.pos[i]
+			default:
+				extra[i-3] = m.extra[i-3]
+			}
+		}
+
+		switch {
+		case offset != nil:
+			pos := offset.MultTuple(end)
+			pos[3] = 1
+			g.steps = append(g.steps, &Step{s: step.s, pos: pos})
+			g.extra = extra
+			g.hasMoved = true
+		case m.sym:
+			log.Fatalf("Repeat: symbolic step %q can not be transformed; use RepeatG52 or RepeatG10L2", step.s)
+		case m.arc:
+			g.emitArc(m.opCode, start, end, m.center, &TurnsOption{Turns: m.turns})
+		default:
+			n := len(g.steps)
+			g.moveOrGoAxes(m.opCode, end, extra, m.axes)
+			if m.words != "" && len(g.steps) > n {
+				g.appendWords(m.words)
+			}
+		}
+	}
+}
+
+// GridPlacements returns the placements for a rectangular grid of
+// nx by ny copies spaced dx and dy apart.
+func GridPlacements(nx, ny int, dx, dy float64) []M4 {
+	var result []M4
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			result = append(result, Translation(float64(i)*dx, float64(j)*dy, 0))
+		}
+	}
+	return result
+}
+
+// PolarPlacements returns the placements for n copies rotated about
+// center, starting at startAngle and separated by stepAngle (in radians).
+func PolarPlacements(n int, center Tuple, startAngle, stepAngle float64) []M4 {
+	var result []M4
+	for i := 0; i < n; i++ {
+		a := startAngle + float64(i)*stepAngle
+		m := Translation(-center.X(), -center.Y(), 0).
+			RotateZ(a).
+			Translate(center.X(), center.Y(), 0)
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package gcode
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func hookSub() *GCode {
+	sub := New(NoHeader)
+	sub.GotoXY(XY(1, 0))
+	sub.MoveZ(Z(-1))
+	sub.ArcCW(XYZ(0, -1, -1), 1, nil)
+	sub.MoveXY(XY(0, 0))
+	return sub
+}
+
+func TestRepeat_Grid(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.Repeat(hookSub(), GridPlacements(2, 1, 10, 0), &RepeatOptions{SafeZ: Float(5)})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z5.00000000
+G0 X1.00000000
+G1 Z-1.00000000
+G2 X0.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 Y0.00000000
+G0 Z5.00000000
+G0 X11.00000000
+G1 Z-1.00000000
+G2 X10.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 Y0.00000000
+`
+
+	if got != want {
+		t.Errorf("Repeat =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestRepeat_G52(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.Repeat(hookSub(), []M4{Translation(0, 20, 0), Translation(10, 20, 0)}, &RepeatOptions{Mode: RepeatG52, SafeZ: Float(5)})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z5.00000000
+G52 X0.00000000 Y20.00000000 Z0.00000000
+G0 X1.00000000 Y0.00000000
+G1 Z-1.00000000
+G2 X0.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 Y0.00000000
+G52 X0 Y0 Z0
+G0 Z5.00000000
+G52 X10.00000000 Y20.00000000 Z0.00000000
+G0 X1.00000000 Y0.00000000
+G1 Z-1.00000000
+G2 X0.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 Y0.00000000
+G52 X0 Y0 Z0
+`
+
+	if got != want {
+		t.Errorf("Repeat =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(10, 20, -1); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestPolarPlacements(t *testing.T) {
+	ps := PolarPlacements(4, XY(10, 10), 0, ToRad(90))
+	want := []Tuple{XY(20, 10), XY(10, 20), XY(0, 10), XY(10, 0)}
+	for i, p := range ps {
+		if got := p.Transform(XY(20, 10))[0]; !got.Equal(want[i]) {
+			t.Errorf("placement #%v = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestRepeat_G10L2Rotated(t *testing.T) {
+	g := New(NoHeader, UseLinuxCNC)
+	g.Repeat(hookSub(), []M4{Translation(10, 0, 0).Mult(RotationZ(math.Pi / 2))}, &RepeatOptions{Mode: RepeatG10L2})
+
+	got := g.String()
+	want := "G10 L2 P2 X10.00000000 Y0.00000000 Z0.00000000 R90.00000000\nG55\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("Repeat =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -1,7 +1,7 @@
 package gcode
 
 func (g *GCode) sendOpCode(opCode string) *GCode {
-	pos := g.Position()
+	pos := g.lastPos()
 	g.steps = append(g.steps, &Step{s: opCode, pos: pos})
 	return g
 }
@@ -0,0 +1,362 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	firstLabel    = 1000   // first O-word or N label used for control flow.
+	maxIterations = 100000 // guards against simulating endless loops.
+	maxLocalParam = 30     // #1-#30 are local to each sub-program call.
+)
+
+// g65Letters maps G65 argument addresses to the local parameters #1-#9.
+var g65Letters = []string{"A", "B", "C", "I", "J", "K", "D", "E", "F"}
+
+// Sub represents a sub-program defined by DefineSub.
+type Sub struct {
+	num   int
+	fn    func(g *GCode)
+	lines []string
+}
+
+// DefineSub defines a sub-program with the given program number
+// whose body is generated by fn.
+//
+// For dialects with sub-programs (see UseLinuxCNC and UseFanuc),
+// fn is called once to record the definition, with local parameters
+// such as Param(1) rendered symbolically. Otherwise, fn is called at
+// each CallSub to flatten the sub-program into the calling program.
+// Since the position at the start of a recorded sub-program is unknown,
+// each axis is mentioned the first time it is moved.
+func (g *GCode) DefineSub(num int, fn func(g *GCode)) *Sub {
+	sub := &Sub{num: num, fn: fn}
+	if g.dialect != dialectNone {
+		d := &GCode{
+			commentFmt: g.commentFmt,
+			dialect:    g.dialect,
+			params:     map[string]float64{},
+			labels:     g.labels,
+			decls:      g.decls,
+			defining:   true,
+			unknown:    forceAll,
+			modalState: g.modalState,
+		}
+		fn(d)
+		for _, step := range d.steps {
+			sub.lines = append(sub.lines, step.s)
+		}
+	}
+	g.subs = append(g.subs, sub)
+	return sub
+}
+
+// subDefinitions returns the G-Code lines defining all sub-programs.
+func (g *GCode) subDefinitions() []string {
+	var lines []string
+	for _, sub := range g.subs {
+		switch g.dialect {
+		case dialectLinuxCNC:
+			lines = append(lines, fmt.Sprintf("o%v sub", sub.num))
+			lines = append(lines, sub.lines...)
+			lines = append(lines, fmt.Sprintf("o%v endsub", sub.num))
+		case dialectFanuc:
+			lines = append(lines, fmt.Sprintf("O%v", sub.num))
+			lines = append(lines, sub.lines...)
+			lines = append(lines, "M99")
+		}
+	}
+	return lines
+}
+
+// CallSub calls the sub-program repeat times with the provided arguments,
+// which are available to the sub-program as Param(1), Param(2), etc.
+//
+// LinuxCNC uses "O100 call", Fanuc uses "M98 P100 L5" or, when arguments
+// are provided, "G65 P100 L5 A.. B..". The sub-program is flattened into
+// the calling program for dialects without sub-programs and while a
+// transform is in effect (see PushTransform).
+// In all cases, Position reports the position after the call.
+func (g *GCode) CallSub(sub *Sub, repeat int, args ...Expr) *GCode {
+	if repeat < 1 {
+		repeat = 1
+	}
+	if len(args) > maxLocalParam {
+		log.Fatalf("CallSub: too many arguments (%v)", len(args))
+	}
+
+	if g.evaluating() || g.xform != nil {
+		g.flatten++
+		for i := 0; i < repeat; i++ {
+			saved := g.enterSub(args)
+			sub.fn(g)
+			g.leaveSub(saved)
+		}
+		g.flatten--
+		return g
+	}
+
+	sim := g.simulator()
+
+	switch g.dialect {
+	case dialectLinuxCNC:
+		var parts []string
+		for _, arg := range args {
+			parts = append(parts, fmt.Sprintf(" [%v]", arg))
+		}
+		call := fmt.Sprintf("o%v call%v", sub.num, strings.Join(parts, ""))
+		if repeat > 1 {
+			label := g.nextLabel()
+			g.sendOpCode(fmt.Sprintf("o%v repeat [%v]", label, repeat))
+			g.sendOpCode(call)
+			g.sendOpCode(fmt.Sprintf("o%v endrepeat", label))
+		} else {
+			g.sendOpCode(call)
+		}
+	case dialectFanuc:
+		s := fmt.Sprintf("M98 P%v", sub.num)
+		if len(args) > 0 {
+			if len(args) > len(g65Letters) {
+				log.Fatalf("CallSub: G65 supports at most %v arguments", len(g65Letters))
+			}
+			s = fmt.Sprintf("G65 P%v", sub.num)
+		}
+		if repeat > 1 {
+			s += fmt.Sprintf(" L%v", repeat)
+		}
+		for i, arg := range args {
+			s += fmt.Sprintf(" %v%v", g65Letters[i], arg)
+		}
+		g.sendOpCode(s)
+	}
+
+	if sim != nil {
+		for i := 0; i < repeat; i++ {
+			saved := sim.enterSub(args)
+			sub.fn(sim)
+			sim.leaveSub(saved)
+		}
+		g.endBlock(sim)
+	}
+	return g
+}
+
+// Param returns local parameter #n, such as an argument of CallSub.
+func (g *GCode) Param(n int) Expr {
+	return g.Var(fmt.Sprintf("#%v", n))
+}
+
+// Var returns the parameter with the given name (such as "#100" or a
+// name passed to Declare). It is rendered as its value when control flow
+// is being flattened.
+func (g *GCode) Var(name string) Expr {
+	if g.dialect == dialectNone {
+		return Num(g.params[name])
+	}
+	param := g.paramName(name)
+	v := g.params[param]
+	if g.evaluating() {
+		return Num(v)
+	}
+	return Expr{s: param, v: v, sym: true, decls: g.decls}
+}
+
+// SetParam assigns the expression e to local parameter #n.
+func (g *GCode) SetParam(n int, e Expr) *GCode {
+	return g.SetVar(fmt.Sprintf("#%v", n), e)
+}
+
+// SetVar assigns the expression e to the named parameter (such as "#100"
+// or a name passed to Declare).
+// Nothing is emitted while control flow is being flattened.
+func (g *GCode) SetVar(name string, e Expr) *GCode {
+	if g.dialect == dialectNone {
+		g.params[name] = e.v
+		return g
+	}
+	param := g.paramName(name)
+	g.params[param] = e.v
+	if !g.evaluating() {
+		g.sendOpCode(fmt.Sprintf("%v = %v", param, e))
+	}
+	return g
+}
+
+// While repeats body as long as cond is true.
+// Both cond and body are passed the builder to which they should
+// be applied, which is not necessarily g.
+func (g *GCode) While(cond func(g *GCode) Cond, body func(g *GCode)) *GCode {
+	if g.evaluating() {
+		for i := 0; cond(g).Value(); i++ {
+			if i >= maxIterations {
+				log.Fatalf("While: loop did not terminate after %v iterations", maxIterations)
+			}
+			body(g)
+		}
+		return g
+	}
+
+	sim := g.simulator()
+	label := g.nextLabel()
+
+	g.whileDepth++
+	switch g.dialect {
+	case dialectLinuxCNC:
+		g.sendOpCode(fmt.Sprintf("o%v while %v", label, cond(g)))
+		g.forgetPosition()
+		body(g)
+		g.sendOpCode(fmt.Sprintf("o%v endwhile", label))
+	case dialectFanuc:
+		if g.whileDepth > 3 {
+			log.Fatal("While: Fanuc supports at most 3 nested loops")
+		}
+		g.sendOpCode(fmt.Sprintf("WHILE %v DO%v", cond(g), g.whileDepth))
+		g.forgetPosition()
+		body(g)
+		g.sendOpCode(fmt.Sprintf("END%v", g.whileDepth))
+	}
+	g.whileDepth--
+	g.forgetPosition()
+
+	if sim != nil {
+		sim.While(cond, body)
+		g.endBlock(sim)
+	}
+	return g
+}
+
+// If performs then if cond is true or otherwise performs els (if non-nil).
+// Both then and els are passed the builder to which they should be
+// applied, which is not necessarily g.
+func (g *GCode) If(cond Cond, then, els func(g *GCode)) *GCode {
+	if g.evaluating() {
+		if cond.Value() {
+			then(g)
+		} else if els != nil {
+			els(g)
+		}
+		return g
+	}
+
+	sim := g.simulator()
+	label := g.nextLabel()
+
+	switch g.dialect {
+	case dialectLinuxCNC:
+		g.sendOpCode(fmt.Sprintf("o%v if %v", label, cond))
+		g.forgetPosition()
+		then(g)
+		if els != nil {
+			g.sendOpCode(fmt.Sprintf("o%v else", label))
+			g.forgetPosition()
+			els(g)
+		}
+		g.sendOpCode(fmt.Sprintf("o%v endif", label))
+	case dialectFanuc:
+		g.sendOpCode(fmt.Sprintf("IF %v GOTO%v", cond.Not(), label))
+		g.forgetPosition()
+		then(g)
+		if els != nil {
+			endLabel := g.nextLabel()
+			g.sendOpCode(fmt.Sprintf("GOTO%v", endLabel))
+			g.sendOpCode(fmt.Sprintf("N%v", label))
+			g.forgetPosition()
+			els(g)
+			label = endLabel
+		}
+		g.sendOpCode(fmt.Sprintf("N%v", label))
+	}
+	g.forgetPosition()
+
+	if sim != nil {
+		sim.If(cond, then, els)
+		g.endBlock(sim)
+	}
+	return g
+}
+
+// forgetPosition marks the position at the machine as unknown, such as
+// at the start of a loop body, so that the following moves mention each
+// of their axes until it has been emitted.
+func (g *GCode) forgetPosition() {
+	g.hasMoved = false
+	g.unknown = forceAll
+}
+
+// evaluating reports whether control flow is evaluated (and flattened)
+// rather than emitted.
+func (g *GCode) evaluating() bool {
+	return g.dialect == dialectNone || g.flatten > 0
+}
+
+func (g *GCode) nextLabel() int {
+	if *g.labels == 0 {
+		*g.labels = firstLabel
+	}
+	label := *g.labels
+	*g.labels++
+	return label
+}
+
+// simulator returns a builder that evaluates control flow starting
+// from the current state of g, or nil while recording a sub-program
+// definition, where the position is unknown.
+func (g *GCode) simulator() *GCode {
+	if g.defining {
+		return nil
+	}
+	params := map[string]float64{}
+	for k, v := range g.params {
+		params[k] = v
+	}
+	return &GCode{
+		commentFmt: g.commentFmt,
+		hasMoved:   true,
+		steps:      []*Step{{pos: g.lastPos()}},
+		xform:      g.xform,
+		xformInv:   g.xformInv,
+		dialect:    g.dialect,
+		params:     params,
+		labels:     new(int),
+		decls:      g.decls,
+		flatten:    1,
+		modalState: g.modalState,
+	}
+}
+
+// endBlock updates g with the simulated state after a sub-program
+// call or control flow block.
+func (g *GCode) endBlock(sim *GCode) {
+	g.steps[len(g.steps)-1].pos = sim.lastPos()
+	g.params = sim.params
+	g.modalState = sim.modalState
+}
+
+// enterSub sets the local parameters for a sub-program call
+// and returns the saved local parameters of the caller.
+func (g *GCode) enterSub(args []Expr) map[string]float64 {
+	saved := map[string]float64{}
+	for i := 1; i <= maxLocalParam; i++ {
+		name := fmt.Sprintf("#%v", i)
+		if v, ok := g.params[name]; ok {
+			saved[name] = v
+			delete(g.params, name)
+		}
+	}
+	for i, arg := range args {
+		g.params[fmt.Sprintf("#%v", i+1)] = arg.v
+	}
+	return saved
+}
+
+// leaveSub restores the local parameters of the caller.
+func (g *GCode) leaveSub(saved map[string]float64) {
+	for i := 1; i <= maxLocalParam; i++ {
+		delete(g.params, fmt.Sprintf("#%v", i))
+	}
+	for k, v := range saved {
+		g.params[k] = v
+	}
+}
@@ -0,0 +1,150 @@
+package gcode
+
+import "testing"
+
+// peckSub defines a sub-program that pecks down to depth #1 in steps of #2.
+func peckSub(g *GCode) *Sub {
+	return g.DefineSub(100, func(g *GCode) {
+		g.SetParam(3, Num(0))
+		g.While(func(g *GCode) Cond { return g.Param(3).LT(g.Param(1)) }, func(g *GCode) {
+			g.SetParam(3, g.Param(3).Add(g.Param(2)))
+			g.If(g.Param(3).GT(g.Param(1)), func(g *GCode) { g.SetParam(3, g.Param(1)) }, nil)
+			g.MoveZ(Z(-1))
+			g.GotoZ(Z(1))
+		})
+		g.GotoXY(XY(1, 1))
+	})
+}
+
+func TestCallSub(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "LinuxCNC",
+			opts: []Option{NoHeader, UseLinuxCNC},
+			want: `o100 sub
+#3 = 0.00000000
+o1000 while [#3 LT #1]
+#3 = [#3 + #2]
+o1001 if [#3 GT #1]
+#3 = #1
+o1001 endif
+G1 Z-1.00000000
+G0 Z1.00000000
+o1000 endwhile
+G0 X1.00000000 Y1.00000000
+o100 endsub
+G0 X0.00000000 Y0.00000000 Z5.00000000
+o100 call [1.50000000] [1.00000000]
+G0 X10.00000000
+o1002 repeat [2]
+o100 call [1.00000000] [1.00000000]
+o1002 endrepeat
+`,
+		},
+		{
+			name: "Fanuc",
+			opts: []Option{NoHeader, UseFanuc},
+			want: `G0 X0.00000000 Y0.00000000 Z5.00000000
+G65 P100 A1.50000000 B1.00000000
+G0 X10.00000000
+G65 P100 L2 A1.00000000 B1.00000000
+M30
+O100
+#3 = 0.00000000
+WHILE [#3 LT #1] DO1
+#3 = [#3 + #2]
+IF [#3 LE #1] GOTO1001
+#3 = #1
+N1001
+G1 Z-1.00000000
+G0 Z1.00000000
+END1
+G0 X1.00000000 Y1.00000000
+M99
+`,
+		},
+		{
+			name: "flattened",
+			opts: []Option{NoHeader},
+			want: `G0 X0.00000000 Y0.00000000 Z5.00000000
+G1 Z-1.00000000
+G0 Z1.00000000
+G1 Z-1.00000000
+G0 Z1.00000000
+G0 X1.00000000 Y1.00000000
+G0 X10.00000000
+G1 Z-1.00000000
+G0 Z1.00000000
+G0 X1.00000000
+G1 Z-1.00000000
+G0 Z1.00000000
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(tt.opts...)
+			peck := peckSub(g)
+			g.GotoXYZ(XYZ(0, 0, 5))
+			g.CallSub(peck, 1, Num(1.5), Num(1))
+			g.GotoX(X(10))
+			g.CallSub(peck, 2, Num(1), Num(1))
+
+			if got := g.String(); got != tt.want {
+				t.Errorf("CallSub =\n%v\nwant:\n%v", got, tt.want)
+			}
+			if got, want := g.Position(), XYZ(1, 1, 1); !got.Equal(want) {
+				t.Errorf("Position = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDefineSub_UnknownPosition(t *testing.T) {
+	// The position at the start of the sub-program and of the loop body
+	// is unknown, so each axis is mentioned the first time it is moved.
+	g := New(NoHeader, UseLinuxCNC)
+	sub := g.DefineSub(100, func(g *GCode) {
+		g.MoveZ(Z(-1))
+		g.MoveXY(XY(5, 0))
+		g.MoveXY(XY(5, 5))
+		g.GotoZ(Z(0))
+	})
+	g.GotoXYZ(XYZ(0, 7, 5))
+	g.SetVar("#100", Num(0))
+	g.While(func(g *GCode) Cond { return g.Var("#100").LT(Num(2)) }, func(g *GCode) {
+		g.SetVar("#100", g.Var("#100").Add(Num(1)))
+		g.MoveZ(Z(-1))
+		g.MoveXY(XY(0, 7))
+		g.GotoZ(Z(5))
+	})
+	g.CallSub(sub, 1)
+
+	want := `o100 sub
+G1 Z-1.00000000
+G1 X5.00000000 Y0.00000000
+G1 Y5.00000000
+G0 Z0.00000000
+o100 endsub
+G0 X0.00000000 Y7.00000000 Z5.00000000
+#100 = 0.00000000
+o1000 while [#100 LT 2.00000000]
+#100 = [#100 + 1.00000000]
+G1 Z-1.00000000
+G1 X0.00000000 Y7.00000000
+G0 Z5.00000000
+o1000 endwhile
+o100 call
+`
+	if got := g.String(); got != want {
+		t.Errorf("DefineSub =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(5, 5, 0); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
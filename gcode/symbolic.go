@@ -0,0 +1,307 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// Symbolic values are NaNs whose payload identifies the declarations of
+// their design and indexes into its expressions, so that they can be
+// passed anywhere a float64 coordinate is expected.
+const (
+	symMask  = 0xffff000000000000
+	symTag   = 0x7ffc000000000000
+	symTable = 0x0000ffff00000000 // identifies the declTable.
+	symIndex = 0x00000000ffffffff // indexes into its expressions.
+)
+
+// declTableIDs numbers the declaration tables so that the placeholders
+// of one design are not mistaken for those of another.
+var declTableIDs atomic.Uint32
+
+// Sym returns a float64 placeholder for the expression that may be used
+// anywhere a coordinate, radius, or feedrate is expected (for example,
+// MoveZ(Z(depth.Sym()))) of the design that declared its parameters.
+// The expression is then rendered in the G-Code and its value is used
+// to track the position.
+//
+// Arithmetic on placeholders is not meaningful, and the Expr methods must
+// be used instead (for example, Z(depth.Sub(Num(1)).Sym())). Tuple
+// arithmetic on them is a fatal error, but float64 arithmetic can not be
+// detected: depth.Sym()-1 is the same placeholder, so the -1 is silently
+// lost.
+func (e Expr) Sym() float64 {
+	if !e.sym {
+		return e.v
+	}
+	t := e.decls
+	if t == nil {
+		log.Fatalf("Sym: expression %v does not belong to a design", e)
+	}
+	id, ok := t.index[e.s]
+	if !ok {
+		id = len(t.exprs)
+		t.exprs = append(t.exprs, e)
+		t.index[e.s] = id
+	}
+	return math.Float64frombits(symTag | uint64(t.id)<<32 | uint64(id))
+}
+
+// isPlaceholder reports whether v is a placeholder returned by Sym.
+func isPlaceholder(v float64) bool {
+	return math.Float64bits(v)&symMask == symTag
+}
+
+// checkNumeric exits if any of the tuples holds a placeholder returned by
+// Sym, since arithmetic on it would silently produce wrong G-Code.
+func checkNumeric(op string, ts ...Tuple) {
+	for _, t := range ts {
+		for _, v := range t {
+			if v != v && isPlaceholder(v) {
+				log.Fatalf("%v: Tuple arithmetic on a symbolic value; use the Expr methods instead", op)
+			}
+		}
+	}
+}
+
+// symExpr returns the expression for a placeholder returned by Sym.
+func (g *GCode) symExpr(v float64) (Expr, bool) {
+	bits := math.Float64bits(v)
+	if bits&symMask != symTag {
+		return Expr{}, false
+	}
+	t := g.decls
+	id := int(bits & symIndex)
+	if uint16((bits&symTable)>>32) != t.id || id >= len(t.exprs) {
+		log.Fatal("symbolic value used in a design that did not declare it")
+	}
+	return t.exprs[id], true
+}
+
+// exprOf returns v as an expression.
+func (g *GCode) exprOf(v float64) Expr {
+	if e, ok := g.symExpr(v); ok {
+		return e
+	}
+	return Num(v)
+}
+
+// fmtSym formats v using format, or as its expression if v is symbolic.
+func (g *GCode) fmtSym(format string, v float64) string {
+	if e, ok := g.symExpr(v); ok {
+		return e.s
+	}
+	return fmt.Sprintf(format, v)
+}
+
+// isSym reports whether any of the values are symbolic.
+func (g *GCode) isSym(vs ...float64) bool {
+	for _, v := range vs {
+		if _, ok := g.symExpr(v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSym replaces the symbolic values in p with their values.
+func (g *GCode) resolveSym(p Tuple) Tuple {
+	for i, v := range p {
+		if e, ok := g.symExpr(v); ok {
+			p[i] = e.v
+		}
+	}
+	return p
+}
+
+// addSym returns a + b, which may be symbolic.
+func (g *GCode) addSym(a, b float64) float64 {
+	if !g.isSym(a, b) {
+		return a + b
+	}
+	return g.exprOf(a).Add(g.exprOf(b)).Sym()
+}
+
+// symMultTuple multiplies the matrix m by a tuple that may be symbolic.
+func (g *GCode) symMultTuple(m M4, p Tuple) Tuple {
+	var result Tuple
+	for i := 0; i < 3; i++ {
+		c := m[i][3]
+		var e *Expr
+		for j := 0; j < 3; j++ {
+			if m[i][j] == 0 {
+				continue
+			}
+			sym, ok := g.symExpr(p[j])
+			if !ok {
+				c += m[i][j] * p[j]
+				continue
+			}
+			if m[i][j] != 1 {
+				sym = Num(m[i][j]).Mul(sym)
+			}
+			if e == nil {
+				e = &sym
+			} else {
+				v := e.Add(sym)
+				e = &v
+			}
+		}
+		switch {
+		case e == nil:
+			result[i] = c
+		case c == 0:
+			result[i] = e.Sym()
+		default:
+			result[i] = e.Add(Num(c)).Sym()
+		}
+	}
+	result[3] = 1
+	return result
+}
+
+// declTable holds the declared variables of a design
+// and is shared with its sub-programs.
+type declTable struct {
+	names    map[string]string // variable name to G-Code parameter.
+	declared map[string]bool   // G-Code parameters already declared.
+	lines    []string
+	next     int // next Fanuc common variable.
+
+	id    uint16         // identifies the placeholders of the design.
+	exprs []Expr         // expressions of the placeholders.
+	index map[string]int // placeholder index of each expression.
+}
+
+func newDeclTable() *declTable {
+	return &declTable{
+		names:    map[string]string{},
+		declared: map[string]bool{},
+		id:       uint16(declTableIDs.Add(1)),
+		index:    map[string]int{},
+	}
+}
+
+const firstFanucVar = 100 // first common variable used for Fanuc declarations.
+
+// Declare declares a named variable with the provided default value,
+// which is emitted in a declaration block following the prologue so that
+// it may be adjusted at the machine without regenerating the G-Code.
+// The default is used to simulate the program (for example, to track
+// Position).
+//
+// LinuxCNC uses named parameters (#<depth>), Fanuc uses common variables
+// starting at #100, and names starting with "#" are used as-is. For
+// dialects without parameters the default value is used directly.
+func (g *GCode) Declare(name string, value float64) Expr {
+	if g.dialect == dialectNone {
+		g.params[name] = value
+		return Num(value)
+	}
+	param := g.paramName(name)
+	if !g.decls.declared[param] {
+		g.decls.declared[param] = true
+		line := fmt.Sprintf("%v = %.8f", param, value)
+		if param != name && !strings.HasPrefix(param, "#<") {
+			line += " " + fmt.Sprintf(g.commentFmt, name)
+		}
+		g.decls.lines = append(g.decls.lines, line)
+	}
+	g.params[param] = value
+	return Expr{s: param, v: value, sym: true, decls: g.decls}
+}
+
+// paramName returns the G-Code parameter for a variable name.
+func (g *GCode) paramName(name string) string {
+	if strings.HasPrefix(name, "#") {
+		return name
+	}
+	if param, ok := g.decls.names[name]; ok {
+		return param
+	}
+	if g.dialect == dialectFanuc {
+		if g.decls.next == 0 {
+			g.decls.next = firstFanucVar
+		}
+		param := fmt.Sprintf("#%v", g.decls.next)
+		g.decls.next++
+		g.decls.names[name] = param
+		return param
+	}
+	return fmt.Sprintf("#<%v>", name)
+}
+
+// declarations returns the G-Code lines of the declaration block.
+func (g *GCode) declarations() []string {
+	if len(g.decls.lines) == 0 {
+		return nil
+	}
+	lines := []string{fmt.Sprintf(g.commentFmt, "-- declarations begin --")}
+	lines = append(lines, g.decls.lines...)
+	return append(lines, fmt.Sprintf(g.commentFmt, "-- declarations end --"))
+}
+
+// symArc emits an arc with a symbolic endpoint or radius.
+// Since the center can not be computed, the arc uses the R word.
+func (g *GCode) symArc(endP Tuple, radius float64, relative bool, opCode string, opts *TurnsOption) {
+	if g.xform != nil || g.feedMode == FeedInverseTime {
+		log.Fatalf("symbolic arc can not be transformed or use inverse time")
+	}
+	pos := g.Position()
+	end := endP
+	if relative {
+		for i := 0; i < 3; i++ {
+			end[i] = g.addSym(pos[i], endP[i])
+		}
+	}
+	s := g.symArcWords(opCode, pos, end) + " R" + g.fmtSym("%.8f", radius)
+	g.emitSymArc(s, opCode, end, Tuple{}, opts)
+}
+
+// symCircle emits a circle with a symbolic relative center point.
+func (g *GCode) symCircle(centerPoint Tuple, relative bool, opCode string, opts *TurnsOption) {
+	if !relative || g.xform != nil || g.feedMode == FeedInverseTime {
+		log.Fatalf("symbolic circle center must be relative, untransformed, and not use inverse time")
+	}
+	pos := g.Position()
+	u, v, w := planeAxes(g.activePlane)
+	end := pos
+	end[w] = centerPoint[w]
+
+	s := g.symArcWords(opCode, pos, end)
+	s += fmt.Sprintf(" %c%v %c%v", "IJK"[u], g.fmtSym("%.8f", centerPoint[u]), "IJK"[v], g.fmtSym("%.8f", centerPoint[v]))
+	center := pos
+	center[u] += g.resolveSym(centerPoint)[u]
+	center[v] += g.resolveSym(centerPoint)[v]
+	g.emitSymArc(s, opCode, end, center, opts)
+}
+
+// symArcWords returns the opCode and the end point words of a symbolic
+// arc from pos to end: both axes of the active plane, and the helical
+// axis if it is symbolic or moves.
+func (g *GCode) symArcWords(opCode string, pos, end Tuple) string {
+	u, v, _ := planeAxes(g.activePlane)
+	s := opCode
+	for i := 0; i < 3; i++ {
+		if i == u || i == v || g.isSym(end[i]) || math.Abs(end[i]-pos[i]) >= epsilon {
+			s += fmt.Sprintf(" %c%v", "XYZ"[i], g.fmtSym("%.8f", end[i]))
+		}
+	}
+	return s
+}
+
+// emitSymArc emits the symbolic arc s ending at end. The center is only
+// known for circles, so symbolic arcs can not be transformed or leveled.
+func (g *GCode) emitSymArc(s, opCode string, end, center Tuple, opts *TurnsOption) {
+	if opts != nil && opts.Turns > 0 {
+		s += fmt.Sprintf(" P%v", opts.Turns)
+	}
+	m := &motion{opCode: opCode, axes: forceXYZ, arc: true, center: center, turns: opts.turns(), extra: g.extra, sym: true}
+	g.laserSwitch(opCode)
+	end = g.resolveSym(end)
+	end[3] = 1
+	g.steps = append(g.steps, &Step{s: s, pos: end, motion: m})
+}
@@ -0,0 +1,124 @@
+package gcode
+
+import "testing"
+
+func TestDeclare(t *testing.T) {
+	g := New(NoHeader, UseLinuxCNC)
+	depth := g.Declare("depth", -1.5)
+	feed := g.Declare("feed", 300)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.Feedrate(feed.Sym())
+	g.MoveZ(Z(depth.Sym()))
+	g.MoveX(X(10))
+	g.ArcCW(XYZ(20, 0, depth.Sym()), depth.Mul(Num(-4)).Sym(), nil)
+	g.CircleCWRel(XYZ(-5, 0, depth.Sym()), nil)
+	g.PushTransform(Translation(0, 0, 1))
+	g.MoveZ(Z(depth.Sym()))
+	g.PopTransform()
+
+	got := g.String()
+	want := `(-- declarations begin --)
+#<depth> = -1.50000000
+#<feed> = 300.00000000
+(-- declarations end --)
+G0 X0.00000000 Y0.00000000 Z5.00000000
+F#<feed>
+G1 Z#<depth>
+G1 X10.00000000
+G2 X20.00000000 Y0.00000000 Z#<depth> R[#<depth> * -4.00000000]
+G2 X20.00000000 Y0.00000000 Z#<depth> I-5.00000000 J0.00000000
+G1 Z[#<depth> + 1.00000000]
+`
+
+	if got != want {
+		t.Errorf("Declare =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(20, 0, -0.5); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestDeclare_Offset(t *testing.T) {
+	// An offset from a placeholder is an Expr, not depth.Sym()-1.
+	g := New(NoHeader, UseLinuxCNC)
+	depth := g.Declare("depth", -1.5)
+	g.MoveZ(Z(depth.Sub(Num(1)).Sym()))
+	g.MoveXYZ(XYZ(1, 2, depth.Mul(Num(2)).Sym()))
+
+	got := g.String()
+	want := `(-- declarations begin --)
+#<depth> = -1.50000000
+(-- declarations end --)
+G1 Z[#<depth> - 1.00000000]
+G1 X1.00000000 Y2.00000000 Z[#<depth> * 2.00000000]
+`
+	if got != want {
+		t.Errorf("Declare =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.Position(), XYZ(1, 2, -3); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestDeclare_Fanuc(t *testing.T) {
+	g := New(NoHeader, UseFanuc)
+	depth := g.Declare("depth", -1.5)
+	g.MoveZ(Z(depth.Sym()))
+
+	got := g.String()
+	want := `(-- declarations begin --)
+#100 = -1.50000000 (depth)
+(-- declarations end --)
+G1 Z#100
+`
+
+	if got != want {
+		t.Errorf("Declare =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestDeclare_ArcPlanes(t *testing.T) {
+	g := New(NoHeader, UseLinuxCNC)
+	g.LaserMode(nil)
+	depth := g.Declare("depth", -1)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.Plane(PlaneXZ)
+	g.ArcCW(XYZ(10, 0, depth.Sym()), 6, nil)
+	g.CircleCWRel(XYZ(-5, depth.Sym(), 0), nil)
+
+	got := g.String()
+	want := `(-- declarations begin --)
+#<depth> = -1.00000000
+(-- declarations end --)
+G0 X0.00000000 Y0.00000000 Z5.00000000
+G18
+M3 S1000
+G2 X10.00000000 Z#<depth> R6.00000000
+G2 X10.00000000 Y#<depth> Z-1.00000000 I-5.00000000 K0.00000000
+`
+	if got != want {
+		t.Errorf("Declare =\n%v\nwant:\n%v", got, want)
+	}
+	for _, step := range g.steps[len(g.steps)-2:] {
+		if m := step.motion; m == nil || !m.arc || !m.sym {
+			t.Errorf("step %q motion = %+v, want a symbolic arc", step.s, m)
+		}
+	}
+}
+
+func TestDeclare_SymIsPerDesign(t *testing.T) {
+	g1, g2 := New(NoHeader, UseLinuxCNC), New(NoHeader, UseLinuxCNC)
+	d1, d2 := g1.Declare("depth", -1), g2.Declare("depth", -2)
+	for i := 0; i < 10; i++ {
+		g1.MoveZ(Z(d1.Sym()))
+	}
+	if n := len(g1.decls.exprs); n != 1 {
+		t.Errorf("g1 has %v placeholder expressions, want 1", n)
+	}
+	if n := len(g2.decls.exprs); n != 0 {
+		t.Errorf("g2 has %v placeholder expressions, want 0", n)
+	}
+	if e, ok := g2.symExpr(d2.Sym()); !ok || e.Value() != -2 {
+		t.Errorf("g2 placeholder = %v, %v, want its own depth", e, ok)
+	}
+}
@@ -0,0 +1,227 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// linearizeMaxAngle is the maximum angle (in radians) of each line segment
+// used when an arc can not be represented after transformation.
+var linearizeMaxAngle = ToRad(1)
+
+// Transform applies the transform m to all subsequent Goto*, Move*, Arc*
+// and Circle* calls, in addition to any transform already in effect.
+// The transform m is applied first, in the current coordinate system.
+//
+// Arcs are transformed by moving their centers and reversing their
+// direction when the transform mirrors the active plane. When the
+// transform does not map an arc onto an arc (for example, when scaling
+// the active plane non-uniformly), the arc is converted to line segments.
+func (g *GCode) Transform(m M4) *GCode {
+	cur := M4Identity()
+	if g.xform != nil {
+		cur = *g.xform
+	}
+	g.setTransform(cur.Mult(m))
+	return g
+}
+
+// PushTransform saves the current transform and then applies m
+// as with Transform. The saved transform is restored with PopTransform.
+func (g *GCode) PushTransform(m M4) *GCode {
+	g.xforms = append(g.xforms, g.xform)
+	return g.Transform(m)
+}
+
+// PopTransform restores the transform saved by the matching PushTransform.
+func (g *GCode) PopTransform() *GCode {
+	if len(g.xforms) == 0 {
+		log.Fatal("PopTransform called without matching PushTransform")
+	}
+	last := len(g.xforms) - 1
+	g.xform = g.xforms[last]
+	g.xforms = g.xforms[:last]
+	if g.xform != nil {
+		g.xformInv = g.xform.Inverse()
+	}
+	return g
+}
+
+func (g *GCode) setTransform(m M4) {
+	if m == M4Identity() {
+		g.xform = nil
+		return
+	}
+	if !m.Invertible() {
+		log.Fatalf("transform is not invertible: %v", m)
+	}
+	g.xform = &m
+	g.xformInv = m.Inverse()
+}
+
+// forceAxes returns the emitted axes that are affected by
+// the forced axes of an untransformed move.
+// The extra axes are not transformed.
+func (m M4) forceAxes(force int) int {
+	result := force &^ forceXYZ
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if force&(1<<j) != 0 && m[i][j] != 0 {
+				result |= 1 << i
+			}
+		}
+	}
+	return result
+}
+
+// planeAxes returns the indices of the two in-plane axes and the
+// out-of-plane axis for the given plane.
+func planeAxes(plane PlaneT) (u, v, w int) {
+	switch plane {
+	case PlaneXZ:
+		return 0, 2, 1
+	case PlaneYZ:
+		return 1, 2, 0
+	default: // XY
+		return 0, 1, 2
+	}
+}
+
+// planeSimilarity reports whether m maps arcs in the plane of axes u, v
+// (with helical axis w) onto arcs in the same plane, and if so, whether
+// the arc direction is reversed.
+func (m M4) planeSimilarity(u, v, w int) (ok, mirrored bool) {
+	if math.Abs(m[u][w]) >= epsilon || math.Abs(m[v][w]) >= epsilon ||
+		math.Abs(m[w][u]) >= epsilon || math.Abs(m[w][v]) >= epsilon {
+		return false, false
+	}
+	a, b, c, d := m[u][u], m[u][v], m[v][u], m[v][v]
+	l1, l2 := a*a+c*c, b*b+d*d
+	if math.Abs(a*b+c*d) >= epsilon*l1 || math.Abs(l1-l2) >= epsilon*l1 {
+		return false, false
+	}
+	return true, a*d-b*c < 0
+}
+
+// emitArc emits an arc from start to end around center (all absolute
+// and untransformed) using the current transform.
+func (g *GCode) emitArc(opCode string, start, end, center Tuple, opts *TurnsOption) {
+	if g.xform != nil {
+		u, v, w := planeAxes(g.activePlane)
+		ok, mirrored := g.xform.planeSimilarity(u, v, w)
+		if !ok {
+			g.linearizeArc(opCode, start, end, center, opts)
+			return
+		}
+
+		if mirrored {
+			if opCode == "G2" {
+				opCode = "G3"
+			} else {
+				opCode = "G2"
+			}
+		}
+
+		ts := g.xform.Transform(start, end, center)
+		start, end, center = ts[0], ts[1], ts[2]
+	}
+	off := center.Sub(start)
+	m := &motion{opCode: opCode, axes: forceXY, arc: true, center: center, turns: opts.turns(), extra: g.extra}
+	g.laserSwitch(opCode)
+
+	s := fmt.Sprintf("%v X%.8f Y%.8f", opCode, end.X(), end.Y())
+	if math.Abs(end.Z()-start.Z()) >= epsilon {
+		s += fmt.Sprintf(" Z%.8f", end.Z())
+		m.axes |= forceZ
+	}
+
+	switch g.activePlane {
+	default: // XY
+		s += fmt.Sprintf(" I%.8f J%.8f", off.X(), off.Y())
+	case PlaneXZ:
+		s += fmt.Sprintf(" I%.8f K%.8f", off.X(), off.Z())
+	case PlaneYZ:
+		s += fmt.Sprintf(" J%.8f K%.8f", off.Y(), off.Z())
+	}
+
+	if opts != nil && opts.Turns > 0 {
+		s += fmt.Sprintf(" P%v", opts.Turns)
+	}
+
+	end[3] = 1
+	s += g.inverseTimeWord(m, g.lastPos(), end)
+	g.steps = append(g.steps, &Step{s: s, pos: end, motion: m})
+}
+
+// linearizeArc emits an arc from start to end around center (all absolute
+// and untransformed) as a series of transformed line segments.
+func (g *GCode) linearizeArc(opCode string, start, end, center Tuple, opts *TurnsOption) {
+	for _, p := range arcPoints(g.activePlane, opCode, start, end, center, opts.turns()) {
+		g.moveOrGo("G1", p, forceXYZ)
+	}
+}
+
+// arcPoints returns the points approximating an arc in the plane
+// in steps of at most linearizeMaxAngle, ending with end.
+func arcPoints(plane PlaneT, opCode string, start, end, center Tuple, turns int) []Tuple {
+	u, v, w := planeAxes(plane)
+	a0, sweep, r0, r1 := arcSweep(plane, opCode, start, end, center, turns)
+
+	n := int(math.Ceil(math.Abs(sweep) / linearizeMaxAngle))
+	if n < 1 {
+		n = 1
+	}
+	var result []Tuple
+	for i := 1; i < n; i++ {
+		t := float64(i) / float64(n)
+		a := a0 + t*sweep
+		r := r0 + t*(r1-r0)
+		p := start
+		p[u] = center[u] + r*math.Cos(a)
+		p[v] = center[v] + r*math.Sin(a)
+		p[w] = start[w] + t*(end[w]-start[w])
+		result = append(result, p)
+	}
+	return append(result, end)
+}
+
+// arcLength returns the length of an arc in the plane,
+// including its helical motion.
+func arcLength(plane PlaneT, opCode string, start, end, center Tuple, turns int) float64 {
+	_, _, w := planeAxes(plane)
+	_, sweep, r0, r1 := arcSweep(plane, opCode, start, end, center, turns)
+	return math.Hypot(math.Abs(sweep)*0.5*(r0+r1), end[w]-start[w])
+}
+
+// arcSweep returns the start angle, the (signed) sweep angle, and
+// the start and end radii of an arc in the u-v plane of the plane.
+func arcSweep(plane PlaneT, opCode string, start, end, center Tuple, turns int) (a0, sweep, r0, r1 float64) {
+	u, v, _ := planeAxes(plane)
+
+	// G2 is clockwise when looking down the positive out-of-plane axis,
+	// which is a negative angle in the u-v plane except for XZ (G18).
+	dir := 1.0
+	if opCode == "G2" {
+		dir = -1.0
+	}
+	if plane == PlaneXZ {
+		dir = -dir
+	}
+
+	a0 = math.Atan2(start[v]-center[v], start[u]-center[u])
+	a1 := math.Atan2(end[v]-center[v], end[u]-center[u])
+	r0 = math.Hypot(start[v]-center[v], start[u]-center[u])
+	r1 = math.Hypot(end[v]-center[v], end[u]-center[u])
+
+	sweep = a1 - a0
+	if dir < 0 && sweep >= 0 {
+		sweep -= 2 * math.Pi
+	} else if dir > 0 && sweep <= 0 {
+		sweep += 2 * math.Pi
+	}
+	if turns > 1 {
+		sweep += dir * 2 * math.Pi * float64(turns-1)
+	}
+	return a0, sweep, r0, r1
+}
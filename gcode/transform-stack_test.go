@@ -0,0 +1,74 @@
+package gcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPushTransform(t *testing.T) {
+	g := New(NoHeader)
+	g.PushTransform(Translation(10, 20, 0))
+	g.GotoXYZ(XYZ(0, 0, 1))
+	g.MoveX(X(5))
+	g.ArcCW(XYZ(5, -10, 1), 5, nil)
+	if got, want := g.Position(), XYZ(5, -10, 1); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+	g.PopTransform()
+	if got, want := g.Position(), XYZ(15, 10, 1); !got.Equal(want) {
+		t.Errorf("Position after PopTransform = %v, want %v", got, want)
+	}
+	g.MoveX(X(0))
+
+	got := g.String()
+	want := `G0 X10.00000000 Y20.00000000 Z1.00000000
+G1 X15.00000000
+G2 X15.00000000 Y10.00000000 I0.00000000 J-5.00000000
+G1 X0.00000000
+`
+
+	if got != want {
+		t.Errorf("PushTransform =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestTransform_Mirror(t *testing.T) {
+	g := New(NoHeader)
+	g.Transform(Scaling(-1, 1, 1))
+	g.GotoXY(XY(1, 0))
+	g.ArcCW(XY(0, -1), 1, nil)
+	g.CircleCCW(XY(0, 0), nil)
+
+	got := g.String()
+	want := `G0 X-1.00000000 Y0.00000000
+G3 X0.00000000 Y-1.00000000 I1.00000000 J0.00000000
+G2 X0.00000000 Y-1.00000000 I0.00000000 J1.00000000
+`
+
+	if got != want {
+		t.Errorf("Transform =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestTransform_NonUniformScaling(t *testing.T) {
+	g := New(NoHeader)
+	g.Transform(Scaling(2, 1, 1))
+	g.GotoXY(XY(1, 0))
+	g.ArcCCW(XY(0, 1), 1, nil)
+
+	lines := strings.Split(strings.TrimSpace(g.String()), "\n")
+	if len(lines) != 91 {
+		t.Fatalf("got %v lines, want 91", len(lines))
+	}
+	for i, line := range lines[1:] {
+		if !strings.HasPrefix(line, "G1 ") {
+			t.Errorf("line #%v = %q, want G1 move", i+2, line)
+		}
+	}
+	if got, want := lines[90], "G1 X0.00000000 Y1.00000000"; got != want {
+		t.Errorf("last line = %q, want %q", got, want)
+	}
+	if got, want := g.Position(), XY(0, 1); !got.Equal(want) {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
@@ -78,6 +78,7 @@ func (t Tuple) Equal(other Tuple) bool {
 
 // Add adds two Tuples and returns a new one.
 func (t Tuple) Add(other Tuple) Tuple {
+	checkNumeric("Add", t, other)
 	return Tuple{
 		t.X() + other.X(),
 		t.Y() + other.Y(),
@@ -99,6 +100,7 @@ func (t Tuple) Offset(points ...Tuple) []Tuple {
 
 // Sub subtracts two Tuples and returns a new one.
 func (t Tuple) Sub(other Tuple) Tuple {
+	checkNumeric("Sub", t, other)
 	return Tuple{
 		t.X() - other.X(),
 		t.Y() - other.Y(),
@@ -109,6 +111,7 @@ func (t Tuple) Sub(other Tuple) Tuple {
 
 // Negate negates a Tuple.
 func (t Tuple) Negate() Tuple {
+	checkNumeric("Negate", t)
 	return Tuple{
 		-t.X(),
 		-t.Y(),
@@ -119,6 +122,7 @@ func (t Tuple) Negate() Tuple {
 
 // MultScalar multiplies a tuple by a scalar.
 func (t Tuple) MultScalar(f float64) Tuple {
+	checkNumeric("MultScalar", t, Tuple{f})
 	return Tuple{
 		f * t.X(),
 		f * t.Y(),
@@ -134,6 +138,7 @@ func (t Tuple) DivScalar(f float64) Tuple {
 
 // Magnitude computes the magnitude or length of a vector (Tuple).
 func (t Tuple) Magnitude() float64 {
+	checkNumeric("Magnitude", t)
 	return math.Sqrt(
 		t.X()*t.X() +
 			t.Y()*t.Y() +
@@ -152,6 +157,7 @@ func (t Tuple) Normalize() Tuple {
 // This public version is to be used with XYZ vectors and can not be
 // used for full 4x4 matrix multiplies.
 func (t Tuple) Dot(other Tuple) float64 {
+	checkNumeric("Dot", t, other)
 	return t.X()*other.X() +
 		t.Y()*other.Y() +
 		t.Z()*other.Z()
@@ -161,6 +167,7 @@ func (t Tuple) Dot(other Tuple) float64 {
 // Cross computes the cross product of two vectors (order matters and this
 // implements t cross other).
 func (t Tuple) Cross(other Tuple) Tuple {
+	checkNumeric("Cross", t, other)
 	return XYZ( // this is not a ray-tracer - don't use: Vector(
 		t.Y()*other.Z()-t.Z()*other.Y(),
 		t.Z()*other.X()-t.X()*other.Z(),
@@ -0,0 +1,155 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Work coordinate systems are numbered as by the P word of G10 L2:
+// 1 is G54, 2 is G55, ..., 6 is G59, 7 is G59.1, 8 is G59.2 and 9 is G59.3.
+
+// SelectWorkOffset selects the work coordinate system n (1-9 for G54-G59.3).
+// The tool does not move, but Position reports the position in the new
+// work coordinate system.
+func (g *GCode) SelectWorkOffset(n int) *GCode {
+	checkWorkOffset(n)
+	mp := g.MachinePosition()
+	g.wcs = n
+	g.steps = append(g.steps, &Step{s: workOffsetCodes[n], pos: g.workFromMachine(mp)})
+	return g
+}
+
+// SetWorkOffset sets the origin of work coordinate system n (1-9, or 0 for
+// the active one) to the machine position origin using G10 L2.
+func (g *GCode) SetWorkOffset(n int, origin Tuple) *GCode {
+	n = g.workOffsetNum(n)
+	mp := g.MachinePosition()
+	g.wcsOffsets[n] = vec(origin)
+	s := fmt.Sprintf("G10 L2 P%v X%.8f Y%.8f Z%.8f", n, origin.X(), origin.Y(), origin.Z())
+	g.steps = append(g.steps, &Step{s: s, pos: g.workFromMachine(mp)})
+	return g
+}
+
+// SetWorkPosition sets the origin of work coordinate system n (1-9, or 0
+// for the active one) such that the current tool position becomes p
+// using G10 L20.
+func (g *GCode) SetWorkPosition(n int, p Tuple) *GCode {
+	g.setWorkPosition(n, p, forceXYZ)
+	return g
+}
+
+// setWorkPosition is like SetWorkPosition but only sets the given axes.
+func (g *GCode) setWorkPosition(n int, p Tuple, axes int) {
+	n = g.workOffsetNum(n)
+	mp := g.MachinePosition()
+	offset := mp.Sub(g.g92Offset).Sub(XYZ(p.X(), p.Y(), p.Z()))
+	parts := []string{fmt.Sprintf("G10 L20 P%v", n)}
+	for i, name := range "XYZ" {
+		if axes&(1<<i) != 0 {
+			g.wcsOffsets[n][i] = offset[i]
+			parts = append(parts, fmt.Sprintf("%c%.8f", name, p[i]))
+		}
+	}
+	g.steps = append(g.steps, &Step{s: strings.Join(parts, " "), pos: g.workFromMachine(mp)})
+}
+
+// SetPosition offsets all work coordinate systems using G92 such that
+// the current tool position becomes p.
+func (g *GCode) SetPosition(p Tuple) *GCode {
+	mp := g.MachinePosition()
+	g.g92Offset = mp.Sub(g.wcsOffsets[g.wcs]).Sub(XYZ(p.X(), p.Y(), p.Z()))
+	s := fmt.Sprintf("G92 X%.8f Y%.8f Z%.8f", p.X(), p.Y(), p.Z())
+	g.steps = append(g.steps, &Step{s: s, pos: g.workFromMachine(mp)})
+	return g
+}
+
+// CancelPositionOffset cancels the G92 offset using G92.1.
+func (g *GCode) CancelPositionOffset() *GCode {
+	mp := g.MachinePosition()
+	g.g92Offset = Tuple{}
+	g.steps = append(g.steps, &Step{s: "G92.1", pos: g.workFromMachine(mp)})
+	return g
+}
+
+// ModelWorkOffset records the existing origin of work coordinate system n
+// (1-9, or 0 for the active one) at the machine without emitting any G-Code,
+// so that MachinePosition can be reported.
+func (g *GCode) ModelWorkOffset(n int, origin Tuple) *GCode {
+	n = g.workOffsetNum(n)
+	g.wcsOffsets[n] = vec(origin)
+	return g
+}
+
+// WorkOffset returns the modeled origin of work coordinate system n
+// (1-9, or 0 for the active one) in machine coordinates.
+func (g *GCode) WorkOffset(n int) Tuple {
+	return g.wcsOffsets[g.workOffsetNum(n)]
+}
+
+// ActiveWorkOffset returns the active work coordinate system (1-9 for G54-G59.3).
+func (g *GCode) ActiveWorkOffset() int {
+	return g.wcs
+}
+
+// MachinePosition returns the current tool position in machine
+// coordinates using the modeled work offsets.
+func (g *GCode) MachinePosition() Tuple {
+	return g.lastPos().Add(g.wcsOffsets[g.wcs]).Add(g.g92Offset)
+}
+
+// GotoMachineZ performs a rapid move on the Z axis in machine
+// coordinates using G53 (for example, to a tool change position).
+func (g *GCode) GotoMachineZ(p Tuple) *GCode {
+	return g.gotoMachine(p, forceZ)
+}
+
+// GotoMachineXY performs a rapid move on the XY axes in machine
+// coordinates using G53.
+func (g *GCode) GotoMachineXY(p Tuple) *GCode {
+	return g.gotoMachine(p, forceXY)
+}
+
+// GotoMachineXYZ performs a rapid move on the XYZ axes in machine
+// coordinates using G53.
+func (g *GCode) GotoMachineXYZ(p Tuple) *GCode {
+	return g.gotoMachine(p, forceXYZ)
+}
+
+func (g *GCode) gotoMachine(p Tuple, axes int) *GCode {
+	mp := g.MachinePosition()
+	parts := []string{"G53 G0"}
+	for i, name := range "XYZ" {
+		if axes&(1<<i) != 0 {
+			mp[i] = p[i]
+			parts = append(parts, fmt.Sprintf("%c%.8f", name, p[i]))
+		}
+	}
+	g.steps = append(g.steps, &Step{s: strings.Join(parts, " "), pos: g.workFromMachine(mp)})
+	g.hasMoved = true
+	return g
+}
+
+// workFromMachine converts a machine position to work coordinates.
+func (g *GCode) workFromMachine(mp Tuple) Tuple {
+	return mp.Sub(g.wcsOffsets[g.wcs]).Sub(g.g92Offset)
+}
+
+func (g *GCode) workOffsetNum(n int) int {
+	if n == 0 {
+		return g.wcs
+	}
+	checkWorkOffset(n)
+	return n
+}
+
+func checkWorkOffset(n int) {
+	if n < 1 || n >= len(workOffsetCodes) {
+		log.Fatalf("invalid work coordinate system %v, want 1-9 (G54-G59.3)", n)
+	}
+}
+
+// vec returns p as a vector (with w=0) so that it may be used as an offset.
+func vec(p Tuple) Tuple {
+	return Tuple{p.X(), p.Y(), p.Z(), 0}
+}
@@ -0,0 +1,78 @@
+package gcode
+
+import "testing"
+
+func TestWorkOffsets(t *testing.T) {
+	g := New(NoHeader)
+	g.ModelWorkOffset(1, XYZ(100, 50, -20))
+	g.GotoXYZ(XYZ(0, 0, 5))
+	if got, want := g.MachinePosition(), XYZ(100, 50, -15); !got.Equal(want) {
+		t.Errorf("MachinePosition = %v, want %v", got, want)
+	}
+
+	g.SetWorkOffset(2, XYZ(110, 50, -20))
+	g.SelectWorkOffset(2)
+	if got, want := g.Position(), XYZ(-10, 0, 5); !got.Equal(want) {
+		t.Errorf("G55 Position = %v, want %v", got, want)
+	}
+
+	g.SetWorkPosition(0, XYZ(0, 0, 5))
+	if got, want := g.WorkOffset(2), XYZ(100, 50, -20); !got.Equal(want) {
+		t.Errorf("WorkOffset(2) = %v, want %v", got, want)
+	}
+
+	g.SetPosition(XYZ(1, 2, 3))
+	if got, want := g.Position(), XYZ(1, 2, 3); !got.Equal(want) {
+		t.Errorf("G92 Position = %v, want %v", got, want)
+	}
+	g.CancelPositionOffset()
+	if got, want := g.Position(), XYZ(0, 0, 5); !got.Equal(want) {
+		t.Errorf("G92.1 Position = %v, want %v", got, want)
+	}
+
+	g.GotoMachineZ(Z(0))
+	g.SelectWorkOffset(1)
+	if got, want := g.Position(), XYZ(0, 0, 20); !got.Equal(want) {
+		t.Errorf("G53 Position = %v, want %v", got, want)
+	}
+	if got, want := g.MachinePosition(), XYZ(100, 50, 0); !got.Equal(want) {
+		t.Errorf("MachinePosition = %v, want %v", got, want)
+	}
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z5.00000000
+G10 L2 P2 X110.00000000 Y50.00000000 Z-20.00000000
+G55
+G10 L20 P2 X0.00000000 Y0.00000000 Z5.00000000
+G92 X1.00000000 Y2.00000000 Z3.00000000
+G92.1
+G53 G0 Z0.00000000
+G54
+`
+	if got != want {
+		t.Errorf("String =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestRepeat_G10L2(t *testing.T) {
+	g := New(NoHeader)
+	g.ModelWorkOffset(1, XYZ(100, 0, 0))
+	g.SelectWorkOffset(3)
+	g.GotoXYZ(XYZ(0, 0, 5))
+	g.Repeat(hookSub(), []M4{Translation(10, 0, 0)}, &RepeatOptions{Mode: RepeatG10L2})
+
+	got := g.String()
+	want := `G56
+G0 X0.00000000 Y0.00000000 Z5.00000000
+G10 L2 P2 X10.00000000 Y0.00000000 Z0.00000000
+G55
+G0 X1.00000000 Y0.00000000
+G1 Z-1.00000000
+G2 X0.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 Y0.00000000
+G56
+`
+	if got != want {
+		t.Errorf("Repeat =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,195 @@
+package gcode
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// defaultWrapMaxLength is the default maximum length of a wrapped segment.
+const defaultWrapMaxLength = 1
+
+// feedRE matches the feedrate word of a step.
+var feedRE = regexp.MustCompile(`(?:^| )F(-?[0-9.]+)`)
+
+// WrapOptions represents options for the WrapCylinder method.
+type WrapOptions struct {
+	// WrapX converts X (instead of Y) to A, for rotary axes mounted along Y.
+	WrapX bool
+	// ZAtAxis adds the radius to Z for machines whose Z zero is at the
+	// rotary axis instead of at the top of the cylinder.
+	ZAtAxis bool
+	// Feedrate, if non-nil, is the feedrate along the surface used for
+	// all feed moves. Otherwise, the feedrates of the design are used.
+	Feedrate *float64
+	// MaxLength is the maximum length of a segment. Default is 1.
+	MaxLength *float64
+}
+
+// WrapCylinder wraps the flat XY toolpaths of the design onto a cylinder
+// of the given radius on the rotary A axis. Y (or X with WrapX) is
+// converted to A degrees such that the toolpath keeps its size on the
+// surface of the cylinder and is held at zero, which must be the
+// position of the rotary axis. Z is relative to the top of the cylinder
+// unless ZAtAxis is set.
+//
+// Arcs are linearized and feed moves are subdivided to at most MaxLength.
+// Since the feedrate of moves rotating A is ambiguous, feed moves are
+// emitted in inverse time mode (G93) with the feedrate computed from
+// their length on the flat design, and units per minute mode (G94) is
+// restored after the last feed move.
+//
+// It should be called once the design is complete and does not support
+// symbolic coordinates, sub-program definitions, or designs already
+// using the extra axes.
+func (g *GCode) WrapCylinder(radius float64, opts *WrapOptions) *GCode {
+	if radius <= 0 {
+		log.Fatalf("WrapCylinder: invalid radius %v", radius)
+	}
+	if len(g.subs) > 0 && g.dialect != dialectNone {
+		log.Fatal("WrapCylinder: sub-program definitions can not be wrapped")
+	}
+	if opts == nil {
+		opts = &WrapOptions{}
+	}
+	maxLength := getFloat(opts.MaxLength, defaultWrapMaxLength)
+	if maxLength <= 0 {
+		log.Fatalf("WrapCylinder: invalid MaxLength %v", maxLength)
+	}
+
+	// wrapped is the flat axis converted to A, which is held at zero.
+	wrapped := 1
+	if opts.WrapX {
+		wrapped = 0
+	}
+	wrap := func(p Tuple) (Tuple, [6]float64) {
+		var extra [6]float64
+		extra[0] = ToDeg(p[wrapped] / radius)
+		p[wrapped] = 0
+		if opts.ZAtAxis {
+			p[2] += radius
+		}
+		return p, extra
+	}
+	wrapForce := func(force int) int {
+		if force&(1<<wrapped) != 0 {
+			force |= forceA
+		}
+		return force | 1<<wrapped
+	}
+
+	lastFeed := -1
+	for i, step := range g.steps {
+		if m := step.motion; m != nil && m.opCode != "G0" {
+			lastFeed = i
+		}
+	}
+
+	w := &GCode{commentFmt: g.commentFmt}
+	plane := PlaneXY
+	prev := XYZ(0, 0, 0)
+	var feed float64
+	var inverseTime bool
+	if opts.Feedrate != nil {
+		feed = *opts.Feedrate
+	}
+	for i, step := range g.steps {
+		if step.plane != "" {
+			plane = step.plane
+		}
+		m := step.motion
+		if m == nil {
+			// The feed modes of the design are replaced by the ones below.
+			if step.s == string(FeedInverseTime) || step.s == string(FeedUnitsPerMinute) {
+				continue
+			}
+			if opts.Feedrate == nil {
+				if f, ok := parseFeed(step.s); ok {
+					feed = f
+				}
+			}
+			// Steps such as probes and G53 moves may change the position.
+			p, extra := wrap(step.pos)
+			w.steps = append(w.steps, &Step{s: step.s, pos: p, plane: step.plane})
+			w.extra = extra
+			prev = step.pos
+			continue
+		}
+		if m.axes&^forceXYZ != 0 {
+			log.Fatalf("WrapCylinder: step %q already uses extra axes", step.s)
+		}
+		if m.sym {
+			log.Fatalf("WrapCylinder: symbolic step %q can not be wrapped", step.s)
+		}
+
+		if m.opCode == "G0" {
+			p, extra := wrap(step.pos)
+			w.emitMoveAxes("G0", p, extra, wrapForce(m.axes))
+			prev = step.pos
+			continue
+		}
+
+		if f, ok := parseFeed(m.words); ok && opts.Feedrate == nil {
+			feed = f
+		}
+		if m.rate > 0 && opts.Feedrate == nil {
+			feed = m.rate
+		}
+		if feed <= 0 {
+			log.Fatalf("WrapCylinder: no feedrate for step %q", step.s)
+		}
+		if !inverseTime {
+			w.sendOpCode("G93")
+			inverseTime = true
+		}
+
+		points := []Tuple{step.pos}
+		if m.arc {
+			points = arcPoints(plane, m.opCode, prev, step.pos, m.center, m.turns)
+		}
+		from := prev
+		for _, to := range points {
+			length := to.Sub(from).Magnitude()
+			n := int(math.Ceil(length / maxLength))
+			if n < 1 {
+				n = 1
+			}
+			for j := 1; j <= n; j++ {
+				p, extra := wrap(from.Add(to.Sub(from).MultScalar(float64(j) / float64(n))))
+				steps := len(w.steps)
+				w.emitMoveAxes("G1", p, extra, wrapForce(forceXYZ))
+				if len(w.steps) > steps {
+					w.appendWords(fmt.Sprintf(" F%.8f", feed*float64(n)/length))
+				}
+			}
+			from = to
+		}
+		prev = step.pos
+
+		if i == lastFeed {
+			inverseTime = false
+			w.sendOpCode("G94")
+			w.sendOpCode(fmt.Sprintf("F%.8f", feed))
+		}
+	}
+
+	g.steps = w.steps
+	g.extra = w.extra
+	g.hasMoved = true
+	if lastFeed >= 0 {
+		g.feedMode, g.feedrate = FeedUnitsPerMinute, feed
+	}
+	return g
+}
+
+// parseFeed returns the feedrate word of s, if any.
+func parseFeed(s string) (float64, bool) {
+	match := feedRE.FindStringSubmatch(s)
+	if match == nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(match[1], 64)
+	return f, err == nil
+}
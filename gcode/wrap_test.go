@@ -0,0 +1,97 @@
+package gcode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWrapCylinder(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, 1))
+	g.MoveZWithF(100, Z(-1))
+	g.MoveXY(XY(0, 0.5*math.Pi*10))
+	g.GotoZ(Z(1))
+	g.WrapCylinder(10, &WrapOptions{MaxLength: Float(10)})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z1.00000000 A0.00000000
+G93
+G1 Z-1.00000000 F50.00000000
+G1 A45.00000000 F12.73239545
+G1 A90.00000000 F12.73239545
+G94
+F100.00000000
+G0 Z1.00000000
+`
+	if got != want {
+		t.Errorf("WrapCylinder =\n%v\nwant:\n%v", got, want)
+	}
+	if got, want := g.AxesPosition()["A"], 90.0; math.Abs(got-want) > epsilon {
+		t.Errorf("A = %v, want %v", got, want)
+	}
+}
+
+func TestWrapCylinder_InverseTime(t *testing.T) {
+	// The desired speed of a design in inverse time mode is kept.
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, -1))
+	g.Feedmode(FeedInverseTime)
+	g.Feedrate(100)
+	g.MoveXY(XY(0, 0.5*math.Pi*10))
+	g.WrapCylinder(10, &WrapOptions{MaxLength: Float(10)})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z-1.00000000 A0.00000000
+G93
+G1 A45.00000000 F12.73239545
+G1 A90.00000000 F12.73239545
+G94
+F100.00000000
+`
+	if got != want {
+		t.Errorf("WrapCylinder =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestWrapCylinder_Literal(t *testing.T) {
+	// The move after a step changing the position starts from it.
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(0, 0, -1))
+	moved := XYZ(0, 10, -1)
+	g.Literal("(moved)", &moved)
+	g.Feedrate(100)
+	g.MoveXY(XY(0, 20))
+	g.WrapCylinder(10, &WrapOptions{MaxLength: Float(10)})
+
+	got := g.String()
+	want := `G0 X0.00000000 Y0.00000000 Z-1.00000000 A0.00000000
+(moved)
+F100.00000000
+G93
+G1 A114.59155903 F10.00000000
+G94
+F100.00000000
+`
+	if got != want {
+		t.Errorf("WrapCylinder =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestWrapCylinder_Arc(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoXYZ(XYZ(5, 0, -1))
+	g.CircleCCW(XYZ(0, 0, -1), nil)
+	g.WrapCylinder(20, &WrapOptions{WrapX: true, ZAtAxis: true, Feedrate: Float(60)})
+
+	for _, step := range g.steps[1:] {
+		if got, want := step.pos.Z(), 19.0; math.Abs(got-want) > epsilon {
+			t.Errorf("step %q Z = %v, want %v", step.s, got, want)
+		}
+		if step.pos.X() != 0 {
+			t.Errorf("step %q X = %v, want 0", step.s, step.pos.X())
+		}
+	}
+	if got, want := g.AxesPosition()["A"], ToDeg(5.0/20); math.Abs(got-want) > epsilon {
+		t.Errorf("A = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,647 @@
+package utils
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultAdaptiveEngagement = 0.1  // fraction of the tool diameter
+	defaultAdaptiveTrochoid   = 0.25 // fraction of the tool diameter
+	adaptiveResolution        = 20   // material cells across the tool diameter
+	engagementSamples         = 72   // samples around the tool
+)
+
+// AdaptiveModeT represents the motion used by AdaptiveClear.
+type AdaptiveModeT string
+
+const (
+	AdaptiveSpiral     AdaptiveModeT = ""           // offset passes, with trochoidal loops where needed
+	AdaptiveTrochoidal AdaptiveModeT = "trochoidal" // trochoidal loops along all passes
+)
+
+// AdaptiveOptions represents options for the AdaptiveClear function.
+type AdaptiveOptions struct {
+	// ToolDiameter is the diameter of the end mill.
+	ToolDiameter float64
+	// CutZ is the Z of the bottom of the cut.
+	CutZ float64
+	// Mode selects the motion. Default is AdaptiveSpiral.
+	Mode AdaptiveModeT
+	// Outside clears the region inside Stock and outside the profile.
+	// Otherwise, the pocket inside the profile is cleared.
+	Outside bool
+	// Stock is the outline of the stock for Outside. Default is the
+	// bounding box of the profile grown by the tool diameter.
+	Stock []Tuple
+	// MaxEngagement is the maximum radial engagement of the tool as a
+	// fraction of its diameter, which is also the distance between the
+	// passes of AdaptiveSpiral and the advance of each trochoidal loop.
+	// Default is 0.1.
+	MaxEngagement *float64
+	// TrochoidRadius is the radius of the trochoidal loops. The passes of
+	// AdaptiveTrochoidal are the tool radius plus TrochoidRadius (less half
+	// of MaxEngagement) apart. Default is 25% of the tool diameter.
+	TrochoidRadius *float64
+	// Allowance is the material left on the walls of the profile.
+	Allowance float64
+	// Resolution is the size of the cells of the material model.
+	// Default is 5% of the tool diameter.
+	Resolution *float64
+	// SafeZ is the Z for rapid moves. Default is the Z on entry.
+	SafeZ *float64
+	// Entry, if non-nil, selects how the tool enters the material.
+	// Default is a plunge.
+	Entry *EntryOptions
+	// Feedrate, if non-nil, sets the feedrate of the clearing.
+	Feedrate *float64
+}
+
+// AdaptiveClear clears the pocket inside the closed profile (or the stock
+// outside of it) at CutZ while keeping the radial engagement of the tool
+// below MaxEngagement.
+//
+// The passes follow the offsets of the profile from the middle of the
+// region out to the walls (or in from the edge of the stock). A 2D model
+// of the remaining material gives the engagement of the tool along each
+// pass. Wherever a straight cut would exceed the limit (such as at
+// the start and in corners), the tool switches to trochoidal loops: arcs
+// out and back to the pass, advancing MaxEngagement each loop. Where the
+// walls leave no room for a loop, the cut stays straight. Passes are
+// linked by feed moves while they stay clear of the walls, and by rapids
+// at SafeZ otherwise.
+func AdaptiveClear(g *GCode, profile []Tuple, opts *AdaptiveOptions) {
+	a := newAdaptive(g, profile, opts)
+
+	g.Comment("-- adaptive_clear mode=", opts.Mode, " diameter=", opts.ToolDiameter, " engagement=", a.step, " --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+	g.GotoZ(Z(a.safeZ))
+
+	a.run()
+	g.GotoZ(Z(a.safeZ))
+
+	g.Comment("-- end adaptive_clear --")
+}
+
+// adaptive holds the state of an adaptive clearing operation.
+type adaptive struct {
+	g                   *GCode
+	profile             []Tuple
+	outside, trochoidal bool
+	radius              float64
+	step                float64 // maximum radial engagement.
+	trochoid            float64 // radius of the trochoidal loops.
+	allowance, spacing  float64
+	maxAngle            float64 // maximum engagement angle.
+	cutZ, safeZ         float64
+	entry               *EntryOptions
+	m                   *materialModel
+	field               [][]float64 // field at the centers of the cells.
+
+	pos     Tuple // position of the tool.
+	down    bool  // whether the tool is at CutZ.
+	from    Tuple // position before the pending moves.
+	pending []Tuple
+}
+
+func newAdaptive(g *GCode, profile []Tuple, opts *AdaptiveOptions) *adaptive {
+	if opts == nil || opts.ToolDiameter <= 0 {
+		log.Fatal("AdaptiveClear: ToolDiameter must be positive")
+	}
+	if len(profile) < 3 {
+		log.Fatal("AdaptiveClear: profile must have at least 3 points")
+	}
+	if opts.Mode != AdaptiveSpiral && opts.Mode != AdaptiveTrochoidal {
+		log.Fatalf("unknown adaptive mode %q", opts.Mode)
+	}
+	d := opts.ToolDiameter
+	engagement := getFloat(opts.MaxEngagement, defaultAdaptiveEngagement)
+	if engagement <= 0 || engagement > 1 {
+		log.Fatalf("invalid MaxEngagement %v", engagement)
+	}
+	a := &adaptive{
+		g:          g,
+		outside:    opts.Outside,
+		trochoidal: opts.Mode == AdaptiveTrochoidal,
+		radius:     d / 2,
+		step:       engagement * d,
+		trochoid:   getFloat(opts.TrochoidRadius, defaultAdaptiveTrochoid*d),
+		allowance:  opts.Allowance,
+		maxAngle:   math.Acos(1 - 2*engagement),
+		cutZ:       opts.CutZ,
+		entry:      opts.Entry,
+		safeZ:      getFloat(opts.SafeZ, g.Position().Z()),
+	}
+	if a.trochoid <= 0 {
+		log.Fatalf("invalid TrochoidRadius %v", a.trochoid)
+	}
+	// Each pass must reach the material left by the next farther pass.
+	a.spacing = a.step
+	if a.trochoidal {
+		a.spacing = math.Max(a.radius+a.trochoid-a.step/2, a.step)
+	}
+	for _, p := range profile {
+		a.profile = append(a.profile, XY(p.X(), p.Y()))
+	}
+	res := math.Min(getFloat(opts.Resolution, d/adaptiveResolution), a.step/2)
+	if res <= 0 {
+		log.Fatalf("invalid Resolution %v", res)
+	}
+
+	// The material model covers the region with a margin outside of
+	// which the passes may go when clearing the stock.
+	min, max := polygonBounds(a.profile)
+	margin := 2 * res
+	stock := opts.Stock
+	if a.outside {
+		if len(stock) == 0 {
+			stock = []Tuple{min.Sub(XY(d, d)), XY(max.X()+d, min.Y()-d), max.Add(XY(d, d)), XY(min.X()-d, max.Y()+d)}
+		}
+		min, max = polygonBounds(stock)
+		margin += a.radius + 2*a.trochoid + a.spacing
+	}
+	a.m = newMaterialModel(min.Sub(XY(margin, margin)), max.Add(XY(margin, margin)), res)
+	a.field = make([][]float64, a.m.ny)
+	for j := range a.field {
+		a.field[j] = make([]float64, a.m.nx)
+		for i := range a.field[j] {
+			c := a.m.center(i, j)
+			a.field[j][i] = a.fieldAt(c)
+			a.m.cells[j][i] = a.field[j][i] > 0 && (!a.outside || insidePolygon(c, stock))
+		}
+	}
+	return a
+}
+
+// run cuts the passes from the farthest to the nearest to the profile.
+func (a *adaptive) run() {
+	for _, level := range a.levels() {
+		loops := a.contours(level)
+		for len(loops) > 0 {
+			// Continue with the nearest pass.
+			best, bestT, bestD := 0, 0.0, math.Inf(1)
+			for i, loop := range loops {
+				for k, p := range loop.points {
+					if d := p.Sub(a.pos).Magnitude(); d < bestD {
+						best, bestT, bestD = i, loop.dist[k], d
+					}
+				}
+			}
+			path := loops[best]
+			loops = append(loops[:best], loops[best+1:]...)
+			if path.closed() {
+				path = a.rotate(path, bestT)
+			}
+			a.cut(path, true)
+		}
+	}
+	a.flush()
+}
+
+// fieldAt returns the distance from p to the profile, which is
+// positive on the side of the profile that is cleared.
+func (a *adaptive) fieldAt(p Tuple) float64 {
+	d := math.Inf(1)
+	for i, v := range a.profile {
+		d = math.Min(d, segmentDistance(p, v, a.profile[(i+1)%len(a.profile)]))
+	}
+	if insidePolygon(p, a.profile) == a.outside {
+		return -d
+	}
+	return d
+}
+
+// levels returns the offsets from the profile of the passes, from
+// the farthest to the nearest.
+func (a *adaptive) levels() []float64 {
+	base := a.radius + a.allowance
+	reach := a.radius
+	if a.trochoidal {
+		base += a.trochoid
+		reach += a.trochoid
+	}
+	// Each pass clears the material within reach of its offset, up to
+	// the farthest material. In a pocket, the last pass is limited to the
+	// middle of the pocket.
+	far, top := math.Inf(-1), math.Inf(1)
+	for j, row := range a.field {
+		for i, f := range row {
+			if a.m.cells[j][i] {
+				far = math.Max(far, f)
+			}
+		}
+	}
+	if !a.outside {
+		top = far - a.m.res
+	}
+	if base > top {
+		log.Fatal("AdaptiveClear: the tool does not fit in the profile")
+	}
+	var result []float64
+	for level := base; ; level += a.spacing {
+		result = append(result, math.Min(level, top))
+		if level+reach >= far || level >= top {
+			break
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(result)))
+	return result
+}
+
+// contours returns the passes at the offset level from the profile,
+// oriented for climb milling with the walls on their right.
+func (a *adaptive) contours(level float64) []*polyline {
+	var result []*polyline
+	for _, points := range contourPoints(a.field, level, a.m.center) {
+		path := newPolyline(points)
+		if len(path.points) < 2 {
+			continue
+		}
+
+		// Check the side of the field on the longest segment.
+		var mid, dir Tuple
+		for k := 1; k < len(path.points); k++ {
+			if v := path.points[k].Sub(path.points[k-1]); v.Magnitude() > dir.Magnitude() {
+				mid, dir = path.points[k-1].Add(v.MultScalar(0.5)), v
+			}
+		}
+		left := XY(-dir.Y(), dir.X()).Normalize().MultScalar(a.m.res / 2)
+		if a.fieldAt(mid.Add(left)) < a.fieldAt(mid.Sub(left)) {
+			for l, r := 0, len(points)-1; l < r; l, r = l+1, r-1 {
+				points[l], points[r] = points[r], points[l]
+			}
+			path = newPolyline(points)
+		}
+		result = append(result, path)
+	}
+	return result
+}
+
+// rotate returns the closed path starting at t, or further along the
+// path if that lets the tool link to it without exceeding the engagement.
+func (a *adaptive) rotate(path *polyline, t float64) *polyline {
+	if a.down {
+		for offset := 0.0; offset < math.Min(4*a.radius, path.length()); offset += a.step {
+			if p, _ := path.at(t + offset); a.gentleLink(a.pos, p) {
+				return path.rotate(t + offset)
+			}
+		}
+	}
+	return path.rotate(t)
+}
+
+// cut clears the material along path. Wherever a straight cut would
+// exceed the engagement, trochoidal loops are cut instead. Stretches
+// without material are skipped and linked.
+func (a *adaptive) cut(path *polyline, links bool) {
+	reach := a.radius + 2*a.trochoid + a.m.res
+	length := path.length()
+	inLoops, loopRadius, cutting := a.trochoidal, 0.0, false
+	for t := 0.0; ; {
+		p, u := path.at(t)
+		if !a.m.hasMaterial(p, reach) {
+			inLoops, loopRadius, cutting = a.trochoidal, 0, false
+			if t >= length {
+				break
+			}
+			t = math.Min(t+a.m.res, length)
+			continue
+		}
+		if !cutting {
+			if links {
+				a.link(p, u)
+			} else {
+				a.moveTo(p)
+			}
+			cutting = true
+		}
+
+		if inLoops {
+			// Grow the loops up to the trochoid radius before advancing.
+			if r := a.loopRadius(p, u, math.Min(a.trochoid, loopRadius+a.step/2)); r > 0 {
+				a.loop(p, u, r)
+				grew := r > loopRadius+epsilon
+				loopRadius = r
+				if !grew {
+					if t >= length {
+						break
+					}
+					t = a.advance(path, t, math.Min(t+a.step, length))
+				}
+				if !a.trochoidal {
+					if ahead, v := path.at(t + 2*loopRadius + a.m.res); a.m.engagement(ahead, v, a.radius) <= a.maxAngle {
+						inLoops, loopRadius = false, 0
+					}
+				}
+				continue
+			}
+		}
+
+		if t >= length {
+			break
+		}
+		next := math.Min(t+a.m.res, length)
+		q, _ := path.at(next)
+		if !inLoops && a.m.engagement(q, u, a.radius) > a.maxAngle {
+			inLoops = true
+			continue
+		}
+		a.moveTo(q)
+		t = next
+	}
+}
+
+// advance moves along path from t0 to t1, returning t1.
+func (a *adaptive) advance(path *polyline, t0, t1 float64) float64 {
+	for k, p := range path.points {
+		if path.dist[k] > t0 && path.dist[k] < t1 {
+			a.moveTo(p)
+		}
+	}
+	p, _ := path.at(t1)
+	a.moveTo(p)
+	return t1
+}
+
+// link moves the tool to p at CutZ, where the cut continues in the
+// direction u.
+func (a *adaptive) link(p, u Tuple) {
+	switch {
+	case !a.down:
+		a.flush()
+		a.enter(p, u)
+	case p.Sub(a.pos).Magnitude() < epsilon:
+	case a.clearPath(a.pos, p):
+		a.moveTo(p)
+	case a.allowedPath(a.pos, p):
+		a.cut(newPolyline([]Tuple{a.pos, p}), false)
+	default:
+		a.flush()
+		a.g.GotoZ(Z(a.safeZ))
+		a.enter(p, u)
+	}
+}
+
+// enter moves the tool down to CutZ at p using the entry strategy,
+// with ramps along u.
+func (a *adaptive) enter(p, u Tuple) {
+	enter(a.g, XYZ(p.X(), p.Y(), a.cutZ), p.Add(u.MultScalar(4*a.radius)), a.radius, a.entry, a.allowed)
+	a.pos, a.from, a.down = p, p, true
+	a.m.clear(p, a.radius)
+}
+
+// moveTo cuts straight to p.
+func (a *adaptive) moveTo(p Tuple) {
+	a.m.sweep(a.pos, p, a.radius)
+	a.pending = append(a.pending, p)
+	a.pos = p
+}
+
+// flush emits the pending straight cuts.
+func (a *adaptive) flush() {
+	if len(a.pending) > 0 {
+		points := simplifyTolerance(append([]Tuple{a.from}, a.pending...), a.m.res/4)
+		a.g.MoveXY(points[1:]...)
+		a.pending = nil
+	}
+	a.from = a.pos
+}
+
+// loop cuts a trochoidal loop of radius r starting and ending at p,
+// ahead of p in the direction u.
+func (a *adaptive) loop(p, u Tuple, r float64) {
+	a.flush()
+	front := p.Add(u.MultScalar(2 * r))
+	a.g.ArcCCW(XYZ(front.X(), front.Y(), a.cutZ), r, nil)
+	a.g.ArcCCW(XYZ(p.X(), p.Y(), a.cutZ), r, nil)
+
+	center := p.Add(u.MultScalar(r))
+	n := int(math.Ceil(4 * math.Pi * r / a.m.res))
+	for k := 0; k < n; k++ {
+		angle := 2 * math.Pi * float64(k) / float64(n)
+		a.m.clear(center.Add(XY(r*math.Cos(angle), r*math.Sin(angle))), a.radius)
+	}
+	a.from = a.pos
+}
+
+// loopRadius returns the largest radius up to r of a loop at p in the
+// direction u that keeps the tool off the walls, or 0 if there is none.
+func (a *adaptive) loopRadius(p, u Tuple, r float64) float64 {
+	for ; r >= a.m.res; r /= 2 {
+		center := p.Add(u.MultScalar(r))
+		ok := true
+		for k := 0; ok && k < engagementSamples/4; k++ {
+			angle := 2 * math.Pi * float64(k) / (engagementSamples / 4)
+			ok = a.allowed(center.Add(XY(r*math.Cos(angle), r*math.Sin(angle))))
+		}
+		if ok {
+			return r
+		}
+	}
+	return 0
+}
+
+// allowed reports whether the tool at p is off the walls.
+func (a *adaptive) allowed(p Tuple) bool {
+	return a.fieldAt(p) >= a.radius+a.allowance-a.m.res/2
+}
+
+// samples calls fn for the points from p0 to p1, one cell apart,
+// and returns false if fn does.
+func (a *adaptive) samples(p0, p1 Tuple, fn func(p, u Tuple) bool) bool {
+	v := p1.Sub(p0)
+	n := int(math.Ceil(v.Magnitude() / a.m.res))
+	u := v.Normalize()
+	for k := 1; k <= n; k++ {
+		if !fn(p0.Add(v.MultScalar(float64(k)/float64(n))), u) {
+			return false
+		}
+	}
+	return true
+}
+
+// clearPath reports whether the tool can move from p0 to p1 without
+// cutting material or touching the walls.
+func (a *adaptive) clearPath(p0, p1 Tuple) bool {
+	return a.samples(p0, p1, func(p, u Tuple) bool { return a.allowed(p) && !a.m.hasMaterial(p, a.radius) })
+}
+
+// allowedPath reports whether the tool can move from p0 to p1
+// without touching the walls.
+func (a *adaptive) allowedPath(p0, p1 Tuple) bool {
+	return a.samples(p0, p1, a.allowedSample)
+}
+
+func (a *adaptive) allowedSample(p, u Tuple) bool { return a.allowed(p) }
+
+// gentleLink reports whether the tool can cut from p0 to p1 without
+// touching the walls or exceeding the engagement.
+func (a *adaptive) gentleLink(p0, p1 Tuple) bool {
+	return a.samples(p0, p1, func(p, u Tuple) bool {
+		return a.allowed(p) && a.m.engagement(p, u, a.radius) <= a.maxAngle
+	})
+}
+
+// materialModel represents the material remaining in a grid of cells.
+type materialModel struct {
+	origin Tuple // center of cell (0, 0).
+	res    float64
+	nx, ny int
+	cells  [][]bool // cells[j][i] is true where material remains.
+}
+
+func newMaterialModel(min, max Tuple, res float64) *materialModel {
+	m := &materialModel{origin: min, res: res}
+	m.nx = int(math.Ceil((max.X()-min.X())/res)) + 1
+	m.ny = int(math.Ceil((max.Y()-min.Y())/res)) + 1
+	m.cells = make([][]bool, m.ny)
+	for j := range m.cells {
+		m.cells[j] = make([]bool, m.nx)
+	}
+	return m
+}
+
+// center returns the center of cell (i, j).
+func (m *materialModel) center(i, j int) Tuple {
+	return XY(m.origin.X()+float64(i)*m.res, m.origin.Y()+float64(j)*m.res)
+}
+
+// at reports whether material remains at p.
+func (m *materialModel) at(p Tuple) bool {
+	i := int(math.Round((p.X() - m.origin.X()) / m.res))
+	j := int(math.Round((p.Y() - m.origin.Y()) / m.res))
+	return i >= 0 && j >= 0 && i < m.nx && j < m.ny && m.cells[j][i]
+}
+
+// disk calls fn for the cells whose centers are within r of p
+// and returns false if fn does.
+func (m *materialModel) disk(p Tuple, r float64, fn func(i, j int) bool) bool {
+	i0 := max(0, int(math.Ceil((p.X()-r-m.origin.X())/m.res)))
+	i1 := min(m.nx-1, int(math.Floor((p.X()+r-m.origin.X())/m.res)))
+	j0 := max(0, int(math.Ceil((p.Y()-r-m.origin.Y())/m.res)))
+	j1 := min(m.ny-1, int(math.Floor((p.Y()+r-m.origin.Y())/m.res)))
+	for j := j0; j <= j1; j++ {
+		dy := m.origin.Y() + float64(j)*m.res - p.Y()
+		for i := i0; i <= i1; i++ {
+			dx := m.origin.X() + float64(i)*m.res - p.X()
+			if dx*dx+dy*dy <= r*r && !fn(i, j) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// clear removes the material within r of p.
+func (m *materialModel) clear(p Tuple, r float64) {
+	m.disk(p, r, func(i, j int) bool {
+		m.cells[j][i] = false
+		return true
+	})
+}
+
+// sweep removes the material within r of the segment from p0 to p1.
+func (m *materialModel) sweep(p0, p1 Tuple, r float64) {
+	v := p1.Sub(p0)
+	n := int(math.Ceil(2 * v.Magnitude() / m.res))
+	for k := 0; k <= n; k++ {
+		m.clear(p0.Add(v.MultScalar(float64(k)/float64(max(n, 1)))), r)
+	}
+}
+
+// hasMaterial reports whether material remains within r of p.
+func (m *materialModel) hasMaterial(p Tuple, r float64) bool {
+	return !m.disk(p, r, func(i, j int) bool { return !m.cells[j][i] })
+}
+
+// engagement returns the angle of the front half of the tool of
+// radius r at p, moving in the direction u, in contact with material.
+func (m *materialModel) engagement(p, u Tuple, r float64) float64 {
+	var count int
+	for k := 0; k < engagementSamples; k++ {
+		angle := 2 * math.Pi * float64(k) / engagementSamples
+		d := XY(math.Cos(angle), math.Sin(angle))
+		if d.Dot(u) >= 0 && m.at(p.Add(d.MultScalar(r))) {
+			count++
+		}
+	}
+	return 2 * math.Pi * float64(count) / engagementSamples
+}
+
+// polyline represents a path parameterized by its length.
+type polyline struct {
+	points []Tuple
+	dist   []float64 // length of the path up to each point.
+}
+
+// newPolyline returns the path through points, without repeated points.
+func newPolyline(points []Tuple) *polyline {
+	p := &polyline{}
+	for _, v := range points {
+		if n := len(p.points); n > 0 {
+			d := v.Sub(p.points[n-1]).Magnitude()
+			if d < epsilon {
+				continue
+			}
+			p.dist = append(p.dist, p.dist[n-1]+d)
+		} else {
+			p.dist = append(p.dist, 0)
+		}
+		p.points = append(p.points, v)
+	}
+	return p
+}
+
+func (p *polyline) length() float64 { return p.dist[len(p.dist)-1] }
+
+func (p *polyline) closed() bool {
+	return len(p.points) > 2 && p.points[0].Sub(p.points[len(p.points)-1]).Magnitude() < epsilon
+}
+
+// at returns the point at t along the path (clamped to its ends),
+// and the direction of the path there.
+func (p *polyline) at(t float64) (Tuple, Tuple) {
+	k := sort.SearchFloat64s(p.dist, t)
+	k = max(1, min(k, len(p.points)-1))
+	v := p.points[k].Sub(p.points[k-1])
+	s := (t - p.dist[k-1]) / (p.dist[k] - p.dist[k-1])
+	s = math.Max(0, math.Min(1, s))
+	return p.points[k-1].Add(v.MultScalar(s)), v.Normalize()
+}
+
+// rotate returns the closed path starting and ending at t.
+func (p *polyline) rotate(t float64) *polyline {
+	q, _ := p.at(t)
+	k := max(1, sort.SearchFloat64s(p.dist, t))
+	points := append([]Tuple{q}, p.points[k:]...)
+	points = append(points, p.points[1:k]...)
+	return newPolyline(append(points, q))
+}
+
+// polygonBounds returns the corners of the bounding box of the points.
+func polygonBounds(points []Tuple) (Tuple, Tuple) {
+	min, max := points[0], points[0]
+	for _, p := range points[1:] {
+		min = XY(math.Min(min.X(), p.X()), math.Min(min.Y(), p.Y()))
+		max = XY(math.Max(max.X(), p.X()), math.Max(max.Y(), p.Y()))
+	}
+	return XY(min.X(), min.Y()), XY(max.X(), max.Y())
+}
+
+// insidePolygon reports whether p is inside the closed polygon.
+func insidePolygon(p Tuple, polygon []Tuple) bool {
+	var inside bool
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		if (a.Y() > p.Y()) != (b.Y() > p.Y()) &&
+			p.X() < a.X()+(p.Y()-a.Y())*(b.X()-a.X())/(b.Y()-a.Y()) {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestAdaptiveClear(t *testing.T) {
+	profile := []Tuple{XY(0, 0), XY(40, 0), XY(40, 30), XY(20, 30), XY(20, 15), XY(0, 15)}
+	xy := regexp.MustCompile(`X(-?[0-9.]+) Y(-?[0-9.]+)`)
+	tests := []struct {
+		name    string
+		mode    AdaptiveModeT
+		outside bool
+	}{
+		{"spiral pocket", AdaptiveSpiral, false},
+		{"spiral outside", AdaptiveSpiral, true},
+		{"trochoidal pocket", AdaptiveTrochoidal, false},
+		{"trochoidal outside", AdaptiveTrochoidal, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(NoHeader)
+			g.GotoZ(Z(5))
+			a := newAdaptive(g, profile, &AdaptiveOptions{ToolDiameter: 6, CutZ: -1, Mode: tt.mode, Outside: tt.outside})
+			a.run()
+
+			// All the material the tool can reach must be cleared.
+			for j, row := range a.m.cells {
+				for i, c := range row {
+					if c && a.field[j][i] >= a.radius {
+						t.Errorf("material left at %v", a.m.center(i, j))
+					}
+				}
+			}
+			// The tool must stay off the walls.
+			out := g.String()
+			for _, m := range xy.FindAllStringSubmatch(out, -1) {
+				x, _ := strconv.ParseFloat(m[1], 64)
+				y, _ := strconv.ParseFloat(m[2], 64)
+				if f := a.fieldAt(XY(x, y)); f < a.radius-a.m.res {
+					t.Errorf("tool at (%v, %v) is %v from the profile", x, y, f)
+				}
+			}
+			if got := strings.Count(out, "G1 Z-1"); got != 1 {
+				t.Errorf("got %v plunges, want 1", got)
+			}
+			if !strings.Contains(out, "G3 ") {
+				t.Error("no trochoidal loops")
+			}
+		})
+	}
+}
+
+func TestPolyline(t *testing.T) {
+	p := newPolyline([]Tuple{XY(0, 0), XY(2, 0), XY(2, 0), XY(2, 2), XY(0, 2), XY(0, 0)})
+	if !p.closed() || p.length() != 8 {
+		t.Fatalf("closed=%v, length=%v, want true, 8", p.closed(), p.length())
+	}
+	if got, dir := p.at(3); !got.Equal(XY(2, 1)) || !dir.Equal(Y(1)) {
+		t.Errorf("at(3) = %v, %v, want (2, 1), +Y", got, dir)
+	}
+	r := p.rotate(3)
+	want := []Tuple{XY(2, 1), XY(2, 2), XY(0, 2), XY(0, 0), XY(2, 0), XY(2, 1)}
+	if len(r.points) != len(want) {
+		t.Fatalf("rotate(3) = %v, want %v", r.points, want)
+	}
+	for i, v := range want {
+		if !r.points[i].Equal(v) {
+			t.Errorf("rotate(3)[%v] = %v, want %v", i, r.points[i], v)
+		}
+	}
+}
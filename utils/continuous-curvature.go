@@ -21,6 +21,12 @@ import (
 // required to finish the hole. The mill is retracted with a helical move back
 // to the center and starting Z-position.
 func CCHole(g *GCode, center Tuple, targetRadius, toolRadius, cutStep, cutZ float64) {
+	CCHoleWithEntry(g, center, targetRadius, toolRadius, cutStep, cutZ, nil)
+}
+
+// CCHoleWithEntry is like CCHole but enters the material at the
+// center of the hole using the entry strategy.
+func CCHoleWithEntry(g *GCode, center Tuple, targetRadius, toolRadius, cutStep, cutZ float64, entry *EntryOptions) {
 	if targetRadius <= 0.0 {
 		log.Fatal("targetRadius must be positive")
 	}
@@ -44,7 +50,11 @@ func CCHole(g *GCode, center Tuple, targetRadius, toolRadius, cutStep, cutZ floa
 	g.Comment("-- CCHole center=", center, " targetRadius=", targetRadius, " toolRadius=", toolRadius, " cutStep=", cutStep, " cutZ=", cutZ, " --")
 
 	g.GotoXYZ(XYZ(center.X(), center.Y(), oldZ))
-	g.MoveZ(Z(cutZ))
+	inHole := func(p Tuple) bool {
+		return XY(p.X()-center.X(), p.Y()-center.Y()).Magnitude()+toolRadius <= targetRadius+epsilon
+	}
+	// The first cut is along -Y.
+	enter(g, XYZ(center.X(), center.Y(), cutZ), center.Sub(Y(targetRadius-toolRadius)), toolRadius, entry, inHole)
 
 	r := toolRadius
 	n := 1
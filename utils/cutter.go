@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+// CutterShapeT represents the shape of the tip of a cutter.
+type CutterShapeT string
+
+const (
+	CutterFlat     CutterShapeT = "flat"      // flat end mill
+	CutterBall     CutterShapeT = "ball"      // ball nose end mill
+	CutterBullNose CutterShapeT = "bull-nose" // end mill with rounded corners
+	CutterV        CutterShapeT = "v"         // V bit or engraving cutter
+)
+
+// Cutter represents a cutting tool for 3D toolpaths.
+type Cutter struct {
+	Shape CutterShapeT
+	// Diameter is the diameter of the cutter.
+	Diameter float64
+	// CornerRadius is the radius of the corners of a bull-nose cutter.
+	CornerRadius float64
+	// Angle is the included angle of a V cutter in degrees.
+	Angle float64
+}
+
+// Radius returns the radius of the cutter.
+func (c *Cutter) Radius() float64 { return c.Diameter / 2 }
+
+// Profile returns the height of the cutting surface above the tip
+// at the distance d (up to the radius) from the axis of the cutter.
+func (c *Cutter) Profile(d float64) float64 {
+	switch c.Shape {
+	case CutterFlat:
+		return 0
+	case CutterBall:
+		r := c.Radius()
+		return r - math.Sqrt(math.Max(0, r*r-d*d))
+	case CutterBullNose:
+		a, cr := c.torus()
+		if d <= a {
+			return 0
+		}
+		return cr - math.Sqrt(math.Max(0, cr*cr-(d-a)*(d-a)))
+	case CutterV:
+		return d / math.Tan(ToRad(c.Angle/2))
+	}
+	log.Fatalf("unknown cutter shape %q", c.Shape)
+	return 0
+}
+
+// check exits if the cutter is not valid.
+func (c *Cutter) check() {
+	if c.Diameter <= 0 {
+		log.Fatalf("invalid cutter diameter %v", c.Diameter)
+	}
+	if c.Shape == CutterBullNose && (c.CornerRadius <= 0 || c.CornerRadius > c.Radius()) {
+		log.Fatalf("invalid bull-nose corner radius %v", c.CornerRadius)
+	}
+	if c.Shape == CutterV && (c.Angle <= 0 || c.Angle >= 180) {
+		log.Fatalf("invalid V cutter angle %v", c.Angle)
+	}
+	c.Profile(0)
+}
+
+// torus returns the radius of the flat bottom of the cutter and the
+// radius of its corners, which describe flat, ball, and bull-nose cutters.
+func (c *Cutter) torus() (float64, float64) {
+	switch c.Shape {
+	case CutterBall:
+		return 0, c.Radius()
+	case CutterBullNose:
+		return c.Radius() - c.CornerRadius, c.CornerRadius
+	}
+	return c.Radius(), 0
+}
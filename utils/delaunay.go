@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"math"
+)
+
+// delaunayTriangle is a triangle of a Delaunay triangulation with the
+// center and squared radius of its circumcircle.
+type delaunayTriangle struct {
+	v      [3]int
+	cx, cy float64
+	r2     float64
+}
+
+// delaunay returns the Delaunay triangulation of the points, as indices
+// into points, using the Bowyer-Watson algorithm.
+func delaunay(points [][2]float64) []delaunayTriangle {
+	if len(points) < 3 {
+		return nil
+	}
+	minX, minY := points[0][0], points[0][1]
+	maxX, maxY := minX, minY
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	// A super triangle containing all the points.
+	size := math.Max(maxX-minX, maxY-minY) + 1
+	midX, midY := (minX+maxX)/2, (minY+maxY)/2
+	n := len(points)
+	pts := append(points[:n:n],
+		[2]float64{midX - 20*size, midY - size},
+		[2]float64{midX, midY + 20*size},
+		[2]float64{midX + 20*size, midY - size})
+
+	tri := func(a, b, c int) delaunayTriangle {
+		t := delaunayTriangle{v: [3]int{a, b, c}}
+		ax, ay := pts[a][0], pts[a][1]
+		bx, by := pts[b][0]-ax, pts[b][1]-ay
+		cx, cy := pts[c][0]-ax, pts[c][1]-ay
+		d := 2 * (bx*cy - by*cx)
+		if d == 0 {
+			t.r2 = math.Inf(1)
+			return t
+		}
+		b2, c2 := bx*bx+by*by, cx*cx+cy*cy
+		ux, uy := (cy*b2-by*c2)/d, (bx*c2-cx*b2)/d
+		t.cx, t.cy, t.r2 = ax+ux, ay+uy, ux*ux+uy*uy
+		return t
+	}
+
+	tris := []delaunayTriangle{tri(n, n+1, n+2)}
+	for i := 0; i < n; i++ {
+		p := pts[i]
+		// Remove the triangles whose circumcircle contains p and
+		// connect p to the boundary of the hole they leave.
+		edges := map[[2]int]int{}
+		kept := tris[:0]
+		for _, t := range tris {
+			dx, dy := p[0]-t.cx, p[1]-t.cy
+			if dx*dx+dy*dy < t.r2 {
+				for k := 0; k < 3; k++ {
+					a, b := t.v[k], t.v[(k+1)%3]
+					if a > b {
+						a, b = b, a
+					}
+					edges[[2]int{a, b}]++
+				}
+				continue
+			}
+			kept = append(kept, t)
+		}
+		tris = kept
+		for e, count := range edges {
+			if count == 1 {
+				tris = append(tris, tri(e[0], e[1], i))
+			}
+		}
+	}
+
+	result := tris[:0]
+	for _, t := range tris {
+		if t.v[0] < n && t.v[1] < n && t.v[2] < n {
+			result = append(result, t)
+		}
+	}
+	return result
+}
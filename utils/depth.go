@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+// DepthOptions represents how a cut is stepped down to its depth
+// in several passes.
+type DepthOptions struct {
+	// StepDown is the maximum depth of cut of each pass.
+	StepDown float64
+	// Top is the Z of the top of the material. Default is 0.
+	Top *float64
+	// FinishAllowance is the depth left above the bottom by the roughing
+	// passes and removed by a final pass. Default is 0.
+	FinishAllowance *float64
+	// Reverse alternates the direction of the passes, and so alternates
+	// between climb and conventional milling. Not used by Spiral.
+	Reverse bool
+	// Spiral continuously ramps down along a closed path, descending at
+	// most StepDown per lap, instead of stepping down and plunging.
+	// A flat lap at the bottom of the ramp cleans its floor.
+	Spiral bool
+}
+
+// levels returns the Z of the top of the material and the Z of the passes
+// down to bottom, including the finishing pass if any.
+func (d *DepthOptions) levels(bottom float64) (float64, []float64) {
+	if d.StepDown <= 0 {
+		log.Fatalf("invalid StepDown %v", d.StepDown)
+	}
+	top := getFloat(d.Top, 0)
+	allowance := getFloat(d.FinishAllowance, 0)
+	if allowance < 0 {
+		log.Fatalf("invalid FinishAllowance %v", allowance)
+	}
+	rough := bottom + allowance
+	if rough >= top {
+		return top, []float64{bottom}
+	}
+	n := math.Ceil((top-rough)/d.StepDown - epsilon)
+	var levels []float64
+	for k := 1; k <= int(n); k++ {
+		levels = append(levels, top-float64(k)*(top-rough)/n)
+	}
+	if allowance > 0 {
+		levels = append(levels, bottom)
+	}
+	return top, levels
+}
+
+// laps returns the starting and ending Z of each lap of a spiral down to
+// bottom: the ramps, the flat lap at the bottom of the ramps, and the
+// finishing lap if any.
+func (d *DepthOptions) laps(bottom float64) [][2]float64 {
+	top, levels := d.levels(bottom)
+	finish := getFloat(d.FinishAllowance, 0) > 0 && len(levels) > 1
+	if finish {
+		levels = levels[:len(levels)-1]
+	}
+	var laps [][2]float64
+	prev := top
+	for _, z := range levels {
+		laps = append(laps, [2]float64{prev, z})
+		prev = z
+	}
+	laps = append(laps, [2]float64{prev, prev})
+	if finish {
+		laps = append(laps, [2]float64{bottom, bottom})
+	}
+	return laps
+}
+
+// passEntry returns the entry of a pass starting at the Z of the previous
+// pass (or the top of the material), which is rapidly descended to.
+func passEntry(entry *EntryOptions, startZ float64, first bool) *EntryOptions {
+	e := EntryOptions{}
+	if entry != nil {
+		e = *entry
+	}
+	if !first || e.StartZ == nil {
+		e.StartZ = Float(startZ)
+	}
+	return &e
+}
+
+// reversePath returns the closed path followed in the other direction
+// from the same starting point.
+func reversePath(path []Tuple) []Tuple {
+	r := make([]Tuple, 0, len(path))
+	r = append(r, path[0])
+	for i := len(path) - 1; i > 0; i-- {
+		r = append(r, path[i])
+	}
+	return r
+}
+
+// clampZ returns p no lower than z.
+func clampZ(p Tuple, z float64) Tuple {
+	p[2] = math.Max(p.Z(), z)
+	return p
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestDepthOptionsLevels(t *testing.T) {
+	d := &DepthOptions{StepDown: 1.2, FinishAllowance: Float(0.2)}
+	top, levels := d.levels(-3)
+	if want := []float64{-0.93333333, -1.86666667, -2.8, -3}; top != 0 || !closeFloats(levels, want) {
+		t.Errorf("levels = %v, %v, want 0, %v", top, levels, want)
+	}
+	laps := d.laps(-3)
+	if want := [][2]float64{{0, -0.93333333}, {-0.93333333, -1.86666667}, {-1.86666667, -2.8}, {-2.8, -2.8}, {-3, -3}}; len(laps) != len(want) {
+		t.Fatalf("laps = %v, want %v", laps, want)
+	} else {
+		for i := range want {
+			if !closeFloats(laps[i][:], want[i][:]) {
+				t.Errorf("laps[%v] = %v, want %v", i, laps[i], want[i])
+			}
+		}
+	}
+}
+
+func closeFloats(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if d := got[i] - want[i]; d > 1e-6 || d < -1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTracePathDepth(t *testing.T) {
+	path := []Tuple{XY(0, 0), XY(10, 0), XY(10, 10)}
+	tests := []struct {
+		name  string
+		depth *DepthOptions
+		want  string
+	}{
+		{
+			name:  "reverse",
+			depth: &DepthOptions{StepDown: 1, Reverse: true},
+			want: `G0 Z5.00000000
+(-- tracepath at Z=-1 --)
+G0 Z0.00000000
+G1 Z-1.00000000
+G1 X10.00000000
+G1 Y10.00000000
+G1 X0.00000000 Y0.00000000
+G1 Z5.00000000
+(-- tracepath end --)
+(-- tracepath at Z=-2 --)
+G0 Z-1.00000000
+G1 Z-2.00000000
+G1 X10.00000000 Y10.00000000
+G1 Y0.00000000
+G1 X0.00000000
+G1 Z5.00000000
+(-- tracepath end --)
+`,
+		},
+		{
+			name:  "spiral",
+			depth: &DepthOptions{StepDown: 1, Spiral: true},
+			want: `G0 Z5.00000000
+(-- tracepath at Z=0 --)
+G0 Z0.00000000
+G1 X10.00000000 Z-0.29289322
+G1 Y10.00000000 Z-0.58578644
+G1 X0.00000000 Y0.00000000 Z-1.00000000
+G1 X10.00000000 Z-1.29289322
+G1 Y10.00000000 Z-1.58578644
+G1 X0.00000000 Y0.00000000 Z-2.00000000
+G1 X10.00000000
+G1 Y10.00000000
+G1 X0.00000000 Y0.00000000
+G1 Z5.00000000
+(-- tracepath end --)
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(NoHeader)
+			g.GotoZ(Z(5))
+			TracePathWithOptions(g, -2, -1, &TraceOptions{Depth: tt.depth}, path...)
+			if got := g.String(); got != tt.want {
+				t.Errorf("TracePathWithOptions =\n%v\nwant:\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracePathCompDepth(t *testing.T) {
+	square := []Tuple{XYZ(0, 0, -3), XYZ(0, 20, -3), XYZ(20, 20, -3), XYZ(20, 0, -3)}
+	flags := TPCArcIn | TPCArcOut | TPCClosed | TPCOldZ | TPCLeft
+
+	g := New(NoHeader)
+	g.GotoZ(Z(5))
+	TracePathCompWithOptions(g, 1, flags, &TraceOptions{Depth: &DepthOptions{StepDown: 1.2, FinishAllowance: Float(0.2), Reverse: true}}, square...)
+	got := g.String()
+	if n := strings.Count(got, "tracepath_comp at"); n != 4 {
+		t.Errorf("got %v passes, want 4", n)
+	}
+	// The reversed passes keep the tool outside the square.
+	if want := "(-- tracepath_comp at right side at width=1 --)\nG0 Z-2.80000000\nG1 Z-3.00000000\nG2 X0.00000000 Y-1.00000000 I1.00000000 J0.00000000\nG1 X20.00000000\n"; !strings.Contains(got, want) {
+		t.Errorf("TracePathCompWithOptions =\n%v\nwant finishing pass:\n%v", got, want)
+	}
+
+	g = New(NoHeader)
+	g.GotoZ(Z(5))
+	TracePathCompWithOptions(g, 1, flags, &TraceOptions{Depth: &DepthOptions{StepDown: 2, Spiral: true}}, square...)
+	want := `G0 Z5.00000000
+(-- tracepath_comp at left side at width=1 --)
+G0 X-2.00000000 Y-1.00000000
+G0 Z0.00000000
+G3 X-1.00000000 Y0.00000000 I0.00000000 J1.00000000
+G1 Y20.00000000 Z-0.34769231
+G2 X0.00000000 Y21.00000000 Z-0.37500000 I1.00000000 J0.00000000
+G1 X20.00000000 Z-0.72269231
+G2 X21.00000000 Y20.00000000 Z-0.75000000 I0.00000000 J-1.00000000
+G1 Y0.00000000 Z-1.09769231
+G2 X20.00000000 Y-1.00000000 Z-1.12500000 I-1.00000000 J0.00000000
+G1 X0.00000000 Z-1.47269231
+G2 X-1.00000000 Y0.00000000 Z-1.50000000 I0.00000000 J1.00000000
+G1 Y20.00000000 Z-1.84769231
+G2 X0.00000000 Y21.00000000 Z-1.87500000 I1.00000000 J0.00000000
+G1 X20.00000000 Z-2.22269231
+G2 X21.00000000 Y20.00000000 Z-2.25000000 I0.00000000 J-1.00000000
+G1 Y0.00000000 Z-2.59769231
+G2 X20.00000000 Y-1.00000000 Z-2.62500000 I-1.00000000 J0.00000000
+G1 X0.00000000 Z-2.97269231
+G2 X-1.00000000 Y0.00000000 Z-3.00000000 I0.00000000 J1.00000000
+G1 Y20.00000000
+G2 X0.00000000 Y21.00000000 I1.00000000 J0.00000000
+G1 X20.00000000
+G2 X21.00000000 Y20.00000000 I0.00000000 J-1.00000000
+G1 Y0.00000000
+G2 X20.00000000 Y-1.00000000 I-1.00000000 J0.00000000
+G1 X0.00000000
+G3 X-1.00000000 Y-2.00000000 I0.00000000 J-1.00000000
+G0 Z5.00000000
+(-- tracepath_comp end --)
+`
+	if got := g.String(); got != want {
+		t.Errorf("TracePathCompWithOptions spiral =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,428 @@
+package utils
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultDropCutterStepover  = 0.1 // fraction of the cutter diameter
+	defaultDropCutterTolerance = 0.01
+	bvhLeafSize                = 4
+	edgeSearchIterations       = 40
+	maxRefineDepth             = 10
+)
+
+// DropCutterOptions represents options for the RasterFinish and
+// WaterlineFinish functions.
+type DropCutterOptions struct {
+	// Cutter is the finishing cutter.
+	Cutter Cutter
+	// StockMin and StockMax are the corners of the bounding box of the
+	// stock, which limits the toolpaths. The tip of the cutter never goes
+	// below StockMin. If they are equal, the bounds of the mesh are used.
+	StockMin, StockMax Tuple
+	// Stepover is the distance between passes.
+	// Default is 10% of the cutter diameter.
+	Stepover *float64
+	// Tolerance is the maximum deviation of the toolpath from the
+	// surface found by dropping the cutter. Default is 0.01.
+	Tolerance *float64
+	// SafeZ is the Z for rapid moves. Default is 5 above StockMax.
+	SafeZ *float64
+	// Feedrate, if non-nil, sets the feedrate of the passes.
+	Feedrate *float64
+}
+
+// dropCutterSetup holds the resolved options of a drop-cutter operation.
+type dropCutterSetup struct {
+	c                  *Cutter
+	stockMin, stockMax Tuple
+	stepover, tol      float64
+	sample             float64 // distance between drop-cutter samples.
+	safeZ              float64
+}
+
+func (o *DropCutterOptions) setup(m *Mesh) *dropCutterSetup {
+	if o == nil {
+		log.Fatal("drop-cutter options are required")
+	}
+	c := &o.Cutter
+	c.check()
+	s := &dropCutterSetup{c: c, stockMin: o.StockMin, stockMax: o.StockMax}
+	if s.stockMin.Equal(s.stockMax) {
+		s.stockMin, s.stockMax = m.Bounds()
+	}
+	s.stepover = getFloat(o.Stepover, defaultDropCutterStepover*c.Diameter)
+	s.tol = getFloat(o.Tolerance, defaultDropCutterTolerance)
+	if s.stepover <= 0 || s.tol <= 0 {
+		log.Fatalf("invalid stepover %v or tolerance %v", s.stepover, s.tol)
+	}
+	s.sample = math.Max(math.Min(s.stepover, c.Radius()/2), s.tol)
+	s.safeZ = getFloat(o.SafeZ, s.stockMax.Z()+defaultSafeHeight)
+	return s
+}
+
+// RasterFinish finishes the mesh with a zigzag of parallel passes along X
+// over the stock, stepover apart. The Z of the cutter along each pass is
+// found by dropping the cutter onto the mesh (drop-cutter), sampling the
+// pass finely enough to stay within the tolerance.
+func RasterFinish(g *GCode, m *Mesh, opts *DropCutterOptions) {
+	s := opts.setup(m)
+	drop := func(x, y float64) float64 {
+		return math.Max(m.dropCutter(s.c, x, y), s.stockMin.Z())
+	}
+
+	g.Comment("-- raster_finish ", len(m.Triangles), " triangles --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+
+	path := reliefRaster(s.stockMax.X()-s.stockMin.X(), s.stockMax.Y()-s.stockMin.Y(), s.stepover, s.sample)
+	var points []Tuple
+	for _, p := range path {
+		x, y := s.stockMin.X()+p.X(), s.stockMin.Y()+p.Y()
+		q := XYZ(x, y, drop(x, y))
+		if len(points) > 0 {
+			points = append(points, refineDrop(points[len(points)-1], q, drop, s.tol, maxRefineDepth)...)
+		}
+		points = append(points, q)
+	}
+	points = simplifyTolerance(points, s.tol)
+
+	g.GotoZ(Z(s.safeZ))
+	g.GotoXY(points[0])
+	g.MoveZ(points[0])
+	g.MoveXYZ(points[1:]...)
+	g.GotoZ(Z(s.safeZ))
+
+	g.Comment("-- end raster_finish --")
+}
+
+// WaterlineFinish finishes the mesh with closed passes at constant Z,
+// stepDown apart from the top of the mesh down to the bottom of the
+// stock, following the contours at which the cutter touches the mesh.
+func WaterlineFinish(g *GCode, m *Mesh, stepDown float64, opts *DropCutterOptions) {
+	if stepDown <= 0 {
+		log.Fatalf("invalid stepDown %v", stepDown)
+	}
+	s := opts.setup(m)
+	_, meshMax := m.Bounds()
+
+	g.Comment("-- waterline_finish ", len(m.Triangles), " triangles --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+	g.GotoZ(Z(s.safeZ))
+
+	w := newWaterlineGrid(m, s)
+	for level := math.Min(meshMax.Z(), s.stockMax.Z()) - stepDown; level >= s.stockMin.Z()-epsilon; level -= stepDown {
+		for _, loop := range w.contours(level) {
+			loop = simplifyTolerance(loop, s.tol)
+			g.GotoXY(loop[0])
+			g.MoveZ(Z(level))
+			for _, p := range loop[1:] {
+				g.MoveXYZ(XYZ(p.X(), p.Y(), level))
+			}
+			g.GotoZ(Z(s.safeZ))
+		}
+	}
+
+	g.Comment("-- end waterline_finish --")
+}
+
+// refineDrop returns the points between a and b needed to follow the
+// surface given by drop within tol.
+func refineDrop(a, b Tuple, drop func(x, y float64) float64, tol float64, depth int) []Tuple {
+	if depth == 0 || math.Hypot(b.X()-a.X(), b.Y()-a.Y()) <= tol {
+		return nil
+	}
+	x, y := (a.X()+b.X())/2, (a.Y()+b.Y())/2
+	mid := XYZ(x, y, drop(x, y))
+	if math.Abs(mid.Z()-(a.Z()+b.Z())/2) <= tol {
+		return nil
+	}
+	result := append(refineDrop(a, mid, drop, tol, depth-1), mid)
+	return append(result, refineDrop(mid, b, drop, tol, depth-1)...)
+}
+
+// simplifyTolerance removes the points of path that are within tol of
+// the simplified path (Douglas-Peucker).
+func simplifyTolerance(path []Tuple, tol float64) []Tuple {
+	if len(path) < 3 {
+		return path
+	}
+	a, b := path[0], path[len(path)-1]
+	worst, index := 0.0, 0
+	for i := 1; i < len(path)-1; i++ {
+		if d := segmentDistance(path[i], a, b); d > worst {
+			worst, index = d, i
+		}
+	}
+	if worst <= tol {
+		return []Tuple{a, b}
+	}
+	left := simplifyTolerance(path[:index+1], tol)
+	return append(left[:len(left)-1], simplifyTolerance(path[index:], tol)...)
+}
+
+// segmentDistance returns the distance from p to the segment from a to b.
+func segmentDistance(p, a, b Tuple) float64 {
+	ab := b.Sub(a)
+	t := 0.0
+	if l := ab.Dot(ab); l > 0 {
+		t = math.Max(0, math.Min(1, p.Sub(a).Dot(ab)/l))
+	}
+	return p.Sub(a.Add(ab.MultScalar(t))).Magnitude()
+}
+
+// bvhNode represents a node of a bounding volume hierarchy of the XY
+// bounds of the triangles of a mesh.
+type bvhNode struct {
+	minX, minY, maxX, maxY, maxZ float64
+	left, right                  *bvhNode
+	tris                         []int // triangles of a leaf.
+}
+
+// index returns the bounding volume hierarchy of the mesh.
+func (m *Mesh) index() *bvhNode {
+	if m.bvh == nil {
+		tris := make([]int, len(m.Triangles))
+		centroids := make([][2]float64, len(m.Triangles))
+		for i, t := range m.Triangles {
+			tris[i] = i
+			centroids[i] = [2]float64{(t[0].X() + t[1].X() + t[2].X()) / 3, (t[0].Y() + t[1].Y() + t[2].Y()) / 3}
+		}
+		m.bvh = m.buildBVH(tris, centroids)
+	}
+	return m.bvh
+}
+
+// buildBVH returns the node of the triangles tris, which are split
+// at the median of their centroids along the longer axis of the node.
+func (m *Mesh) buildBVH(tris []int, centroids [][2]float64) *bvhNode {
+	inf := math.Inf(1)
+	n := &bvhNode{minX: inf, minY: inf, maxX: -inf, maxY: -inf, maxZ: -inf}
+	for _, i := range tris {
+		for _, v := range m.Triangles[i] {
+			n.minX, n.maxX = math.Min(n.minX, v.X()), math.Max(n.maxX, v.X())
+			n.minY, n.maxY = math.Min(n.minY, v.Y()), math.Max(n.maxY, v.Y())
+			n.maxZ = math.Max(n.maxZ, v.Z())
+		}
+	}
+	if len(tris) <= bvhLeafSize {
+		n.tris = tris
+		return n
+	}
+	axis := 0
+	if n.maxY-n.minY > n.maxX-n.minX {
+		axis = 1
+	}
+	sort.Slice(tris, func(a, b int) bool { return centroids[tris[a]][axis] < centroids[tris[b]][axis] })
+	mid := len(tris) / 2
+	n.left, n.right = m.buildBVH(tris[:mid], centroids), m.buildBVH(tris[mid:], centroids)
+	return n
+}
+
+// dropCutter returns the highest Z of the tip of the cutter at (x, y)
+// at which it touches the mesh, or -Inf if it misses the mesh.
+func (m *Mesh) dropCutter(c *Cutter, x, y float64) float64 {
+	r := c.Radius()
+	z := math.Inf(-1)
+	var visit func(n *bvhNode)
+	visit = func(n *bvhNode) {
+		// The cutter can not touch a node below the current Z.
+		if n.maxZ <= z || n.minX > x+r || n.maxX < x-r || n.minY > y+r || n.maxY < y-r {
+			return
+		}
+		for _, i := range n.tris {
+			z = math.Max(z, dropTriangle(c, m.Triangles[i], x, y))
+		}
+		if n.left != nil {
+			visit(n.left)
+			visit(n.right)
+		}
+	}
+	visit(m.index())
+	return z
+}
+
+// dropTriangle returns the highest Z of the tip of the cutter at (x, y)
+// at which it touches the vertices, edges, or facet of the triangle.
+func dropTriangle(c *Cutter, t Triangle, x, y float64) float64 {
+	r := c.Radius()
+	z := math.Inf(-1)
+	for _, v := range t {
+		if d := math.Hypot(v.X()-x, v.Y()-y); d <= r {
+			z = math.Max(z, v.Z()-c.Profile(d))
+		}
+	}
+	for k := range t {
+		z = math.Max(z, dropEdge(c, t[k], t[(k+1)%3], x, y))
+	}
+	return math.Max(z, dropFacet(c, t, x, y))
+}
+
+// dropEdge returns the highest Z of the tip of the cutter at (x, y) at
+// which it touches the edge from p1 to p2. Since the height of the
+// contact along the edge is concave for all cutters, its maximum is
+// found with a golden section search.
+func dropEdge(c *Cutter, p1, p2 Tuple, x, y float64) float64 {
+	r := c.Radius()
+	dx, dy := p2.X()-p1.X(), p2.Y()-p1.Y()
+	a := dx*dx + dy*dy
+	if a < epsilon {
+		return math.Inf(-1) // vertical edges touch at their vertices.
+	}
+	fx, fy := p1.X()-x, p1.Y()-y
+	b := 2 * (dx*fx + dy*fy)
+	disc := b*b - 4*a*(fx*fx+fy*fy-r*r)
+	if disc < 0 {
+		return math.Inf(-1)
+	}
+	sq := math.Sqrt(disc)
+	t0, t1 := math.Max(0, (-b-sq)/(2*a)), math.Min(1, (-b+sq)/(2*a))
+	if t0 > t1 {
+		return math.Inf(-1)
+	}
+	f := func(t float64) float64 {
+		d := math.Min(math.Hypot(fx+t*dx, fy+t*dy), r)
+		return p1.Z() + t*(p2.Z()-p1.Z()) - c.Profile(d)
+	}
+	lo, hi := t0, t1
+	for i := 0; i < edgeSearchIterations; i++ {
+		m1, m2 := hi-(hi-lo)/math.Phi, lo+(hi-lo)/math.Phi
+		if f(m1) < f(m2) {
+			lo = m1
+		} else {
+			hi = m2
+		}
+	}
+	return math.Max(f((lo+hi)/2), math.Max(f(t0), f(t1)))
+}
+
+// dropFacet returns the highest Z of the tip of the cutter at (x, y) at
+// which it touches the interior of the triangle, or -Inf if the cutter
+// touches its plane outside of the triangle.
+func dropFacet(c *Cutter, t Triangle, x, y float64) float64 {
+	n := t[1].Sub(t[0]).Cross(t[2].Sub(t[0]))
+	if mag := n.Magnitude(); mag > 0 {
+		n = n.DivScalar(mag)
+	}
+	if n.Z() < 0 {
+		n = XYZ(-n.X(), -n.Y(), -n.Z())
+	}
+	if n.Z() < epsilon {
+		return math.Inf(-1) // vertical facets touch at their edges.
+	}
+	planeZ := func(px, py float64) float64 {
+		return t[0].Z() - (n.X()*(px-t[0].X())+n.Y()*(py-t[0].Y()))/n.Z()
+	}
+
+	// u is the horizontal direction up the slope of the facet.
+	var ux, uy float64
+	nxy := math.Hypot(n.X(), n.Y())
+	if nxy > epsilon {
+		ux, uy = -n.X()/nxy, -n.Y()/nxy
+	}
+
+	var px, py, z float64
+	if c.Shape == CutterV {
+		// The cone touches with its tip or with its rim.
+		r, cone := c.Radius(), 1/math.Tan(ToRad(c.Angle/2))
+		if nxy/n.Z() <= cone {
+			px, py = x, y
+			z = planeZ(px, py)
+		} else {
+			px, py = x+r*ux, y+r*uy
+			z = planeZ(px, py) - r*cone
+		}
+	} else {
+		// The torus touches at the point of its corner facing the facet.
+		a, cr := c.torus()
+		px, py = x+a*ux-cr*n.X(), y+a*uy-cr*n.Y()
+		z = planeZ(px, py) - cr*(1-n.Z())
+	}
+	if !insideTriangleXY(t, px, py) {
+		return math.Inf(-1)
+	}
+	return z
+}
+
+// insideTriangleXY reports whether (x, y) is inside the XY projection
+// of the triangle.
+func insideTriangleXY(t Triangle, x, y float64) bool {
+	d := (t[1].Y()-t[2].Y())*(t[0].X()-t[2].X()) + (t[2].X()-t[1].X())*(t[0].Y()-t[2].Y())
+	if math.Abs(d) < epsilon {
+		return false
+	}
+	l0 := ((t[1].Y()-t[2].Y())*(x-t[2].X()) + (t[2].X()-t[1].X())*(y-t[2].Y())) / d
+	l1 := ((t[2].Y()-t[0].Y())*(x-t[2].X()) + (t[0].X()-t[2].X())*(y-t[2].Y())) / d
+	return l0 >= -epsilon && l1 >= -epsilon && 1-l0-l1 >= -epsilon
+}
+
+// waterlineGrid represents the Z of the cutter dropped onto a mesh
+// at the nodes of a grid over the stock.
+type waterlineGrid struct {
+	m      *Mesh
+	s      *dropCutterSetup
+	nx, ny int
+	z      [][]float64 // z[j][i] is the Z at node (i, j).
+}
+
+func newWaterlineGrid(m *Mesh, s *dropCutterSetup) *waterlineGrid {
+	w := &waterlineGrid{m: m, s: s}
+	w.nx = int(math.Ceil((s.stockMax.X() - s.stockMin.X()) / s.sample))
+	w.ny = int(math.Ceil((s.stockMax.Y() - s.stockMin.Y()) / s.sample))
+	w.z = make([][]float64, w.ny+1)
+	for j := range w.z {
+		w.z[j] = make([]float64, w.nx+1)
+		for i := range w.z[j] {
+			p := w.node(i, j)
+			w.z[j][i] = m.dropCutter(s.c, p.X(), p.Y())
+		}
+	}
+	return w
+}
+
+// node returns the XY position of node (i, j).
+func (w *waterlineGrid) node(i, j int) Tuple {
+	min, max := w.s.stockMin, w.s.stockMax
+	return XY(min.X()+(max.X()-min.X())*float64(i)/float64(w.nx), min.Y()+(max.Y()-min.Y())*float64(j)/float64(w.ny))
+}
+
+// contours returns the closed (or open, at the edge of the stock)
+// contours of the grid at which the dropped cutter is at level.
+func (w *waterlineGrid) contours(level float64) [][]Tuple {
+	var result [][]Tuple
+	for _, chain := range marchingSquares(w.z, level) {
+		var loop []Tuple
+		for _, e := range chain {
+			loop = append(loop, w.crossing(e, level))
+		}
+		result = append(result, loop)
+	}
+	return result
+}
+
+// crossing returns the point on the edge at which the dropped cutter
+// is at level, found by bisection within the tolerance.
+func (w *waterlineGrid) crossing(e gridEdge, level float64) Tuple {
+	i1, j1 := e.end()
+	in, out := w.node(e.i, e.j), w.node(i1, j1)
+	if w.z[e.j][e.i] < level {
+		in, out = out, in
+	}
+	for in.Sub(out).Magnitude() > w.s.tol {
+		mid := in.Add(out).DivScalar(2)
+		if w.m.dropCutter(w.s.c, mid.X(), mid.Y()) >= level {
+			in = mid
+		} else {
+			out = mid
+		}
+	}
+	return in.Add(out).DivScalar(2)
+}
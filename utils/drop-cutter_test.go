@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+// square returns a mesh of the square from (x0, y0) to (x1, y1) whose
+// Z increases by slope along X from z at x0.
+func square(x0, y0, x1, y1, z, slope float64) *Mesh {
+	z1 := z + slope*(x1-x0)
+	return &Mesh{Triangles: []Triangle{
+		{XYZ(x0, y0, z), XYZ(x1, y0, z1), XYZ(x1, y1, z1)},
+		{XYZ(x0, y0, z), XYZ(x1, y1, z1), XYZ(x0, y1, z)},
+	}}
+}
+
+func TestMeshDropCutter(t *testing.T) {
+	flat := square(-10, -10, 0, 10, 1, 0)
+	ramp := square(-10, -10, 10, 10, 0, 1)
+	tests := []struct {
+		name   string
+		m      *Mesh
+		cutter Cutter
+		x      float64
+		want   float64
+	}{
+		{"flat facet", flat, Cutter{Shape: CutterBall, Diameter: 2}, -5, 1},
+		{"flat edge", flat, Cutter{Shape: CutterFlat, Diameter: 2}, 0.5, 1},
+		{"ball edge", flat, Cutter{Shape: CutterBall, Diameter: 2}, 0.5, 1 - (1 - math.Sqrt(0.75))},
+		{"bull-nose edge", flat, Cutter{Shape: CutterBullNose, Diameter: 2, CornerRadius: 0.5}, 0.5, 1},
+		{"bull-nose corner", flat, Cutter{Shape: CutterBullNose, Diameter: 2, CornerRadius: 0.5}, 0.75, 1 - (0.5 - math.Sqrt(0.1875))},
+		{"V edge", flat, Cutter{Shape: CutterV, Diameter: 2, Angle: 90}, 0.5, 0.5},
+		{"missed", flat, Cutter{Shape: CutterFlat, Diameter: 2}, 1.5, math.Inf(-1)},
+		{"flat ramp", ramp, Cutter{Shape: CutterFlat, Diameter: 2}, 0, 11},
+		{"ball ramp", ramp, Cutter{Shape: CutterBall, Diameter: 2}, 0, 10 + math.Sqrt2 - 1},
+		{"bull-nose ramp", ramp, Cutter{Shape: CutterBullNose, Diameter: 2, CornerRadius: 0.5}, 0, 10.5 + 0.5*(math.Sqrt2-1)},
+		{"V ramp", ramp, Cutter{Shape: CutterV, Diameter: 2, Angle: 90}, 0, 10},
+		{"V steep", square(-10, -10, 10, 10, -10, 2), Cutter{Shape: CutterV, Diameter: 2, Angle: 90}, 0, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.m.dropCutter(&tt.cutter, tt.x, 0)
+			if math.Abs(got-tt.want) > 1e-6 && got != tt.want {
+				t.Errorf("dropCutter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRasterFinish(t *testing.T) {
+	g := New(NoHeader)
+	RasterFinish(g, square(0, 0, 2, 1, 1, 0), &DropCutterOptions{
+		Cutter:   Cutter{Shape: CutterFlat, Diameter: 1},
+		StockMin: XYZ(0, 0, 0), StockMax: XYZ(2, 1, 1),
+		Stepover: Float(1), SafeZ: Float(3),
+	})
+	want := `(-- raster_finish 2 triangles --)
+G0 Z3.00000000
+G1 Z1.00000000
+G1 X2.00000000
+G1 Y1.00000000
+G1 X0.00000000
+G0 Z3.00000000
+(-- end raster_finish --)
+`
+	if got := g.String(); got != want {
+		t.Errorf("RasterFinish =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestWaterlineContours(t *testing.T) {
+	// A box from (0, 0) to (2, 2) with its top at Z=1.
+	m := square(0, 0, 2, 2, 1, 0)
+	s := (&DropCutterOptions{
+		Cutter:   Cutter{Shape: CutterFlat, Diameter: 1},
+		StockMin: XYZ(-1, -1, 0), StockMax: XYZ(3, 3, 1),
+	}).setup(m)
+	loops := newWaterlineGrid(m, s).contours(0.5)
+	if len(loops) != 1 {
+		t.Fatalf("contours returned %v loops, want 1", len(loops))
+	}
+	loop := loops[0]
+	if !loop[0].Equal(loop[len(loop)-1]) {
+		t.Errorf("loop is not closed: %v .. %v", loop[0], loop[len(loop)-1])
+	}
+	for _, p := range loop {
+		// The flat cutter touches the box within its radius.
+		dx, dy := math.Max(0, math.Max(-p.X(), p.X()-2)), math.Max(0, math.Max(-p.Y(), p.Y()-2))
+		if d := math.Hypot(dx, dy); math.Abs(d-0.5) > 2*s.tol {
+			t.Errorf("contour point %v is %v from the box, want 0.5", p, d)
+		}
+	}
+}
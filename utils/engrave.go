@@ -17,9 +17,20 @@ import (
 // pen-up/down, where 0.0 means pen-down and larger than 0.0 means pen-up (1.0
 // is returned from the typeset() function). The pen movement is always in a
 // single vector, as in: [-, -, penpos].
+//
+// In laser mode (see LaserMode), Z is not moved and the laser is switched
+// off for pen-up and on for pen-down movements instead.
 func Engrave(g *GCode, vs []Tuple, zUp, zDown float64) {
 	for _, v := range vs {
 		up := v.Z() > 0.0
+		if g.IsLaserMode() {
+			if up {
+				g.GotoXY(v)
+			} else {
+				g.MoveXY(v)
+			}
+			continue
+		}
 		if up {
 			g.GotoXYZ(XYZ(v.X(), v.Y(), zUp))
 		} else {
@@ -27,3 +38,24 @@ func Engrave(g *GCode, vs []Tuple, zUp, zDown float64) {
 		}
 	}
 }
+
+// SplitPaths splits a vector list (possibly from Typeset function) into
+// its pen-down paths, as used by VCarve.
+func SplitPaths(vs []Tuple) [][]Tuple {
+	var paths [][]Tuple
+	var path []Tuple
+	for _, v := range vs {
+		if v.Z() > 0.0 {
+			if len(path) > 0 {
+				paths = append(paths, path)
+			}
+			path = nil
+			continue
+		}
+		path = append(path, XY(v.X(), v.Y()))
+	}
+	if len(path) > 0 {
+		paths = append(paths, path)
+	}
+	return paths
+}
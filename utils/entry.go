@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultEntryRampAngle = 3    // degrees
+	minHelixFraction      = 0.25 // smallest helix tried, as a fraction of HelixRadius
+	entryFitSamples       = 16   // samples checked along a helix or ramp
+)
+
+// EntryT represents the way a tool enters the material.
+type EntryT string
+
+const (
+	EntryPlunge     EntryT = ""            // straight plunge
+	EntryHelix      EntryT = "helix"       // helical descent ending at the entry point
+	EntryRamp       EntryT = "ramp"        // zigzag ramp along the first segment
+	EntryPreDrilled EntryT = "pre-drilled" // plunge into the nearest pre-drilled hole
+)
+
+// EntryOptions represents how an operation enters the material.
+type EntryOptions struct {
+	// Mode selects the entry. Default is EntryPlunge.
+	// Helices that do not fit fall back to ramps, and ramps that do not
+	// fit fall back to plunges.
+	Mode EntryT
+	// StartZ is the Z of the top of the material, to which the tool
+	// rapids before entering. Default is the Z before the entry.
+	StartZ *float64
+	// HelixRadius is the radius of the helix followed by the center of
+	// the tool. Smaller helices are tried if it does not fit.
+	// Default is half the tool radius, if the operation knows it.
+	HelixRadius *float64
+	// Pitch is the maximum descent per turn of the helix.
+	// Default follows MaxRampAngle.
+	Pitch *float64
+	// MaxRampAngle is the maximum angle in degrees of the descent
+	// along ramps and helices. Default is 3.
+	MaxRampAngle *float64
+	// Holes are the centers of the pre-drilled holes for EntryPreDrilled.
+	// The tool enters at the nearest hole and moves to the entry point.
+	Holes []Tuple
+}
+
+// enter moves the tool down to p using the entry strategy, where next is
+// the next point of the cut, toolRadius is the radius of the tool (or 0
+// if unknown), and fits (if non-nil) reports whether the center of the
+// tool may be at a point below StartZ.
+func enter(g *GCode, p, next Tuple, toolRadius float64, opts *EntryOptions, fits func(Tuple) bool) {
+	if opts == nil {
+		opts = &EntryOptions{}
+	}
+	if fits == nil {
+		fits = func(Tuple) bool { return true }
+	}
+	xy, z := XY(p.X(), p.Y()), p.Z()
+	startZ := getFloat(opts.StartZ, g.Position().Z())
+	angle := getFloat(opts.MaxRampAngle, defaultEntryRampAngle)
+	if angle <= 0 || angle >= 90 {
+		log.Fatalf("invalid MaxRampAngle %v", angle)
+	}
+	slope := math.Tan(ToRad(angle))
+	dir := XY(next.X()-p.X(), next.Y()-p.Y())
+	length := dir.Magnitude()
+	if length > epsilon {
+		dir = dir.Normalize()
+	} else {
+		dir = X(1)
+	}
+
+	descend := func() {
+		if startZ < g.Position().Z() {
+			g.GotoZ(Z(startZ))
+		}
+	}
+
+	mode := opts.Mode
+	if z >= startZ {
+		mode = EntryPlunge // not entering the material
+	}
+	switch mode {
+	case EntryPlunge:
+	case EntryHelix:
+		radius := toolRadius / 2
+		if opts.HelixRadius != nil {
+			radius = *opts.HelixRadius
+		}
+		if radius <= 0 {
+			log.Fatal("helix entry requires a positive HelixRadius")
+		}
+		for r := radius; r >= minHelixFraction*radius; r /= 2 {
+			if c, ok := helixCenter(xy, dir, r, fits); ok {
+				pitch := getFloat(opts.Pitch, 2*math.Pi*r*slope)
+				if pitch <= 0 {
+					log.Fatalf("invalid Pitch %v", pitch)
+				}
+				g.GotoXY(xy)
+				descend()
+				helixEntry(g, xy, c, r, startZ, z, pitch)
+				return
+			}
+		}
+		log.Printf("WARNING: helix entry does not fit at %v, ramping instead", xy)
+		fallthrough
+	case EntryRamp:
+		if length > epsilon && segmentFits(xy, next, fits) {
+			g.GotoXY(xy)
+			descend()
+			rampEntry(g, xy, XY(next.X(), next.Y()), startZ, z, slope)
+			return
+		}
+		log.Printf("WARNING: ramp entry does not fit at %v, plunging instead", xy)
+	case EntryPreDrilled:
+		if len(opts.Holes) == 0 {
+			log.Fatal("pre-drilled entry requires Holes")
+		}
+		hole := opts.Holes[0]
+		for _, h := range opts.Holes[1:] {
+			if h.Sub(xy).Magnitude() < hole.Sub(xy).Magnitude() {
+				hole = h
+			}
+		}
+		g.GotoXY(hole)
+		descend()
+		g.MoveZ(Z(z))
+		g.MoveXY(xy)
+		return
+	default:
+		log.Fatalf("unknown entry mode %q", opts.Mode)
+	}
+	g.GotoXY(xy)
+	descend()
+	g.MoveZ(Z(z))
+}
+
+// helixCenter returns the center of a helix of radius r ending at p,
+// preferably leaving p in the direction dir, that fits.
+func helixCenter(p, dir Tuple, r float64, fits func(Tuple) bool) (Tuple, bool) {
+	// A clockwise helix centered on the right of dir leaves p along dir.
+	right := XY(dir.Y(), -dir.X())
+	for _, side := range []Tuple{right, dir.Negate(), dir, right.Negate()} {
+		c := p.Add(side.MultScalar(r))
+		ok := true
+		for k := 0; ok && k < entryFitSamples; k++ {
+			angle := 2 * math.Pi * float64(k) / entryFitSamples
+			ok = fits(c.Add(XY(r*math.Cos(angle), r*math.Sin(angle))))
+		}
+		if ok {
+			return c, true
+		}
+	}
+	return Tuple{}, false
+}
+
+// helixEntry descends from startZ to z along a clockwise helix around c
+// starting and ending at p, and then cleans its floor with a full circle.
+func helixEntry(g *GCode, p, c Tuple, r, startZ, z, pitch float64) {
+	turns := math.Max(1, math.Ceil((startZ-z)/pitch-epsilon))
+	drop := (startZ - z) / turns
+	opposite := c.Add(c.Sub(p))
+	for k := 1; k <= int(turns); k++ {
+		level := startZ - float64(k)*drop
+		g.ArcCW(XYZ(opposite.X(), opposite.Y(), level+drop/2), r, nil)
+		g.ArcCW(XYZ(p.X(), p.Y(), level), r, nil)
+	}
+	g.ArcCW(XYZ(opposite.X(), opposite.Y(), z), r, nil)
+	g.ArcCW(XYZ(p.X(), p.Y(), z), r, nil)
+}
+
+// segmentFits reports whether all the points from p0 to p1 fit.
+func segmentFits(p0, p1 Tuple, fits func(Tuple) bool) bool {
+	v := XY(p1.X()-p0.X(), p1.Y()-p0.Y())
+	for k := 0; k <= entryFitSamples; k++ {
+		if !fits(p0.Add(v.MultScalar(float64(k) / entryFitSamples))) {
+			return false
+		}
+	}
+	return true
+}
+
+// rampEntry descends from startZ to z zigzagging between p and q with
+// at most slope, ending at p.
+func rampEntry(g *GCode, p, q Tuple, startZ, z, slope float64) {
+	length := q.Sub(p).Magnitude()
+	// An even number of legs ends the ramp at p.
+	legs := 2 * math.Max(1, math.Ceil((startZ-z)/(2*length*slope)-epsilon))
+	drop := (startZ - z) / legs
+	for k := 1; k <= int(legs); k++ {
+		level := startZ - float64(k)*drop
+		to := p
+		if k%2 == 1 {
+			to = q
+		}
+		g.MoveXYZ(XYZ(to.X(), to.Y(), level))
+	}
+}
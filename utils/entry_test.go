@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestTracePathWithEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *EntryOptions
+		want  string
+	}{
+		{
+			name: "plunge",
+			want: `G1 Z-1.50000000
+`,
+		},
+		{
+			name:  "helix",
+			entry: &EntryOptions{Mode: EntryHelix, HelixRadius: Float(1), Pitch: Float(1), StartZ: Float(0)},
+			want: `G0 Z0.00000000
+G2 X0.00000000 Y-2.00000000 Z-0.37500000 I0.00000000 J-1.00000000
+G2 X0.00000000 Y0.00000000 Z-0.75000000 I0.00000000 J1.00000000
+G2 X0.00000000 Y-2.00000000 Z-1.12500000 I0.00000000 J-1.00000000
+G2 X0.00000000 Y0.00000000 Z-1.50000000 I0.00000000 J1.00000000
+G2 X0.00000000 Y-2.00000000 I0.00000000 J-1.00000000
+G2 X0.00000000 Y0.00000000 I0.00000000 J1.00000000
+`,
+		},
+		{
+			name:  "ramp",
+			entry: &EntryOptions{Mode: EntryRamp, MaxRampAngle: Float(10), StartZ: Float(0)},
+			want: `G0 Z0.00000000
+G1 X10.00000000 Z-0.75000000
+G1 X0.00000000 Z-1.50000000
+`,
+		},
+		{
+			name:  "pre-drilled",
+			entry: &EntryOptions{Mode: EntryPreDrilled, Holes: []Tuple{XY(-5, -5), XY(1, -1)}},
+			want: `G0 X1.00000000 Y-1.00000000
+G1 Z-1.50000000
+G1 X0.00000000 Y0.00000000
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(NoHeader)
+			g.GotoZ(Z(5))
+			TracePathWithEntry(g, -1.5, -1, tt.entry, XY(0, 0), XY(10, 0), XY(10, 10))
+			want := "G0 Z5.00000000\n(-- tracepath at Z=-1.5 --)\n" + tt.want + `G1 X10.00000000
+G1 Y10.00000000
+G1 X0.00000000 Y0.00000000
+G1 Z5.00000000
+(-- tracepath end --)
+`
+			if got := g.String(); got != want {
+				t.Errorf("TracePathWithEntry =\n%v\nwant:\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestCCHoleWithEntry(t *testing.T) {
+	// The helix shrinks to fit in the hole.
+	g := New(NoHeader)
+	g.GotoZ(Z(5))
+	CCHoleWithEntry(g, XY(0, 0), 3, 2, 0.5, -1, &EntryOptions{Mode: EntryHelix, StartZ: Float(0)})
+	if want := "G2 X-1.00000000 Y0.00000000 Z-0.07142857 I-0.50000000 J0.00000000\n"; !strings.Contains(g.String(), want) {
+		t.Errorf("CCHoleWithEntry =\n%v\nwant helix of radius 0.5", g)
+	}
+
+	// Without room for a helix, it ramps along the first cut.
+	g = New(NoHeader)
+	g.GotoZ(Z(5))
+	CCHoleWithEntry(g, XY(0, 0), 3, 2.9, 0.05, -0.01, &EntryOptions{Mode: EntryHelix, StartZ: Float(0)})
+	if want := "G0 Z0.00000000\nG1 Y-0.10000000 Z-0.00500000\nG1 Y0.00000000 Z-0.01000000\n"; !strings.Contains(g.String(), want) {
+		t.Errorf("CCHoleWithEntry =\n%v\nwant ramp", g)
+	}
+}
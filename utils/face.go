@@ -0,0 +1,378 @@
+package utils
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultFaceStepover  = 70  // percent of the tool diameter
+	defaultFaceOverrun   = 0.1 // fraction of the tool diameter
+	defaultFaceClearance = 1.0 // mm
+	faceResolution       = 20  // grid cells across the tool diameter
+)
+
+// FaceStrategyT represents the order of the passes of Face.
+type FaceStrategyT string
+
+const (
+	FaceZigzag FaceStrategyT = ""        // passes along X in alternating directions
+	FaceOneWay FaceStrategyT = "one-way" // climb passes along X, returning above the stock
+	FaceSpiral FaceStrategyT = "spiral"  // climb passes around the boundary, from the outside in
+)
+
+// FaceOptions represents options for the Face function.
+type FaceOptions struct {
+	// ToolDiameter is the diameter of the face mill or end mill.
+	ToolDiameter float64
+	// Depth is the total depth removed below Top.
+	Depth float64
+	// Top is the Z of the top of the stock. Default is 0.
+	Top *float64
+	// StepDown is the maximum depth of each pass. Default is Depth.
+	StepDown *float64
+	// Stepover is the distance between passes in percent of the tool
+	// diameter. Default is 70.
+	Stepover *float64
+	// Strategy is the order of the passes. Default is FaceZigzag.
+	Strategy FaceStrategyT
+	// Overrun is the distance the edge of the tool passes beyond the
+	// boundary at the ends of the passes and on the leads.
+	// Default is 10% of the tool diameter.
+	Overrun *float64
+	// Clearance is the height above Top of the retracts between passes.
+	// Default is 1.
+	Clearance *float64
+	// SafeZ is the Z of the rapids before and after facing.
+	// Default is 5 above Top.
+	SafeZ *float64
+	// Resolution is the size of the grid cells used to offset the
+	// boundary for FaceSpiral. Default is 1/20th of the tool diameter.
+	Resolution *float64
+	// Feedrate, if set, is the feedrate of the cuts.
+	Feedrate *float64
+}
+
+// FaceRect faces the rectangle from min to max in XY.
+func FaceRect(g *GCode, min, max Tuple, opts *FaceOptions) {
+	Face(g, []Tuple{XY(min.X(), min.Y()), XY(max.X(), min.Y()), XY(max.X(), max.Y()), XY(min.X(), max.Y())}, opts)
+}
+
+// Face surfaces the top of the stock inside the closed boundary down
+// to Depth below Top, in passes of at most StepDown.
+//
+// The tool enters each pass outside of the boundary by Overrun and
+// feeds in. Zigzag passes step over outside of the boundary, while
+// one-way passes retract to Clearance above Top and return. Spiral
+// passes follow the offsets of the boundary inward, stepping over
+// with a straight move to the next offset, then cut the middles left
+// by the last offsets along the medial axis of the boundary.
+func Face(g *GCode, boundary []Tuple, opts *FaceOptions) {
+	if opts == nil || opts.ToolDiameter <= 0 {
+		log.Fatal("Face: ToolDiameter must be positive")
+	}
+	if len(boundary) < 3 {
+		log.Fatal("Face: boundary must have at least 3 points")
+	}
+	if opts.Depth < 0 {
+		log.Fatalf("invalid Depth %v", opts.Depth)
+	}
+	d := opts.ToolDiameter
+	stepover := getFloat(opts.Stepover, defaultFaceStepover)
+	if stepover <= 0 || stepover > 100 {
+		log.Fatalf("invalid Stepover %v", stepover)
+	}
+	top := getFloat(opts.Top, 0)
+	f := &facer{
+		g:        g,
+		radius:   d / 2,
+		step:     stepover / 100 * d,
+		overrun:  getFloat(opts.Overrun, defaultFaceOverrun*d),
+		retractZ: top + getFloat(opts.Clearance, defaultFaceClearance),
+		res:      getFloat(opts.Resolution, d/faceResolution),
+	}
+	if f.overrun < 0 || f.res <= 0 || f.retractZ <= top {
+		log.Fatalf("invalid Overrun %v, Resolution %v or Clearance %v", f.overrun, f.res, f.retractZ-top)
+	}
+	for _, p := range boundary {
+		f.boundary = append(f.boundary, XY(p.X(), p.Y()))
+	}
+	safeZ := math.Max(getFloat(opts.SafeZ, top+defaultSafeHeight), f.retractZ)
+	depth := &DepthOptions{StepDown: getFloat(opts.StepDown, math.Max(opts.Depth, epsilon)), Top: &top}
+	_, levels := depth.levels(top - opts.Depth)
+
+	g.Comment("-- face strategy=", opts.Strategy, " diameter=", d, " depth=", opts.Depth, " --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+	g.GotoZ(Z(safeZ))
+	for _, z := range levels {
+		switch opts.Strategy {
+		case FaceZigzag, FaceOneWay:
+			f.raster(z, opts.Strategy == FaceOneWay)
+		case FaceSpiral:
+			f.spiral(z)
+		default:
+			log.Fatalf("unknown face strategy %q", opts.Strategy)
+		}
+		f.down = false
+	}
+	g.GotoZ(Z(safeZ))
+	g.Comment("-- end face --")
+}
+
+// facer holds the state of a facing operation.
+type facer struct {
+	g        *GCode
+	boundary []Tuple
+	radius   float64
+	step     float64
+	overrun  float64
+	retractZ float64
+	res      float64
+	down     bool // whether the tool is cutting.
+}
+
+// plunge retracts, moves above p, and feeds down to z.
+func (f *facer) plunge(p Tuple, z float64) {
+	if f.g.Position().Z() < f.retractZ {
+		f.g.GotoZ(Z(f.retractZ))
+	}
+	f.g.GotoXY(p)
+	if f.g.Position().Z() > f.retractZ {
+		f.g.GotoZ(Z(f.retractZ))
+	}
+	f.g.MoveZ(Z(z))
+	f.down = true
+}
+
+// raster cuts the passes along X at z. Climb milling cuts toward -X
+// while stepping over toward +Y.
+func (f *facer) raster(z float64, oneWay bool) {
+	min, max := polygonBounds(f.boundary)
+	// The first and last passes take a full stepover off the edges.
+	y0, y1 := min.Y()-f.radius+f.step, max.Y()+f.radius-f.step
+	ys := []float64{(min.Y() + max.Y()) / 2}
+	if y1 > y0 {
+		n := int(math.Ceil((y1-y0)/f.step-epsilon)) + 1
+		ys = nil
+		for k := 0; k < n; k++ {
+			ys = append(ys, y0+float64(k)*(y1-y0)/float64(n-1))
+		}
+	}
+
+	for k, y := range ys {
+		spans := f.spans(y)
+		climb := oneWay || k%2 == 0
+		if climb {
+			for l, r := 0, len(spans)-1; l < r; l, r = l+1, r-1 {
+				spans[l], spans[r] = spans[r], spans[l]
+			}
+		}
+		for i, span := range spans {
+			start, end := XY(span[0], y), XY(span[1], y)
+			if climb {
+				start, end = end, start
+			}
+			if i == 0 && f.down && !oneWay {
+				// Step over outside of the boundary.
+				pos := f.g.Position()
+				x := math.Min(pos.X(), start.X())
+				if climb {
+					x = math.Max(pos.X(), start.X())
+				}
+				f.g.MoveXY(XY(x, pos.Y()), XY(x, y), start)
+			} else {
+				f.plunge(start, z)
+			}
+			f.g.MoveXY(end)
+		}
+	}
+}
+
+// spans returns the sorted spans along X of the tool centers at y whose
+// tool covers the boundary, extended by the radius and the overrun.
+func (f *facer) spans(y float64) [][2]float64 {
+	samples := []float64{y - f.radius, y, y + f.radius}
+	for _, p := range f.boundary {
+		if p.Y() > y-f.radius && p.Y() < y+f.radius {
+			samples = append(samples, p.Y()-epsilon, p.Y()+epsilon)
+		}
+	}
+	var spans [][2]float64
+	ext := f.radius + f.overrun
+	for _, sy := range samples {
+		xs := scanCrossings(f.boundary, sy)
+		for i := 0; i+1 < len(xs); i += 2 {
+			spans = append(spans, [2]float64{xs[i] - ext, xs[i+1] + ext})
+		}
+	}
+	sort.Slice(spans, func(a, b int) bool { return spans[a][0] < spans[b][0] })
+	var merged [][2]float64
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s[0] <= merged[n-1][1] {
+			merged[n-1][1] = math.Max(merged[n-1][1], s[1])
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// scanCrossings returns the sorted X of the crossings of the polygon
+// with the horizontal line at y.
+func scanCrossings(polygon []Tuple, y float64) []float64 {
+	var xs []float64
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		if (a.Y() <= y) != (b.Y() <= y) {
+			xs = append(xs, a.X()+(y-a.Y())*(b.X()-a.X())/(b.Y()-a.Y()))
+		}
+	}
+	sort.Float64s(xs)
+	return xs
+}
+
+// spiral cuts the offsets of the boundary at z from the outside in,
+// clockwise for climb milling.
+func (f *facer) spiral(z float64) {
+	min, max := polygonBounds(f.boundary)
+	margin := f.radius + f.step + 2*f.res
+	min, max = min.Sub(XY(margin, margin)), max.Add(XY(margin, margin))
+	nx := int(math.Ceil((max.X()-min.X())/f.res)) + 1
+	ny := int(math.Ceil((max.Y()-min.Y())/f.res)) + 1
+	at := func(i, j int) Tuple { return min.Add(XY(float64(i)*f.res, float64(j)*f.res)) }
+	field := make([][]float64, ny)
+	far := math.Inf(-1)
+	for j := range field {
+		field[j] = make([]float64, nx)
+		for i := range field[j] {
+			p := at(i, j)
+			d := math.Inf(1)
+			for k, v := range f.boundary {
+				d = math.Min(d, segmentDistance(p, v, f.boundary[(k+1)%len(f.boundary)]))
+			}
+			if !insidePolygon(p, f.boundary) {
+				d = -d
+			}
+			field[j][i] = d
+			far = math.Max(far, d)
+		}
+	}
+
+	// The first offset takes a full stepover off the boundary, and the
+	// last one reaches the middle of the widest area.
+	var cut [][]Tuple
+	for level := f.step - f.radius; ; level += f.step {
+		level = math.Min(level, far-f.res)
+		loops := contourPoints(field, level, at)
+		cut = append(cut, loops...)
+		for len(loops) > 0 {
+			best, bestK, bestD := 0, 0, math.Inf(1)
+			for i, loop := range loops {
+				for k, p := range loop {
+					if d := p.Sub(f.g.Position()).Magnitude(); d < bestD {
+						best, bestK, bestD = i, k, d
+					}
+				}
+			}
+			loop := loops[best]
+			loops = append(loops[:best], loops[best+1:]...)
+			f.loop(loop, bestK, bestD, z)
+		}
+		if level+f.radius >= far || level >= far-f.res {
+			break
+		}
+	}
+
+	// The last offsets of the other areas may leave their middles uncut,
+	// which are then cut along the medial axis of the boundary.
+	var middles [][]Tuple
+	for _, chain := range medialAxis([][]Tuple{f.boundary}, f.res) {
+		var path []Tuple
+		for _, p := range chain {
+			p = XY(p.X(), p.Y())
+			if !f.covered(p, cut) {
+				path = append(path, p)
+				continue
+			}
+			if len(path) > 0 {
+				middles = append(middles, path)
+			}
+			path = nil
+		}
+		if len(path) > 0 {
+			middles = append(middles, path)
+		}
+	}
+	for len(middles) > 0 {
+		best, reverse, bestD := 0, false, math.Inf(1)
+		for i, path := range middles {
+			for k, p := range []Tuple{path[0], path[len(path)-1]} {
+				if d := p.Sub(f.g.Position()).Magnitude(); d < bestD {
+					best, reverse, bestD = i, k == 1, d
+				}
+			}
+		}
+		path := middles[best]
+		middles = append(middles[:best], middles[best+1:]...)
+		if reverse {
+			path = append([]Tuple{}, path...)
+			for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+				path[l], path[r] = path[r], path[l]
+			}
+		}
+		path = simplifyTolerance(path, f.res/4)
+		if !f.down || bestD > 2*f.step {
+			f.plunge(path[0], z)
+		}
+		f.g.MoveXY(path...)
+	}
+}
+
+// covered reports whether the tool cutting the closed loops covers p.
+func (f *facer) covered(p Tuple, loops [][]Tuple) bool {
+	for _, loop := range loops {
+		for i, a := range loop {
+			if segmentDistance(p, a, loop[(i+1)%len(loop)]) < f.radius-f.res {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loop cuts the closed loop clockwise starting from its k'th point,
+// at distance dist from the tool.
+func (f *facer) loop(points []Tuple, k int, dist, z float64) {
+	if len(points) < 3 {
+		return
+	}
+	// Drop the closing point and orient the loop clockwise.
+	if points[0].Sub(points[len(points)-1]).Magnitude() < epsilon {
+		points = points[:len(points)-1]
+		k %= len(points)
+	}
+	var area float64
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		area += p.X()*q.Y() - q.X()*p.Y()
+	}
+	path := append(append([]Tuple{}, points[k:]...), points[:k+1]...)
+	if area > 0 {
+		for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+			path[l], path[r] = path[r], path[l]
+		}
+	}
+	path = simplifyTolerance(path, f.res/4)
+
+	if !f.down || dist > 2*f.step {
+		// Lead in from outside of the loop.
+		u := path[1].Sub(path[0]).Normalize()
+		f.plunge(path[0].Add(XY(-u.Y(), u.X()).MultScalar(f.step+f.overrun)), z)
+	}
+	f.g.MoveXY(path...)
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestFaceRect(t *testing.T) {
+	tests := []struct {
+		strategy FaceStrategyT
+		want     string
+	}{
+		{
+			strategy: FaceZigzag,
+			want: `G0 X36.00000000 Y2.00000000
+G0 Z1.00000000
+G1 Z-1.00000000
+G1 X-6.00000000
+G1 Y7.33333333
+G1 X36.00000000
+G1 Y12.66666667
+G1 X-6.00000000
+G1 Y18.00000000
+G1 X36.00000000
+`,
+		},
+		{
+			strategy: FaceOneWay,
+			want: `G0 X36.00000000 Y2.00000000
+G0 Z1.00000000
+G1 Z-1.00000000
+G1 X-6.00000000
+G0 Z1.00000000
+G0 X36.00000000 Y7.33333333
+G1 Z-1.00000000
+G1 X-6.00000000
+G0 Z1.00000000
+G0 X36.00000000 Y12.66666667
+G1 Z-1.00000000
+G1 X-6.00000000
+G0 Z1.00000000
+G0 X36.00000000 Y18.00000000
+G1 Z-1.00000000
+G1 X-6.00000000
+`,
+		},
+		{
+			strategy: FaceSpiral,
+			want: `G0 X-6.00000000 Y2.00000000
+G0 Z1.00000000
+G1 Z-1.00000000
+G1 X2.00000000
+G1 Y18.00000000
+G1 X28.00000000
+G1 Y2.00000000
+G1 X2.00000000
+G1 X9.00000000 Y9.00000000
+G1 Y11.00000000
+G1 X21.00000000
+G1 Y9.00000000
+G1 X9.00000000
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			g := New(NoHeader)
+			FaceRect(g, XY(0, 0), XY(30, 20), &FaceOptions{ToolDiameter: 10, Depth: 1, Strategy: tt.strategy, Overrun: Float(1)})
+			want := "(-- face strategy=" + string(tt.strategy) + " diameter=10 depth=1 --)\nG0 Z5.00000000\n" + tt.want + "G0 Z5.00000000\n(-- end face --)\n"
+			if got := g.String(); got != want {
+				t.Errorf("FaceRect =\n%v\nwant:\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestFaceDepthPasses(t *testing.T) {
+	g := New(NoHeader)
+	FaceRect(g, XY(0, 0), XY(30, 20), &FaceOptions{ToolDiameter: 10, Depth: 1, StepDown: Float(0.6)})
+	got := g.String()
+	if !strings.Contains(got, "G1 Z-0.50000000\n") || !strings.Contains(got, "G0 Z1.00000000\nG0 Y2.00000000\nG1 Z-1.00000000\n") {
+		t.Errorf("FaceRect =\n%v\nwant passes at Z-0.5 and Z-1", got)
+	}
+}
+
+func TestFaceConcave(t *testing.T) {
+	// The passes across the notch of a U are split.
+	u := []Tuple{XY(0, 0), XY(30, 0), XY(30, 30), XY(20, 30), XY(20, 10), XY(10, 10), XY(10, 30), XY(0, 30)}
+	g := New(NoHeader)
+	Face(g, u, &FaceOptions{ToolDiameter: 6, Depth: 0.5})
+	want := `G1 Y13.02857143
+G1 X13.60000000
+G0 Z1.00000000
+G0 X16.40000000
+G1 Z-0.50000000
+G1 X33.60000000
+`
+	if got := g.String(); !strings.Contains(got, want) {
+		t.Errorf("Face =\n%v\nwant split pass:\n%v", got, want)
+	}
+}
+
+func TestFaceSpiralArm(t *testing.T) {
+	// The last offset of the square misses the middle of the narrower arm.
+	boundary := []Tuple{XY(0, 0), XY(10, 0), XY(10, 2.5), XY(30, 2.5), XY(30, 7.5), XY(10, 7.5), XY(10, 10), XY(0, 10)}
+	g := New(NoHeader)
+	Face(g, boundary, &FaceOptions{ToolDiameter: 2, Depth: 0.5, Stepover: Float(100), Strategy: FaceSpiral})
+	cuts := cutSegments(t, g.String())
+	for x := 0.0; x <= 30; x += 0.25 {
+		for y := 0.0; y <= 10; y += 0.25 {
+			p := XY(x, y)
+			if !insidePolygon(p, boundary) {
+				continue
+			}
+			d := math.Inf(1)
+			for _, c := range cuts {
+				if c[0].Z() == -0.5 && c[1].Z() == -0.5 {
+					d = math.Min(d, segmentDistance(p, XY(c[0].X(), c[0].Y()), XY(c[1].X(), c[1].Y())))
+				}
+			}
+			if d > 1+epsilon {
+				t.Errorf("%v is %v from the nearest cut, want at most 1", p, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultInlayVBitTool = 1
+	defaultInlayFlatTool = 2
+)
+
+// InlayOptions represents options for the Inlay function.
+type InlayOptions struct {
+	// Carve holds the V-bit and carving options shared by the pocket and
+	// the plug. Its MaxDepth is set by Inlay.
+	Carve VCarveOptions
+	// FlatDepth is the depth of the pocket below Carve.Top.
+	FlatDepth float64
+	// StartDepth is the depth below the top of the plug at which its
+	// walls meet the outline of the shapes. The face of the plug stops
+	// FlatDepth-StartDepth above the bottom of the pocket, leaving room
+	// for the glue.
+	StartDepth float64
+	// GlueGap is the horizontal gap left between the walls of the plug
+	// and of the pocket. Default is 0.
+	GlueGap *float64
+	// PlugDepth is the depth of the cut around the plug below its top.
+	// Default is StartDepth+FlatDepth, so that the glued plug stands
+	// FlatDepth proud of the surface before being planed flush.
+	PlugDepth *float64
+	// FlatToolDiameter, if positive, is the diameter of the flat end mill
+	// clearing the flat bottoms too wide for the V-bit.
+	FlatToolDiameter float64
+	// VBitTool and FlatTool are the tool numbers of the V-bit and of the
+	// flat end mill. Defaults are 1 and 2.
+	VBitTool, FlatTool int
+	// SpindleSpeed, if set, starts the spindle after each tool change.
+	SpindleSpeed *float64
+}
+
+// Inlay generates a V-carved inlay of the closed shapes (such as the
+// paths of SplitPaths from Typeset): the female pocket is written to
+// pocket and the matching male plug to plug.
+//
+// The plug is mirrored in X about the center of the shapes so that it
+// fits the pocket when flipped face down. Its walls are carved by the
+// same V-bit around the shapes, offset inward by GlueGap, within a
+// rectangle wide enough for its base. Both programs change to VBitTool
+// and then, for the flat bottoms, to FlatTool.
+func Inlay(pocket, plug *GCode, shapes [][]Tuple, opts *InlayOptions) {
+	if opts == nil || opts.StartDepth <= 0 || opts.FlatDepth <= opts.StartDepth {
+		log.Fatal("Inlay: StartDepth must be positive and less than FlatDepth to leave room for the glue")
+	}
+	glue := getFloat(opts.GlueGap, 0)
+	plugDepth := getFloat(opts.PlugDepth, opts.StartDepth+opts.FlatDepth)
+	if glue < 0 || plugDepth <= opts.StartDepth {
+		log.Fatalf("invalid GlueGap %v or PlugDepth %v", glue, plugDepth)
+	}
+
+	// Mirror the plug in X about the center of the shapes.
+	var all []Tuple
+	for _, s := range shapes {
+		all = append(all, s...)
+	}
+	if len(all) == 0 {
+		log.Fatal("Inlay: no shapes")
+	}
+	min, max := polygonBounds(all)
+	cx := (min.X() + max.X()) / 2
+	mirror := Translation(cx, 0, 0).Mult(Scaling(-1, 1, 1)).Mult(Translation(-cx, 0, 0))
+	var mirrored [][]Tuple
+	for _, s := range shapes {
+		mirrored = append(mirrored, mirror.Transform(s...))
+	}
+
+	carve := opts.Carve
+	v := newVCarver(plug, mirrored, &carve)
+	carve.Resolution = Float(v.res) // the same for the pocket and the plug
+
+	// The plug is what remains around its walls: at the top, the shapes
+	// offset inward by the width of the V-bit at StartDepth and the glue
+	// gap, widening to the shapes at StartDepth and beyond below it.
+	level := opts.StartDepth*v.tanHalf + glue
+	field, at, far := v.field()
+	if level >= far {
+		log.Printf("WARNING: Inlay: the shapes are too thin for a plug with StartDepth %v and GlueGap %v", opts.StartDepth, glue)
+	}
+	margin := plugDepth*v.tanHalf + (plugDepth-opts.StartDepth)*v.tanHalf + v.res
+	if opts.FlatToolDiameter > 0 {
+		margin += opts.FlatToolDiameter
+	}
+	min, max = polygonBounds(mirror.Transform(min, max))
+	min, max = min.Sub(XY(margin, margin)), max.Add(XY(margin, margin))
+	plugShapes := [][]Tuple{{min, XY(max.X(), min.Y()), max, XY(min.X(), max.Y())}}
+	plugShapes = append(plugShapes, contourPoints(field, level, at)...)
+
+	vBit, flat := opts.VBitTool, opts.FlatTool
+	if vBit == 0 {
+		vBit = defaultInlayVBitTool
+	}
+	if flat == 0 {
+		flat = defaultInlayFlatTool
+	}
+	cut := func(g *GCode, name string, shapes [][]Tuple, depth float64) {
+		carve := carve
+		carve.MaxDepth = Float(depth)
+		g.Comment("-- inlay ", name, " depth=", depth, " --")
+		inlayToolChange(g, vBit, opts.SpindleSpeed)
+		VCarve(g, shapes, &carve)
+		if opts.FlatToolDiameter > 0 {
+			if opts.SpindleSpeed != nil {
+				g.SpindleOff()
+			}
+			inlayToolChange(g, flat, opts.SpindleSpeed)
+			VCarveFlat(g, shapes, opts.FlatToolDiameter, &carve)
+		}
+		if opts.SpindleSpeed != nil {
+			g.SpindleOff()
+		}
+		g.Comment("-- end inlay ", name, " --")
+	}
+	cut(pocket, "pocket", shapes, opts.FlatDepth)
+	cut(plug, "plug", plugShapes, plugDepth)
+}
+
+// inlayToolChange changes to the tool and starts the spindle at rpm if set.
+func inlayToolChange(g *GCode, tool int, rpm *float64) {
+	g.Literal(fmt.Sprintf("T%v M6", tool), nil)
+	if rpm != nil {
+		g.SpindleOnCW(*rpm)
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestInlay(t *testing.T) {
+	triangle := []Tuple{XY(0, 0), XY(10, 0), XY(0, 6)}
+	pocket, plug := New(NoHeader), New(NoHeader)
+	Inlay(pocket, plug, [][]Tuple{triangle}, &InlayOptions{
+		Carve:            VCarveOptions{Angle: 90, Resolution: Float(0.1)},
+		FlatDepth:        1,
+		StartDepth:       0.8,
+		GlueGap:          Float(0.1),
+		FlatToolDiameter: 1,
+		SpindleSpeed:     Float(18000),
+	})
+
+	for name, g := range map[string]*GCode{"pocket": pocket, "plug": plug} {
+		got := g.String()
+		i, j := strings.Index(got, "T1 M6\nM3 S18000"), strings.Index(got, "M5\nT2 M6\nM3 S18000")
+		if i < 0 || j < i || !strings.HasSuffix(got, "M5\n(-- end inlay "+name+" --)\n") {
+			t.Errorf("%v tool changes =\n%v", name, got)
+		}
+	}
+
+	low := math.Inf(1)
+	for _, p := range cutPoints(t, pocket.String()) {
+		low = math.Min(low, p.Z())
+	}
+	if math.Abs(low+1) > epsilon {
+		t.Errorf("pocket depth = %v, want 1", -low)
+	}
+
+	// The plug is mirrored, and its face is the triangle offset inward
+	// by the V-bit at StartDepth and the glue gap: a smaller triangle
+	// about its incenter. The V-bit never cuts into the face or under it.
+	mirrored := []Tuple{XY(10, 0), XY(0, 0), XY(10, 6)}
+	var incenter Tuple
+	var perimeter float64
+	for k := range mirrored {
+		side := length2D(mirrored[(k+2)%3].Sub(mirrored[(k+1)%3]))
+		incenter = incenter.Add(mirrored[k].MultScalar(side))
+		perimeter += side
+	}
+	incenter = incenter.DivScalar(perimeter)
+	inradius := 10 * 6 / perimeter
+	var face []Tuple
+	for _, v := range mirrored {
+		face = append(face, incenter.Add(v.Sub(incenter).MultScalar((inradius-0.9)/inradius)))
+	}
+	low = math.Inf(1)
+	for _, p := range cutPoints(t, plug.String()) {
+		d := math.Inf(1)
+		for k, a := range face {
+			d = math.Min(d, segmentDistance(XY(p.X(), p.Y()), a, face[(k+1)%3]))
+		}
+		if insidePolygon(p, face) {
+			d = -d
+		}
+		if d < -p.Z()-0.1 {
+			t.Fatalf("plug cut at %v is %v from its face", p, d)
+		}
+		low = math.Min(low, p.Z())
+	}
+	if math.Abs(low+1.8) > epsilon {
+		t.Errorf("plug depth = %v, want 1.8", -low)
+	}
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultLatheClearance = 1   // mm
+	grooveStepover        = 0.8 // fraction of the tool width
+	groovePeckClearance   = 0.1 // mm
+)
+
+// LatheOptions represents options for the TurnRough and FaceRough cycles.
+// Like all X coordinates, Stock is a diameter in diameter mode (see
+// LatheMode), but all other distances are radial.
+// The cycles select exact path mode (G61), and the finishing feedrate
+// if any, which remain in effect afterwards.
+type LatheOptions struct {
+	// Stock is the X (for TurnRough) or Z (for FaceRough) of the
+	// surface of the stock.
+	Stock float64
+	// DepthOfCut is the depth of each roughing pass.
+	DepthOfCut float64
+	// FinishAllowance is the material left on the profile by roughing.
+	FinishAllowance float64
+	// Clearance is the distance kept from the stock when moving between
+	// passes. Default is 1.
+	Clearance *float64
+	// Finish, if true, cuts a finishing pass along the profile.
+	Finish bool
+	// FinishFeedrate, if non-nil, is the feedrate of the finishing pass.
+	FinishFeedrate *float64
+}
+
+// GetClearance gets the value of the Clearance option.
+func (o *LatheOptions) GetClearance() float64 {
+	if o == nil || o.Clearance == nil {
+		return defaultLatheClearance
+	}
+	return *o.Clearance
+}
+
+// TurnRough roughs the outside of a part on a lathe with passes along Z,
+// moving toward -Z, from the Stock diameter (or radius) down to the profile.
+//
+// The profile is a path in XZ starting at the right end of the part (at
+// the largest Z) and moving toward the chuck. Each pass stops where it
+// meets the profile, so undercuts are left for the finishing pass.
+// Roughing ends with a pass along the profile that leaves FinishAllowance.
+func TurnRough(g *GCode, profile []Tuple, opts *LatheOptions) {
+	checkLatheOptions(opts)
+	scale := latheScale(g)
+	g.Comment("-- turn_rough stock=", opts.Stock, " depth-of-cut=", opts.DepthOfCut, " --")
+	pts := make([][2]float64, 0, len(profile))
+	for _, p := range profile {
+		pts = append(pts, [2]float64{p.X() / scale, p.Z()})
+	}
+	latheRough(g, pts, opts.Stock/scale, opts, func(l, c float64) Tuple { return XZ(l*scale, c) })
+	g.Comment("-- end turn_rough --")
+}
+
+// FaceRough roughs the face of a part on a lathe with passes along X,
+// moving toward the axis, from the Stock Z down to the profile.
+//
+// The profile is a path in XZ starting at the outside of the part (at
+// the largest X) and moving toward the axis. Each pass stops where it
+// meets the profile, and roughing ends with a pass along the profile
+// that leaves FinishAllowance.
+func FaceRough(g *GCode, profile []Tuple, opts *LatheOptions) {
+	checkLatheOptions(opts)
+	scale := latheScale(g)
+	g.Comment("-- face_rough stock=", opts.Stock, " depth-of-cut=", opts.DepthOfCut, " --")
+	pts := make([][2]float64, 0, len(profile))
+	for _, p := range profile {
+		pts = append(pts, [2]float64{p.Z(), p.X() / scale})
+	}
+	latheRough(g, pts, opts.Stock, opts, func(l, c float64) Tuple { return XZ(c*scale, l) })
+	g.Comment("-- end face_rough --")
+}
+
+// latheRough performs the roughing passes of TurnRough and FaceRough.
+// The profile points are (l, c) pairs, where l is the coordinate stepped
+// down by each pass (from stock) and c the coordinate cut along toward
+// smaller values. pos converts (l, c) to a tool position.
+func latheRough(g *GCode, pts [][2]float64, stock float64, opts *LatheOptions, pos func(l, c float64) Tuple) {
+	if len(pts) < 2 {
+		log.Fatal("lathe profile must have at least 2 points")
+	}
+	clearance := opts.GetClearance()
+	allowance := opts.FinishAllowance
+	g.Pathmode(true)
+
+	minL := pts[0][0]
+	for _, p := range pts {
+		minL = math.Min(minL, p[0])
+	}
+	cStart := pts[0][1] + clearance
+	g.GotoXZ(pos(stock+clearance, cStart))
+
+	bottom := minL + allowance
+	for level := stock - opts.DepthOfCut; ; level -= opts.DepthOfCut {
+		if level < bottom {
+			level = bottom
+		}
+		if level >= stock {
+			break
+		}
+		if cEnd := roughPassEnd(pts, level-allowance) + allowance; cEnd < cStart-clearance {
+			g.GotoXZ(pos(level, cStart))
+			g.MoveXZ(pos(level, cEnd))
+			g.MoveXZ(pos(level+clearance, cEnd+clearance))
+			g.GotoXZ(pos(level+clearance, cStart))
+		}
+		if level <= bottom {
+			break
+		}
+	}
+
+	profilePass := func(offset float64) {
+		path := offsetLatheProfile(pts, offset)
+		g.GotoXZ(pos(path[0][0], cStart))
+		for _, p := range path {
+			g.MoveXZ(pos(p[0], p[1]))
+		}
+		g.GotoXZ(pos(stock+clearance, path[len(path)-1][1]))
+		g.GotoXZ(pos(stock+clearance, cStart))
+	}
+	if allowance > 0 || !opts.Finish {
+		profilePass(allowance)
+	}
+	if opts.Finish {
+		if opts.FinishFeedrate != nil {
+			g.Feedrate(*opts.FinishFeedrate)
+		}
+		profilePass(0)
+	}
+}
+
+// offsetLatheProfile returns the (l, c) profile offset by d along its
+// normal toward the tool, which is on the side of larger l when moving
+// toward smaller c, so that walls facing either way keep d of stock.
+func offsetLatheProfile(pts [][2]float64, d float64) [][2]float64 {
+	if d == 0 {
+		return pts
+	}
+	var path [][2]float64
+	for _, p := range pts {
+		if n := len(path); n == 0 || math.Hypot(p[0]-path[n-1][0], p[1]-path[n-1][1]) >= epsilon {
+			path = append(path, p)
+		}
+	}
+	if len(path) < 2 {
+		return [][2]float64{{path[0][0] + d, path[0][1]}}
+	}
+	normals := make([][2]float64, len(path)-1)
+	for i := range normals {
+		dl, dc := path[i+1][0]-path[i][0], path[i+1][1]-path[i][1]
+		length := math.Hypot(dl, dc)
+		normals[i] = [2]float64{-dc / length, dl / length}
+	}
+	result := make([][2]float64, len(path))
+	for i, p := range path {
+		n := normals[min(i, len(normals)-1)]
+		if i > 0 && i < len(normals) {
+			// Miter the corner between the adjacent segments.
+			n0, n1 := normals[i-1], normals[i]
+			if dot := n0[0]*n1[0] + n0[1]*n1[1]; dot > -1+epsilon {
+				n = [2]float64{(n0[0] + n1[0]) / (1 + dot), (n0[1] + n1[1]) / (1 + dot)}
+			}
+		}
+		result[i] = [2]float64{p[0] + d*n[0], p[1] + d*n[1]}
+	}
+	return result
+}
+
+// checkLatheOptions exits if opts are not valid for a roughing cycle.
+func checkLatheOptions(opts *LatheOptions) {
+	if opts == nil || opts.DepthOfCut <= 0 {
+		log.Fatal("DepthOfCut must be > 0")
+	}
+}
+
+// roughPassEnd returns the c coordinate at which a pass at level first
+// meets the profile, or the end of the profile if it never does.
+func roughPassEnd(pts [][2]float64, level float64) float64 {
+	if pts[0][0] >= level {
+		return pts[0][1]
+	}
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		if b[0] >= level {
+			t := (level - a[0]) / (b[0] - a[0])
+			return a[1] + t*(b[1]-a[1])
+		}
+	}
+	return pts[len(pts)-1][1]
+}
+
+// GrooveOptions represents options for the Groove cycle.
+type GrooveOptions struct {
+	// Stock is the X of the surface of the stock.
+	Stock float64
+	// ToolWidth is the width of the grooving tool.
+	ToolWidth float64
+	// Peck, if positive, is the (radial) depth of each peck.
+	Peck float64
+	// Dwell, if positive, is the time to dwell at the bottom of each plunge.
+	Dwell float64
+	// Clearance is the (radial) distance kept from the stock when moving
+	// between plunges. Default is 1.
+	Clearance *float64
+}
+
+// GetClearance gets the value of the Clearance option.
+func (o *GrooveOptions) GetClearance() float64 {
+	if o == nil || o.Clearance == nil {
+		return defaultLatheClearance
+	}
+	return *o.Clearance
+}
+
+// Groove cuts a groove of the given width from z toward -Z down to the
+// bottom X (a diameter in diameter mode) with overlapping plunges.
+// The reference point of the tool is its right (+Z) corner.
+func Groove(g *GCode, z, width, bottom float64, opts *GrooveOptions) {
+	if opts == nil {
+		log.Fatal("groove options are required")
+	}
+	if opts.ToolWidth <= 0 || width < opts.ToolWidth {
+		log.Fatalf("groove width %v must be at least the tool width %v", width, opts.ToolWidth)
+	}
+	scale := latheScale(g)
+	clearance := scale * opts.GetClearance()
+	dir := 1.0
+	if bottom > opts.Stock {
+		dir = -1 // internal groove
+	}
+	top := opts.Stock + dir*clearance
+
+	g.Comment("-- groove z=", z, " width=", width, " bottom=", bottom, " --")
+	g.Pathmode(true)
+
+	n := int(math.Ceil((width - opts.ToolWidth) / (grooveStepover * opts.ToolWidth)))
+	for i := 0; i <= n; i++ {
+		zi := z
+		if n > 0 {
+			zi -= float64(i) * (width - opts.ToolWidth) / float64(n)
+		}
+		g.GotoXZ(XZ(top, zi))
+		if opts.Peck > 0 {
+			peck := scale * opts.Peck
+			for x := opts.Stock - dir*peck; dir*(x-bottom) > 0; x -= dir * peck {
+				g.MoveX(X(x))
+				g.GotoX(X(top))
+				g.GotoX(X(x + dir*scale*groovePeckClearance))
+			}
+		}
+		g.MoveX(X(bottom))
+		if opts.Dwell > 0 {
+			g.Dwell(opts.Dwell)
+		}
+		g.GotoX(X(top))
+	}
+
+	g.Comment("-- end groove --")
+}
+
+// latheScale returns 2 in diameter mode and 1 otherwise.
+func latheScale(g *GCode) float64 {
+	if g.IsDiameterMode() {
+		return 2
+	}
+	return 1
+}
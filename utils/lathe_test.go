@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestTurnRoughUndercut(t *testing.T) {
+	// The allowance is kept on the wall facing the chuck.
+	profile := []Tuple{XZ(0, 0), XZ(16, 0), XZ(16, -10), XZ(12, -10), XZ(12, -20)}
+	g := New(NoHeader)
+	g.LatheMode(false)
+	TurnRough(g, profile, &LatheOptions{Stock: 18, DepthOfCut: 3, FinishAllowance: 0.2})
+
+	want := `G1 X16.20000000
+G1 Z-10.20000000
+G1 X12.20000000
+G1 Z-20.00000000
+`
+	if got := g.String(); !strings.Contains(got, want) {
+		t.Errorf("TurnRough =\n%v\nwant allowance pass:\n%v", got, want)
+	}
+}
+
+func TestTurnRough(t *testing.T) {
+	profile := []Tuple{XZ(0, 0), XZ(16, 0), XZ(16, -10), XZ(20, -10), XZ(20, -20)}
+	g := New(NoHeader)
+	g.LatheMode(true)
+	TurnRough(g, profile, &LatheOptions{Stock: 22, DepthOfCut: 1.5, FinishAllowance: 0.2, Finish: true})
+
+	got := g.String()
+	want := `G18
+G7
+(-- turn_rough stock=22 depth-of-cut=1.5 --)
+G61
+G0 X24.00000000 Z1.00000000
+G0 X19.00000000
+G1 Z-9.80000000
+G1 X21.00000000 Z-8.80000000
+G0 Z1.00000000
+G0 X0.00000000
+G1 Z0.20000000
+G1 X16.40000000
+G1 Z-9.80000000
+G1 X20.40000000
+G1 Z-20.00000000
+G0 X24.00000000
+G0 Z1.00000000
+G0 X0.00000000
+G1 Z0.00000000
+G1 X16.00000000
+G1 Z-10.00000000
+G1 X20.00000000
+G1 Z-20.00000000
+G0 X24.00000000
+G0 Z1.00000000
+(-- end turn_rough --)
+`
+	if got != want {
+		t.Errorf("TurnRough =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestGroove(t *testing.T) {
+	g := New(NoHeader)
+	g.LatheMode(false)
+	g.GotoXZ(XZ(11, -5))
+	Groove(g, -5, 3.5, 8, &GrooveOptions{Stock: 10, ToolWidth: 2, Peck: 1})
+
+	got := g.String()
+	want := `G18
+G8
+G0 X11.00000000 Z-5.00000000
+(-- groove z=-5 width=3.5 bottom=8 --)
+G61
+G1 X9.00000000
+G0 X11.00000000
+G0 X9.10000000
+G1 X8.00000000
+G0 X11.00000000
+G0 Z-6.50000000
+G1 X9.00000000
+G0 X11.00000000
+G0 X9.10000000
+G1 X8.00000000
+G0 X11.00000000
+(-- end groove --)
+`
+	if got != want {
+		t.Errorf("Groove =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+// gridEdge identifies the edge of the grid from node (i, j) to
+// node (i+1, j), or to node (i, j+1) if vertical.
+type gridEdge struct {
+	i, j     int
+	vertical bool
+}
+
+// marchingSegments lists the edges of a cell (0: bottom, 1: right,
+// 2: top, 3: left) connected by contour segments for each combination
+// of corners inside the contour (1: bottom left, 2: bottom right,
+// 4: top right, 8: top left). The saddles 5 and 10 are resolved
+// separately.
+var marchingSegments = [16][][2]int{
+	{}, {{3, 0}}, {{0, 1}}, {{3, 1}}, {{1, 2}}, nil, {{0, 2}}, {{3, 2}},
+	{{2, 3}}, {{0, 2}}, nil, {{1, 2}}, {{3, 1}}, {{0, 1}}, {{3, 0}}, {},
+}
+
+// end returns the node at the end of the edge.
+func (e gridEdge) end() (int, int) {
+	if e.vertical {
+		return e.i, e.j + 1
+	}
+	return e.i + 1, e.j
+}
+
+// marchingSquares returns the chains of grid edges crossed by the
+// contours at level of the values z[j][i] at the nodes of a grid.
+// Nodes at or above level are inside the contours. A closed contour
+// starts and ends with the same edge.
+func marchingSquares(z [][]float64, level float64) [][]gridEdge {
+	inside := func(i, j int) bool { return z[j][i] >= level }
+	var segments [][2]gridEdge
+	for j := 0; j < len(z)-1; j++ {
+		for i := 0; i < len(z[0])-1; i++ {
+			edges := [4]gridEdge{{i, j, false}, {i + 1, j, true}, {i, j + 1, false}, {i, j, true}}
+			var index int
+			for k, corner := range [][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}} {
+				if inside(corner[0], corner[1]) {
+					index |= 1 << k
+				}
+			}
+			pairs := marchingSegments[index]
+			if index == 5 || index == 10 {
+				center := (z[j][i] + z[j][i+1] + z[j+1][i+1] + z[j+1][i]) / 4
+				if (center >= level) == (index == 5) {
+					pairs = [][2]int{{0, 1}, {2, 3}}
+				} else {
+					pairs = [][2]int{{3, 0}, {1, 2}}
+				}
+			}
+			for _, pair := range pairs {
+				segments = append(segments, [2]gridEdge{edges[pair[0]], edges[pair[1]]})
+			}
+		}
+	}
+
+	// Chain the segments into contours.
+	byEdge := map[gridEdge][]int{}
+	for k, seg := range segments {
+		byEdge[seg[0]] = append(byEdge[seg[0]], k)
+		byEdge[seg[1]] = append(byEdge[seg[1]], k)
+	}
+	used := make([]bool, len(segments))
+	next := func(e gridEdge) (gridEdge, bool) {
+		for _, k := range byEdge[e] {
+			if !used[k] {
+				used[k] = true
+				if segments[k][0] == e {
+					return segments[k][1], true
+				}
+				return segments[k][0], true
+			}
+		}
+		return e, false
+	}
+	var result [][]gridEdge
+	for k, seg := range segments {
+		if used[k] {
+			continue
+		}
+		used[k] = true
+		chain := []gridEdge{seg[0], seg[1]}
+		for e, ok := next(seg[1]); ok; e, ok = next(e) {
+			chain = append(chain, e)
+		}
+		var head []gridEdge
+		for e, ok := next(seg[0]); ok; e, ok = next(e) {
+			head = append(head, e)
+		}
+		for l, r := 0, len(head)-1; l < r; l, r = l+1, r-1 {
+			head[l], head[r] = head[r], head[l]
+		}
+		chain = append(head, chain...)
+
+		result = append(result, chain)
+	}
+	return result
+}
+
+// contourPoints returns the contours at level of the values z[j][i] at
+// the nodes of a grid, where at returns the position of node (i, j).
+// The points are interpolated linearly along the crossed grid edges.
+func contourPoints(z [][]float64, level float64, at func(i, j int) Tuple) [][]Tuple {
+	var result [][]Tuple
+	for _, chain := range marchingSquares(z, level) {
+		var points []Tuple
+		for _, e := range chain {
+			i1, j1 := e.end()
+			f0, f1 := z[e.j][e.i], z[j1][i1]
+			p0, p1 := at(e.i, e.j), at(i1, j1)
+			points = append(points, p0.Add(p1.Sub(p0).MultScalar((level-f0)/(f1-f0))))
+		}
+		result = append(result, points)
+	}
+	return result
+}
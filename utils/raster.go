@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"image"
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultRasterDPI       = 254 // 0.1mm per pixel
+	defaultRasterThreshold = 0.5
+	defaultRasterMinRapid  = 2 // mm
+	rasterPowerLevels      = 255
+)
+
+// DitherT represents the way gray levels are converted to laser power.
+type DitherT string
+
+const (
+	DitherNone           DitherT = ""                // power proportional to the gray level
+	DitherThreshold      DitherT = "threshold"       // full power for pixels darker than Threshold
+	DitherFloydSteinberg DitherT = "floyd-steinberg" // Floyd-Steinberg error diffusion
+	DitherJarvis         DitherT = "jarvis"          // Jarvis, Judice, and Ninke error diffusion
+)
+
+// RasterOptions represents options for the RasterEngrave function.
+type RasterOptions struct {
+	// Origin is the position of the bottom left corner of the image.
+	Origin Tuple
+	// DPI is the resolution of the engraving in dots per inch,
+	// which sets both the pixel size and the distance between scanlines.
+	// Default is 254 (0.1mm).
+	DPI *float64
+	// Width, if positive, is the width of the engraving, to which the
+	// image is scaled. Otherwise, each pixel of the image is one dot.
+	Width float64
+	// Gamma, if non-nil, corrects the darkness d (0-1) of each pixel
+	// to d^Gamma before dithering.
+	Gamma *float64
+	// Dither selects the dithering mode. Default is DitherNone.
+	Dither DitherT
+	// Threshold is the darkness (0-1) at and above which DitherThreshold
+	// uses full power. Default is 0.5.
+	Threshold *float64
+	// MinPower and MaxPower (0-1) are the power of the lightest and the
+	// darkest pixels. White pixels are blank. Defaults are 0 and 1.
+	MinPower, MaxPower *float64
+	// Overscan is the distance each scanline is extended at zero power
+	// to let the machine reach speed before engraving.
+	Overscan float64
+	// MinRapid is the minimum length of a blank run within a scanline
+	// (in addition to the overscan on both sides) that is skipped with
+	// a rapid move. Default is 2.
+	MinRapid *float64
+	// Feedrate, if non-nil, sets the feedrate of the engraving.
+	Feedrate *float64
+}
+
+// RasterEngrave engraves img with a laser (see LaserMode) by bidirectional
+// scanlines from the bottom of the image up, with the laser power of each
+// pixel set by S words on the G1 moves. Transparent pixels are white.
+// Blank scanlines are skipped, and blank runs are skipped with rapids.
+func RasterEngrave(g *GCode, img image.Image, opts *RasterOptions) {
+	if !g.IsLaserMode() {
+		log.Fatal("RasterEngrave requires LaserMode")
+	}
+	if opts == nil {
+		opts = &RasterOptions{}
+	}
+	dpi := getFloat(opts.DPI, defaultRasterDPI)
+	if dpi <= 0 {
+		log.Fatalf("invalid DPI %v", dpi)
+	}
+	dot := 25.4 / dpi
+	minPower := getFloat(opts.MinPower, 0)
+	maxPower := getFloat(opts.MaxPower, 1)
+	minRapid := getFloat(opts.MinRapid, defaultRasterMinRapid)
+
+	b := img.Bounds()
+	nx, ny := b.Dx(), b.Dy()
+	if opts.Width > 0 {
+		nx = int(math.Round(opts.Width / dot))
+		ny = int(math.Round(float64(nx) * float64(b.Dy()) / float64(b.Dx())))
+	}
+	if nx <= 0 || ny <= 0 {
+		log.Fatal("RasterEngrave: empty image")
+	}
+
+	levels := rasterDarkness(img, nx, ny)
+	if opts.Gamma != nil {
+		for _, row := range levels {
+			for i, d := range row {
+				row[i] = math.Pow(d, *opts.Gamma)
+			}
+		}
+	}
+	dither(levels, opts.Dither, getFloat(opts.Threshold, defaultRasterThreshold))
+
+	g.Comment("-- raster_engrave ", nx, "x", ny, " dots of ", dot, "mm --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+
+	origin := opts.Origin
+	var reverse bool
+	for j := ny - 1; j >= 0; j-- {
+		// Quantize the power of the scanline.
+		row := make([]float64, nx)
+		first, last := -1, -1
+		for i, d := range levels[j] {
+			if d > 0 {
+				row[i] = math.Round((minPower+d*(maxPower-minPower))*rasterPowerLevels) / rasterPowerLevels
+			}
+			if row[i] > 0 {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			continue
+		}
+
+		y := origin.Y() + (float64(ny-1-j)+0.5)*dot
+		x := func(edge int) float64 { return origin.X() + float64(edge)*dot }
+		runs := rasterRuns(row, first, last)
+		dir, start, end := 1.0, first, last+1
+		if reverse {
+			dir, start, end = -1, last+1, first
+			for l, r := 0, len(runs)-1; l < r; l, r = l+1, r-1 {
+				runs[l], runs[r] = runs[r], runs[l]
+			}
+		}
+
+		g.GotoXY(XY(x(start)-dir*opts.Overscan, y))
+		if opts.Overscan > 0 {
+			g.MoveXYWithPower(0, XY(x(start), y))
+		}
+		for _, run := range runs {
+			to := run.end
+			if reverse {
+				to = run.start
+			}
+			if run.power == 0 && float64(run.end-run.start)*dot >= minRapid+2*opts.Overscan {
+				g.GotoXY(XY(x(to)-dir*opts.Overscan, y))
+				if opts.Overscan > 0 {
+					g.MoveXYWithPower(0, XY(x(to), y))
+				}
+				continue
+			}
+			g.MoveXYWithPower(run.power, XY(x(to), y))
+		}
+		if opts.Overscan > 0 {
+			g.MoveXYWithPower(0, XY(x(end)+dir*opts.Overscan, y))
+		}
+		reverse = !reverse
+	}
+	g.LaserOff()
+
+	g.Comment("-- end raster_engrave --")
+}
+
+// rasterRun represents a run of pixels [start, end) of the same power.
+type rasterRun struct {
+	start, end int
+	power      float64
+}
+
+// rasterRuns returns the runs of row from first to last.
+func rasterRuns(row []float64, first, last int) []rasterRun {
+	var runs []rasterRun
+	for i := first; i <= last; i++ {
+		if n := len(runs); n > 0 && runs[n-1].power == row[i] {
+			runs[n-1].end = i + 1
+			continue
+		}
+		runs = append(runs, rasterRun{start: i, end: i + 1, power: row[i]})
+	}
+	return runs
+}
+
+// rasterDarkness returns the darkness (0 for white to 1 for black) of
+// img resampled to nx by ny pixels, over a white background.
+func rasterDarkness(img image.Image, nx, ny int) [][]float64 {
+	b := img.Bounds()
+	result := make([][]float64, ny)
+	for j := range result {
+		result[j] = make([]float64, nx)
+		sy := b.Min.Y + int((float64(j)+0.5)*float64(b.Dy())/float64(ny))
+		for i := range result[j] {
+			sx := b.Min.X + int((float64(i)+0.5)*float64(b.Dx())/float64(nx))
+			r, gr, bl, a := img.At(sx, sy).RGBA()
+			white := float64(0xffff - a)
+			lum := (0.299*(float64(r)+white) + 0.587*(float64(gr)+white) + 0.114*(float64(bl)+white)) / 0xffff
+			result[j][i] = math.Max(0, math.Min(1, math.Round((1-lum)*0xffff)/0xffff))
+		}
+	}
+	return result
+}
+
+// ditherKernel represents an error diffusion kernel as the
+// offsets (dx, dy) and weights of the neighboring pixels.
+type ditherKernel []struct {
+	dx, dy int
+	w      float64
+}
+
+var ditherKernels = map[DitherT]ditherKernel{
+	DitherFloydSteinberg: {
+		{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	},
+	DitherJarvis: {
+		{1, 0, 7.0 / 48}, {2, 0, 5.0 / 48},
+		{-2, 1, 3.0 / 48}, {-1, 1, 5.0 / 48}, {0, 1, 7.0 / 48}, {1, 1, 5.0 / 48}, {2, 1, 3.0 / 48},
+		{-2, 2, 1.0 / 48}, {-1, 2, 3.0 / 48}, {0, 2, 5.0 / 48}, {1, 2, 3.0 / 48}, {2, 2, 1.0 / 48},
+	},
+}
+
+// dither converts the darkness levels to 0 or 1 in place using mode.
+func dither(levels [][]float64, mode DitherT, threshold float64) {
+	if mode == DitherNone {
+		return
+	}
+	kernel, ok := ditherKernels[mode]
+	if !ok && mode != DitherThreshold {
+		log.Fatalf("unknown dither mode %q", mode)
+	}
+	for j, row := range levels {
+		for i, d := range row {
+			v := 0.0
+			if d >= threshold {
+				v = 1
+			}
+			row[i] = v
+			for _, k := range kernel {
+				x, y := i+k.dx, j+k.dy
+				if y < len(levels) && x >= 0 && x < len(row) {
+					levels[y][x] += (d - v) * k.w
+				}
+			}
+		}
+	}
+}
+
+// getFloat returns the value of v, or def if v is nil.
+func getFloat(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestRasterEngrave(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 6, 2))
+	for x := 0; x < 6; x++ {
+		img.SetGray(x, 0, color.Gray{Y: 255})
+		img.SetGray(x, 1, color.Gray{Y: 255})
+	}
+	img.SetGray(1, 0, color.Gray{Y: 0})
+	img.SetGray(2, 0, color.Gray{Y: 0})
+	img.SetGray(5, 0, color.Gray{Y: 128})
+	img.SetGray(0, 1, color.Gray{Y: 0})
+
+	g := New(NoHeader)
+	g.LaserMode(nil)
+	RasterEngrave(g, img, &RasterOptions{DPI: Float(25.4), Overscan: 0.5, MinRapid: Float(1)})
+
+	got := g.String()
+	want := `(-- raster_engrave 6x2 dots of 1mm --)
+G0 X-0.50000000 Y0.50000000
+M3 S0
+G1 X0.00000000
+G1 X1.00000000 S1000
+G1 X1.50000000 S0
+M5
+G0 X6.50000000 Y1.50000000
+M3 S0
+G1 X6.00000000
+G1 X5.00000000 S498.039
+M5
+G0 X3.50000000
+M3 S0
+G1 X3.00000000
+G1 X1.00000000 S1000
+G1 X0.50000000 S0
+M5
+(-- end raster_engrave --)
+`
+	if got != want {
+		t.Errorf("RasterEngrave =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestDither(t *testing.T) {
+	levels := [][]float64{{0.5, 0.5, 0.5, 0.5}, {0.5, 0.5, 0.5, 0.5}}
+	dither(levels, DitherFloydSteinberg, 0.5)
+	want := [][]float64{{1, 0, 1, 0}, {0, 1, 0, 1}}
+	for j := range want {
+		for i := range want[j] {
+			if levels[j][i] != want[j][i] {
+				t.Fatalf("dither = %v, want %v", levels, want)
+			}
+		}
+	}
+}
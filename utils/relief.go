@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"image"
+	"log"
+	"math"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultReliefRoughStepover = 0.4 // fraction of the cutter diameter
+	defaultReliefStepover      = 0.1 // fraction of the cutter diameter
+	dropCutterSteps            = 10  // minimum number of kernel steps across the cutter radius
+)
+
+// ReliefOptions represents options for the Relief function.
+type ReliefOptions struct {
+	// Origin is the position of the bottom left corner of the relief.
+	Origin Tuple
+	// Width is the width of the relief. Height, if positive, is its height.
+	// Otherwise, the height follows the aspect ratio of the image.
+	Width, Height float64
+	// MinZ and MaxZ are the Z of black and white pixels.
+	MinZ, MaxZ float64
+	// Invert makes black pixels high and white pixels low.
+	Invert bool
+	// Cutter is the cutter used for both roughing and finishing.
+	Cutter Cutter
+	// StepDown, if positive, is the depth of each roughing level.
+	// Otherwise, roughing is skipped.
+	StepDown float64
+	// RoughStepover is the distance between roughing scanlines.
+	// Default is 40% of the cutter diameter.
+	RoughStepover *float64
+	// Allowance is the material left on the relief by roughing.
+	Allowance float64
+	// Stepover is the distance between finishing scanlines.
+	// Default is 10% of the cutter diameter.
+	Stepover *float64
+	// SafeZ is the Z for rapid moves. Default is MaxZ+5.
+	SafeZ *float64
+	// Feedrate, if non-nil, sets the feedrate of the carving.
+	Feedrate *float64
+}
+
+// heightMap represents a grid of heights at the centers of its cells.
+type heightMap struct {
+	z      [][]float64 // z[j][i] is the height of the cell at column i, row j (from the bottom).
+	dx, dy float64     // size of a cell.
+}
+
+// Relief carves a 2.5D relief from a depth map image, mapping the gray
+// level of each pixel to a Z from MinZ (black) to MaxZ (white) over the
+// Width and Height of the relief.
+//
+// If StepDown is positive, the relief is first roughed with parallel
+// scanlines along X at levels StepDown apart, leaving Allowance. It is
+// then finished with scanlines along X following the surface. The Z of
+// the cutter at each point is found by dropping the cutter onto the
+// height map (drop-cutter), so ball and V cutters do not gouge the relief.
+func Relief(g *GCode, img image.Image, opts *ReliefOptions) {
+	if opts == nil || opts.Width <= 0 {
+		log.Fatal("Relief: Width must be positive")
+	}
+	c := &opts.Cutter
+	c.check()
+	b := img.Bounds()
+	height := opts.Height
+	if height <= 0 {
+		height = opts.Width * float64(b.Dy()) / float64(b.Dx())
+	}
+	safeZ := getFloat(opts.SafeZ, opts.MaxZ+defaultSafeHeight)
+
+	levels := rasterDarkness(img, b.Dx(), b.Dy())
+	h := &heightMap{dx: opts.Width / float64(b.Dx()), dy: height / float64(b.Dy())}
+	h.z = make([][]float64, len(levels))
+	for j := range h.z {
+		h.z[j] = make([]float64, len(levels[0]))
+		for i, d := range levels[len(levels)-1-j] {
+			if opts.Invert {
+				d = 1 - d
+			}
+			h.z[j][i] = opts.MaxZ - d*(opts.MaxZ-opts.MinZ)
+		}
+	}
+	sample := math.Min(h.dx, h.dy)
+	kernel := newDropKernel(c, sample)
+
+	g.Comment("-- relief ", opts.Width, "x", height, " Z=", opts.MinZ, "..", opts.MaxZ, " --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+	g.GotoZ(Z(safeZ))
+
+	// emit cuts the runs of consecutive points for which cut is true.
+	emit := func(points []Tuple, cut func(i int) bool) {
+		var run []Tuple
+		flush := func() {
+			if len(run) == 0 {
+				return
+			}
+			run = simplifyPolyline(run)
+			g.GotoXY(run[0])
+			g.MoveZ(run[0])
+			g.MoveXYZ(run[1:]...)
+			g.GotoZ(Z(safeZ))
+			run = nil
+		}
+		for i, p := range points {
+			if cut(i) {
+				run = append(run, XYZ(opts.Origin.X()+p.X(), opts.Origin.Y()+p.Y(), p.Z()))
+				continue
+			}
+			flush()
+		}
+		flush()
+	}
+
+	if opts.StepDown > 0 {
+		stepover := getFloat(opts.RoughStepover, defaultReliefRoughStepover*c.Diameter)
+		path := reliefRaster(opts.Width, height, stepover, sample)
+		surface := make([]float64, len(path))
+		for i, p := range path {
+			surface[i] = h.dropCutter(kernel, p.X(), p.Y()) + opts.Allowance
+		}
+		points := make([]Tuple, len(path))
+		for prev := opts.MaxZ; prev > opts.MinZ+opts.Allowance+epsilon; prev -= opts.StepDown {
+			level := math.Max(prev-opts.StepDown, opts.MinZ)
+			for i, p := range path {
+				points[i] = XYZ(p.X(), p.Y(), math.Max(level, surface[i]))
+			}
+			emit(points, func(i int) bool { return points[i].Z() < prev-epsilon })
+		}
+	}
+
+	stepover := getFloat(opts.Stepover, defaultReliefStepover*c.Diameter)
+	path := reliefRaster(opts.Width, height, stepover, sample)
+	for i, p := range path {
+		path[i] = XYZ(p.X(), p.Y(), h.dropCutter(kernel, p.X(), p.Y()))
+	}
+	emit(path, func(i int) bool { return true })
+
+	g.Comment("-- end relief --")
+}
+
+// reliefRaster returns the points of a zigzag of scanlines along X
+// covering width by height, stepover apart, sampled every sample.
+func reliefRaster(width, height, stepover, sample float64) []Tuple {
+	if stepover <= 0 || sample <= 0 {
+		log.Fatalf("invalid stepover %v", stepover)
+	}
+	nx := int(math.Ceil(width / sample))
+	ny := int(math.Ceil(height / stepover))
+	var result []Tuple
+	for j := 0; j <= ny; j++ {
+		y := height * float64(j) / float64(ny)
+		if j > 0 {
+			// Connect to the previous scanline along the edge.
+			y0 := result[len(result)-1].Y()
+			x := result[len(result)-1].X()
+			n := int(math.Ceil((y - y0) / sample))
+			for k := 1; k < n; k++ {
+				result = append(result, XY(x, y0+(y-y0)*float64(k)/float64(n)))
+			}
+		}
+		for i := 0; i <= nx; i++ {
+			k := i
+			if j%2 == 1 {
+				k = nx - i
+			}
+			result = append(result, XY(width*float64(k)/float64(nx), y))
+		}
+	}
+	return result
+}
+
+// at returns the bilinearly interpolated height at (x, y).
+func (h *heightMap) at(x, y float64) float64 {
+	fx := math.Max(0, math.Min(float64(len(h.z[0])-1), x/h.dx-0.5))
+	fy := math.Max(0, math.Min(float64(len(h.z)-1), y/h.dy-0.5))
+	i, j := int(fx), int(fy)
+	i1, j1 := min(i+1, len(h.z[0])-1), min(j+1, len(h.z)-1)
+	tx, ty := fx-float64(i), fy-float64(j)
+	z0 := h.z[j][i] + tx*(h.z[j][i1]-h.z[j][i])
+	z1 := h.z[j1][i] + tx*(h.z[j1][i1]-h.z[j1][i])
+	return z0 + ty*(z1-z0)
+}
+
+// dropKernel represents the points (dx, dy) of the bottom of a cutter,
+// relative to its axis, and their heights dz above its tip.
+type dropKernel []struct{ dx, dy, dz float64 }
+
+// newDropKernel returns the points of the bottom of the cutter
+// sampled on a grid of at most step and around its rim.
+func newDropKernel(c *Cutter, step float64) dropKernel {
+	r := c.Radius()
+	step = math.Min(step, r/dropCutterSteps)
+	var k dropKernel
+	n := int(math.Ceil(r / step))
+	for j := -n; j <= n; j++ {
+		for i := -n; i <= n; i++ {
+			x, y := r*float64(i)/float64(n), r*float64(j)/float64(n)
+			if d := math.Hypot(x, y); d < r {
+				k = append(k, struct{ dx, dy, dz float64 }{x, y, c.Profile(d)})
+			}
+		}
+	}
+	m := 4 * int(math.Ceil(math.Pi*r/(2*step))) // including the points on the axes
+	for i := 0; i < m; i++ {
+		a := 2 * math.Pi * float64(i) / float64(m)
+		k = append(k, struct{ dx, dy, dz float64 }{r * math.Cos(a), r * math.Sin(a), c.Profile(r)})
+	}
+	return k
+}
+
+// dropCutter returns the lowest Z of the tip of the cutter (see
+// newDropKernel) at (x, y) at which it touches but does not cut into
+// the bilinearly interpolated height map.
+func (h *heightMap) dropCutter(k dropKernel, x, y float64) float64 {
+	z := math.Inf(-1)
+	for _, p := range k {
+		z = math.Max(z, h.at(x+p.dx, y+p.dy)-p.dz)
+	}
+	return z
+}
+
+// simplifyPolyline removes the points of path that are on the line
+// between their neighbors.
+func simplifyPolyline(path []Tuple) []Tuple {
+	if len(path) < 3 {
+		return path
+	}
+	result := []Tuple{path[0]}
+	for i := 1; i < len(path)-1; i++ {
+		a, b := path[i].Sub(result[len(result)-1]), path[i+1].Sub(path[i])
+		if a.Cross(b).Magnitude() > epsilon*a.Magnitude()*b.Magnitude() || a.Dot(b) < 0 {
+			result = append(result, path[i])
+		}
+	}
+	return append(result, path[len(path)-1])
+}
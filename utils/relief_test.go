@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestDropCutter(t *testing.T) {
+	h := &heightMap{dx: 1, dy: 1}
+	for j := 0; j < 5; j++ {
+		h.z = append(h.z, []float64{0, 1, 2, 3, 4})
+	}
+	tests := []struct {
+		cutter Cutter
+		want   float64
+	}{
+		{Cutter{Shape: CutterFlat, Diameter: 2}, 3},
+		{Cutter{Shape: CutterBall, Diameter: 2}, 2 + math.Sqrt2 - 1},
+		{Cutter{Shape: CutterV, Diameter: 2, Angle: 90}, 2},
+	}
+	for _, tt := range tests {
+		got := h.dropCutter(newDropKernel(&tt.cutter, 1), 2.5, 2.5)
+		if math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("dropCutter(%v) = %v, want %v", tt.cutter, got, tt.want)
+		}
+	}
+}
+
+func TestRelief(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+	g := New(NoHeader)
+	Relief(g, img, &ReliefOptions{
+		Width: 2, Height: 1, MinZ: -1, MaxZ: 0,
+		Cutter:   Cutter{Shape: CutterFlat, Diameter: 0.5},
+		StepDown: 0.6, Stepover: Float(1), RoughStepover: Float(1),
+	})
+
+	got := g.String()
+	want := `(-- relief 2x1 Z=-1..0 --)
+G0 Z5.00000000
+G0 X1.00000000
+G1 Z-0.25000000
+G1 X2.00000000 Z-0.60000000
+G1 Y1.00000000
+G1 X1.00000000 Z-0.25000000
+G0 Z5.00000000
+G0 X2.00000000 Y0.00000000
+G1 Z-1.00000000
+G1 Y1.00000000
+G0 Z5.00000000
+G0 X0.00000000 Y0.00000000
+G1 Z0.00000000
+G1 X1.00000000 Z-0.25000000
+G1 X2.00000000 Z-1.00000000
+G1 Y1.00000000
+G1 X1.00000000 Z-0.25000000
+G1 X0.00000000 Z0.00000000
+G0 Z5.00000000
+(-- end relief --)
+`
+	if got != want {
+		t.Errorf("Relief =\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	stlHeaderSize   = 80
+	stlTriangleSize = 50
+)
+
+// Triangle represents a triangle of a mesh.
+type Triangle [3]Tuple
+
+// Mesh represents a triangle mesh, such as read from an STL file.
+type Mesh struct {
+	Triangles []Triangle
+
+	bvh *bvhNode // spatial index, built when first needed.
+}
+
+// ReadSTL reads a mesh from an ASCII or binary STL file.
+func ReadSTL(r io.Reader) (*Mesh, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Binary files may also start with "solid", so the size is checked first.
+	if len(buf) >= stlHeaderSize+4 {
+		n := binary.LittleEndian.Uint32(buf[stlHeaderSize:])
+		if uint64(len(buf)) == stlHeaderSize+4+uint64(n)*stlTriangleSize {
+			return readBinarySTL(buf[stlHeaderSize+4:], int(n)), nil
+		}
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("solid")) {
+		return readASCIISTL(buf)
+	}
+	return nil, errors.New("invalid STL file")
+}
+
+// readBinarySTL reads n triangles of a binary STL file.
+func readBinarySTL(buf []byte, n int) *Mesh {
+	m := &Mesh{Triangles: make([]Triangle, n)}
+	for i := range m.Triangles {
+		// Skip the normal, which is recomputed as needed.
+		b := buf[i*stlTriangleSize+12:]
+		for j := range m.Triangles[i] {
+			var v [3]float64
+			for k := range v {
+				v[k] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*(3*j+k):])))
+			}
+			m.Triangles[i][j] = XYZ(v[0], v[1], v[2])
+		}
+	}
+	return m
+}
+
+// readASCIISTL reads the triangles of an ASCII STL file.
+func readASCIISTL(buf []byte) (*Mesh, error) {
+	m := &Mesh{}
+	var vertices []Tuple
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "vertex":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("line %v: invalid vertex", line)
+			}
+			var v [3]float64
+			for i := range v {
+				f, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %v: %v", line, err)
+				}
+				v[i] = f
+			}
+			vertices = append(vertices, XYZ(v[0], v[1], v[2]))
+		case "endfacet":
+			if len(vertices) != 3 {
+				return nil, fmt.Errorf("line %v: facet has %v vertices", line, len(vertices))
+			}
+			m.Triangles = append(m.Triangles, Triangle{vertices[0], vertices[1], vertices[2]})
+			vertices = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteSTL writes the mesh as a binary STL file.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	buf := make([]byte, stlHeaderSize+4+len(m.Triangles)*stlTriangleSize)
+	binary.LittleEndian.PutUint32(buf[stlHeaderSize:], uint32(len(m.Triangles)))
+	for i, t := range m.Triangles {
+		b := buf[stlHeaderSize+4+i*stlTriangleSize:]
+		n := t[1].Sub(t[0]).Cross(t[2].Sub(t[0]))
+		if n.Magnitude() > 0 {
+			n = n.Normalize()
+		}
+		for k := 0; k < 3; k++ {
+			binary.LittleEndian.PutUint32(b[4*k:], math.Float32bits(float32(n[k])))
+		}
+		for j, v := range t {
+			for k := 0; k < 3; k++ {
+				binary.LittleEndian.PutUint32(b[12+4*(3*j+k):], math.Float32bits(float32(v[k])))
+			}
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Bounds returns the corners of the bounding box of the mesh.
+func (m *Mesh) Bounds() (Tuple, Tuple) {
+	inf := math.Inf(1)
+	min, max := XYZ(inf, inf, inf), XYZ(-inf, -inf, -inf)
+	for _, t := range m.Triangles {
+		for _, v := range t {
+			for k := 0; k < 3; k++ {
+				min[k] = math.Min(min[k], v[k])
+				max[k] = math.Max(max[k], v[k])
+			}
+		}
+	}
+	return min, max
+}
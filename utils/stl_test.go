@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestReadSTL_ASCII(t *testing.T) {
+	const src = `solid test
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 1
+      vertex 2 0 1
+      vertex 0 2 1.5
+    endloop
+  endfacet
+endsolid test
+`
+	m, err := ReadSTL(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Triangle{XYZ(0, 0, 1), XYZ(2, 0, 1), XYZ(0, 2, 1.5)}
+	if len(m.Triangles) != 1 || m.Triangles[0] != want {
+		t.Errorf("ReadSTL = %v, want %v", m.Triangles, want)
+	}
+}
+
+func TestWriteSTL(t *testing.T) {
+	m := &Mesh{Triangles: []Triangle{
+		{XYZ(0, 0, 0), XYZ(1, 0, 0), XYZ(0, 1, 0)},
+		{XYZ(1, 0, 0), XYZ(1, 1, 0.5), XYZ(0, 1, 0)},
+	}}
+	var buf bytes.Buffer
+	if err := m.WriteSTL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadSTL(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Triangles) != len(m.Triangles) {
+		t.Fatalf("ReadSTL returned %v triangles, want %v", len(got.Triangles), len(m.Triangles))
+	}
+	for i, tri := range got.Triangles {
+		if tri != m.Triangles[i] {
+			t.Errorf("triangle %v = %v, want %v", i, tri, m.Triangles[i])
+		}
+	}
+}
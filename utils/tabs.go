@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultTabCount  = 4
+	defaultTabWidth  = 3.0 // mm
+	defaultTabHeight = 1.0 // mm
+)
+
+// TabShapeT represents the shape of a holding tab.
+type TabShapeT string
+
+const (
+	TabRectangular TabShapeT = ""           // vertical lift over the tab
+	TabTriangular  TabShapeT = "triangular" // ramps up and down over the tab
+)
+
+// TabOptions represents the holding tabs (or bridges) left on a profile
+// cut so that the part does not break free.
+//
+// Tabs are only placed on straight cuts and only affect the cuts below
+// the top of the tabs, so that passes above them cut normally.
+type TabOptions struct {
+	// Count is the number of tabs evenly spaced along the path when
+	// Positions is empty. Default is 4.
+	Count int
+	// Positions are the centers of the tabs. Each tab is centered on
+	// the nearest straight cut able to hold it.
+	Positions []Tuple
+	// Width is the width of material left by each tab. Default is 3.
+	Width *float64
+	// Height is the height of the tabs above Bottom. Default is 1.
+	Height *float64
+	// Shape selects the shape of the tabs. Default is TabRectangular.
+	// Triangular tabs ramp up and down at 45 degrees from the bottom.
+	Shape TabShapeT
+	// Bottom is the Z of the bottom of the cut.
+	// Default is the lowest Z of the path.
+	Bottom *float64
+}
+
+// tabs represents the tabs placed on a list of straight cuts.
+type tabs struct {
+	shape  TabShapeT
+	top    float64
+	height float64
+	spans  [][][2]float64 // per cut, the sorted tab spans along it
+}
+
+// newTabs places the tabs on the straight cuts (in XY) for a tool of the
+// given diameter. It returns nil if opts is nil.
+func newTabs(opts *TabOptions, toolDiameter, bottom float64, cuts [][2]Tuple) *tabs {
+	if opts == nil {
+		return nil
+	}
+	width := getFloat(opts.Width, defaultTabWidth)
+	height := getFloat(opts.Height, defaultTabHeight)
+	if width <= 0 || height <= 0 {
+		log.Fatalf("invalid tab width %v or height %v", width, height)
+	}
+	switch opts.Shape {
+	case TabRectangular, TabTriangular:
+	default:
+		log.Fatalf("unknown tab shape %q", opts.Shape)
+	}
+	t := &tabs{
+		shape:  opts.Shape,
+		top:    getFloat(opts.Bottom, bottom) + height,
+		height: height,
+		spans:  make([][][2]float64, len(cuts)),
+	}
+
+	// The tool lifts over the tab and its own diameter.
+	span := width + toolDiameter
+	lengths := make([]float64, len(cuts))
+	var total float64
+	var fit bool
+	for i, c := range cuts {
+		lengths[i] = length2D(c[1].Sub(c[0]))
+		if lengths[i] >= span-epsilon {
+			total += math.Max(0, lengths[i]-span)
+			fit = true
+		}
+	}
+	if !fit {
+		log.Printf("WARNING: no straight cut is long enough for tabs of width %v", width)
+		return t
+	}
+
+	add := func(i int, s float64) {
+		t.spans[i] = append(t.spans[i], [2]float64{s - span/2, s + span/2})
+	}
+	if len(opts.Positions) > 0 {
+		for _, p := range opts.Positions {
+			best, bestS, bestD := -1, 0.0, math.Inf(1)
+			for i, c := range cuts {
+				if lengths[i] < span-epsilon {
+					continue
+				}
+				v := c[1].Sub(c[0])
+				s := ((p.X()-c[0].X())*v.X() + (p.Y()-c[0].Y())*v.Y()) / lengths[i]
+				s = math.Max(span/2, math.Min(lengths[i]-span/2, s))
+				q := c[0].Add(v.MultScalar(s / lengths[i]))
+				if d := length2D(q.Sub(p)); d < bestD {
+					best, bestS, bestD = i, s, d
+				}
+			}
+			add(best, bestS)
+		}
+	} else {
+		count := opts.Count
+		if count == 0 {
+			count = defaultTabCount
+		}
+		if count < 0 {
+			log.Fatalf("invalid tab count %v", count)
+		}
+		// Spread the tab centers evenly over the usable parts of the cuts.
+		for k := 0; k < count; k++ {
+			at := (float64(k) + 0.5) * total / float64(count)
+			for i := range cuts {
+				if lengths[i] < span-epsilon {
+					continue
+				}
+				usable := math.Max(0, lengths[i]-span)
+				if at <= usable {
+					add(i, span/2+at)
+					break
+				}
+				at -= usable
+			}
+		}
+	}
+
+	// Merge overlapping tabs.
+	for i, spans := range t.spans {
+		sort.Slice(spans, func(a, b int) bool { return spans[a][0] < spans[b][0] })
+		var merged [][2]float64
+		for _, s := range spans {
+			if n := len(merged); n > 0 && s[0] <= merged[n-1][1] {
+				merged[n-1][1] = math.Max(merged[n-1][1], s[1])
+				continue
+			}
+			merged = append(merged, s)
+		}
+		t.spans[i] = merged
+	}
+	return t
+}
+
+// cut moves along the i'th straight cut to p, lifting over its tabs.
+// A nil t simply moves to p.
+func (t *tabs) cut(g *GCode, i int, p Tuple) {
+	if t == nil || len(t.spans[i]) == 0 {
+		g.MoveXYZ(p)
+		return
+	}
+	from := g.Position()
+	v := p.Sub(from)
+	length := length2D(v)
+	at := func(s float64) Tuple { return from.Add(v.MultScalar(s / length)) }
+	for _, span := range t.spans[i] {
+		p0, p1 := at(span[0]), at(span[1])
+		if p0.Z() >= t.top && p1.Z() >= t.top {
+			continue // this pass is above the tab
+		}
+		g.MoveXYZ(p0)
+		if t.shape == TabTriangular {
+			r := math.Min(t.height, (span[1]-span[0])/2)
+			g.MoveXYZ(XYZ(at(span[0]+r).X(), at(span[0]+r).Y(), t.top))
+			g.MoveXYZ(XYZ(at(span[1]-r).X(), at(span[1]-r).Y(), t.top))
+			g.MoveXYZ(p1)
+			continue
+		}
+		g.MoveZ(Z(t.top))
+		g.MoveXYZ(XYZ(p1.X(), p1.Y(), t.top))
+		g.MoveZ(p1)
+	}
+	g.MoveXYZ(p)
+}
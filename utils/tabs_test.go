@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestTracePathCompTabs(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoZ(Z(5))
+	TracePathCompWithOptions(g, 1, TPCArcIn|TPCArcOut|TPCClosed|TPCOldZ, &TraceOptions{Tabs: &TabOptions{Count: 2, Width: Float(2)}},
+		XYZ(0, 0, -3), XYZ(0, 20, -3), XYZ(20, 20, -3), XYZ(20, 0, -3))
+	want := `G0 Z5.00000000
+(-- tracepath_comp at right side at width=1 --)
+G0 X2.00000000 Y-1.00000000
+G1 Z-3.00000000
+G2 X1.00000000 Y0.00000000 I0.00000000 J1.00000000
+G1 Y14.25000000
+G1 Z-2.00000000
+G1 Y18.25000000
+G1 Z-3.00000000
+G1 Y19.00000000
+G1 X19.00000000
+G1 Y5.25000000
+G1 Z-2.00000000
+G1 Y1.25000000
+G1 Z-3.00000000
+G1 Y1.00000000
+G1 X1.00000000
+G2 X0.00000000 Y2.00000000 I0.00000000 J1.00000000
+G0 Z5.00000000
+(-- tracepath_comp end --)
+`
+	if got := g.String(); got != want {
+		t.Errorf("TracePathCompWithOptions =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestTracePathTabs(t *testing.T) {
+	tabs := &TabOptions{
+		Positions: []Tuple{XY(10, -3)},
+		Shape:     TabTriangular,
+		Width:     Float(4),
+		Height:    Float(0.5),
+		Bottom:    Float(-1),
+	}
+	g := New(NoHeader)
+	g.GotoZ(Z(5))
+	TracePathWithOptions(g, -1, -1, &TraceOptions{Tabs: tabs}, XY(0, 0), XY(10, 0), XY(10, 10))
+	want := `G0 Z5.00000000
+(-- tracepath at Z=-1 --)
+G1 Z-1.00000000
+G1 X6.00000000
+G1 X6.50000000 Z-0.50000000
+G1 X9.50000000
+G1 X10.00000000 Z-1.00000000
+G1 Y10.00000000
+G1 X0.00000000 Y0.00000000
+G1 Z5.00000000
+(-- tracepath end --)
+`
+	if got := g.String(); got != want {
+		t.Errorf("TracePathWithOptions =\n%v\nwant:\n%v", got, want)
+	}
+
+	// Passes above the tabs are not lifted.
+	g = New(NoHeader)
+	g.GotoZ(Z(5))
+	TracePathWithOptions(g, -0.25, -1, &TraceOptions{Tabs: tabs}, XY(0, 0), XY(10, 0), XY(10, 10))
+	if got := g.String(); strings.Contains(got, "X6.00000000") {
+		t.Errorf("TracePathWithOptions above the tabs =\n%v\nwant no tabs", got)
+	}
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	threadInternalDepth = 1.082532 // basic internal thread depth (D-D1) as a fraction of the pitch
+	threadExternalDepth = 1.226869 // basic external thread depth (d-d3) as a fraction of the pitch
+	nptThreadDepth      = 1.6      // truncated NPT thread depth on the diameter as a fraction of the pitch
+	nptTaper            = 1.0 / 16 // NPT change of diameter per unit of length
+)
+
+// ThreadSpec represents a 60 degree thread. All dimensions are in mm.
+type ThreadSpec struct {
+	// Major is the major diameter of the thread (at Top if tapered).
+	Major float64
+	// Minor is the minor diameter of the thread (at Top if tapered).
+	// Default is the basic minor diameter of the internal or
+	// external thread.
+	Minor float64
+	// Pitch is the distance between threads.
+	Pitch float64
+	// LeftHand selects a left hand thread. Default is right hand.
+	LeftHand bool
+	// Taper is the change of diameter per unit of length of tapered
+	// threads. Tapered threads open at Top, so internal threads narrow
+	// and external threads widen below Top.
+	Taper float64
+}
+
+// String returns a description of the thread.
+func (t ThreadSpec) String() string {
+	s := fmt.Sprintf("major=%v pitch=%v", t.Major, t.Pitch)
+	if t.Taper != 0 {
+		s += fmt.Sprintf(" taper=%v", t.Taper)
+	}
+	if t.LeftHand {
+		s += " LH"
+	}
+	return s
+}
+
+// metricCoarsePitches are the coarse pitches of the ISO metric threads.
+var metricCoarsePitches = map[string]float64{
+	"M1": 0.25, "M1.2": 0.25, "M1.6": 0.35, "M2": 0.4, "M2.5": 0.45, "M3": 0.5,
+	"M3.5": 0.6, "M4": 0.7, "M5": 0.8, "M6": 1, "M8": 1.25, "M10": 1.5,
+	"M12": 1.75, "M14": 2, "M16": 2, "M18": 2.5, "M20": 2.5, "M22": 2.5,
+	"M24": 3, "M27": 3, "M30": 3.5, "M33": 3.5, "M36": 4, "M42": 4.5, "M48": 5,
+}
+
+// MetricThreadSpec returns the ISO metric thread of the given size,
+// such as "M8" for the coarse thread or "M8x1" for a fine thread.
+func MetricThreadSpec(size string) ThreadSpec {
+	name, pitch, fine := strings.Cut(size, "x")
+	major, err := strconv.ParseFloat(strings.TrimPrefix(name, "M"), 64)
+	if err != nil || !strings.HasPrefix(name, "M") {
+		log.Fatalf("invalid metric thread %q", size)
+	}
+	if !fine {
+		p, ok := metricCoarsePitches[name]
+		if !ok {
+			log.Fatalf("unknown metric coarse thread %q", size)
+		}
+		return ThreadSpec{Major: major, Pitch: p}
+	}
+	p, err := strconv.ParseFloat(pitch, 64)
+	if err != nil || p <= 0 {
+		log.Fatalf("invalid metric thread pitch %q", size)
+	}
+	return ThreadSpec{Major: major, Pitch: p}
+}
+
+// unifiedTPI are the threads per inch of the UNC and UNF threads.
+var unifiedTPI = map[string][2]float64{
+	"#0": {0, 80}, "#1": {64, 72}, "#2": {56, 64}, "#3": {48, 56}, "#4": {40, 48},
+	"#5": {40, 44}, "#6": {32, 40}, "#8": {32, 36}, "#10": {24, 32}, "#12": {24, 28},
+	"1/4": {20, 28}, "5/16": {18, 24}, "3/8": {16, 24}, "7/16": {14, 20}, "1/2": {13, 20},
+	"9/16": {12, 18}, "5/8": {11, 18}, "3/4": {10, 16}, "7/8": {9, 14}, "1": {8, 12},
+}
+
+// UNCThreadSpec returns the unified coarse thread of the given size,
+// such as "#10" or "1/4".
+func UNCThreadSpec(size string) ThreadSpec { return unifiedThread(size, 0) }
+
+// UNFThreadSpec returns the unified fine thread of the given size,
+// such as "#10" or "1/4".
+func UNFThreadSpec(size string) ThreadSpec { return unifiedThread(size, 1) }
+
+func unifiedThread(size string, series int) ThreadSpec {
+	tpi := unifiedTPI[size][series]
+	if tpi == 0 {
+		log.Fatalf("unknown unified thread %q", size)
+	}
+	return ThreadSpec{Major: inchSize(size), Pitch: 25.4 / tpi}
+}
+
+// nptSizes are the pipe outside diameters in inches and the threads
+// per inch of the NPT threads.
+var nptSizes = map[string][2]float64{
+	"1/8": {0.405, 27}, "1/4": {0.540, 18}, "3/8": {0.675, 18}, "1/2": {0.840, 14},
+	"3/4": {1.050, 14}, "1": {1.315, 11.5}, "1-1/4": {1.660, 11.5},
+	"1-1/2": {1.900, 11.5}, "2": {2.375, 11.5},
+}
+
+// NPTThreadSpec returns the tapered pipe thread of the given nominal size,
+// such as "1/4". As an approximation, the major diameter at Top is the
+// outside diameter of the pipe.
+func NPTThreadSpec(size string) ThreadSpec {
+	s, ok := nptSizes[size]
+	if !ok {
+		log.Fatalf("unknown NPT thread %q", size)
+	}
+	pitch := 25.4 / s[1]
+	major := 25.4 * s[0]
+	return ThreadSpec{Major: major, Minor: major - nptThreadDepth*pitch, Pitch: pitch, Taper: nptTaper}
+}
+
+// inchSize returns in mm a numbered size ("#10"), a fraction ("3/8")
+// or a mixed number ("1-1/4") of inches.
+func inchSize(size string) float64 {
+	if n, ok := strings.CutPrefix(size, "#"); ok {
+		v, err := strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("invalid size %q", size)
+		}
+		return 25.4 * (0.060 + 0.013*float64(v))
+	}
+	var whole float64
+	if w, f, ok := strings.Cut(size, "-"); ok {
+		v, err := strconv.Atoi(w)
+		if err != nil {
+			log.Fatalf("invalid size %q", size)
+		}
+		whole, size = float64(v), f
+	}
+	num, den, ok := strings.Cut(size, "/")
+	if !ok {
+		num, den = size, "1"
+	}
+	n, err1 := strconv.Atoi(num)
+	d, err2 := strconv.Atoi(den)
+	if err1 != nil || err2 != nil || d == 0 {
+		log.Fatalf("invalid size %q", size)
+	}
+	return 25.4 * (whole + float64(n)/float64(d))
+}
+
+// ThreadDirectionT represents the direction along Z of thread milling.
+type ThreadDirectionT string
+
+const (
+	ThreadClimb    ThreadDirectionT = ""          // the direction giving climb milling
+	ThreadTopDown  ThreadDirectionT = "top-down"  // from Top down
+	ThreadBottomUp ThreadDirectionT = "bottom-up" // from the bottom up to Top
+)
+
+// ThreadMillOptions represents options for the ThreadMill function.
+type ThreadMillOptions struct {
+	// ToolDiameter is the cutting diameter of the thread mill.
+	ToolDiameter float64
+	// Length is the length of the thread below Top.
+	Length float64
+	// Top is the Z of the top of the thread. Default is 0.
+	Top *float64
+	// External selects an external thread. Default is internal.
+	External bool
+	// RadialPasses is the number of passes splitting the depth of the
+	// thread. Default is 1.
+	RadialPasses int
+	// Direction is the direction along Z. Default is ThreadClimb.
+	Direction ThreadDirectionT
+	// SafeZ is the Z of the rapids. Default is 5 above Top.
+	SafeZ *float64
+	// Feedrate, if set, is the feedrate of the cuts.
+	Feedrate *float64
+}
+
+// ThreadMill mills the thread around center.
+//
+// Each radial pass arcs in to the thread along a helical half circle,
+// follows the helix for the length of the thread, and arcs out. The
+// arcs of internal threads start and end at center, and the arcs of
+// external threads outside of the major diameter. The leads advance a
+// quarter of the pitch, and the helix completes whole turns, so it may
+// extend beyond the bottom of the thread.
+func ThreadMill(g *GCode, center Tuple, spec ThreadSpec, opts *ThreadMillOptions) {
+	if opts == nil || opts.ToolDiameter <= 0 {
+		log.Fatal("ThreadMill: ToolDiameter must be positive")
+	}
+	if spec.Major <= 0 || spec.Pitch <= 0 || opts.Length <= 0 {
+		log.Fatalf("invalid thread major %v, pitch %v or length %v", spec.Major, spec.Pitch, opts.Length)
+	}
+	minor := spec.Minor
+	if minor == 0 {
+		depth := threadInternalDepth
+		if opts.External {
+			depth = threadExternalDepth
+		}
+		minor = spec.Major - depth*spec.Pitch
+	}
+	if minor <= 0 || minor >= spec.Major {
+		log.Fatalf("invalid thread minor diameter %v", minor)
+	}
+	toolR := opts.ToolDiameter / 2
+	if !opts.External && opts.ToolDiameter >= minor {
+		log.Fatalf("ThreadMill: tool diameter %v does not fit in minor diameter %v", opts.ToolDiameter, minor)
+	}
+	passes := opts.RadialPasses
+	if passes == 0 {
+		passes = 1
+	}
+	if passes < 0 {
+		log.Fatalf("invalid RadialPasses %v", passes)
+	}
+	top := getFloat(opts.Top, 0)
+	safeZ := getFloat(opts.SafeZ, top+defaultSafeHeight)
+	turns := math.Max(1, math.Ceil(opts.Length/spec.Pitch-epsilon))
+	bottom := top - turns*spec.Pitch
+
+	// Right hand threads rise counter-clockwise. Climb milling goes
+	// counter-clockwise inside and clockwise outside.
+	ccw := !opts.External
+	switch opts.Direction {
+	case ThreadClimb:
+	case ThreadTopDown:
+		ccw = spec.LeftHand
+	case ThreadBottomUp:
+		ccw = !spec.LeftHand
+	default:
+		log.Fatalf("unknown thread direction %q", opts.Direction)
+	}
+	up := ccw != spec.LeftHand
+	startZ, dz := top, -spec.Pitch/2
+	if up {
+		startZ, dz = bottom, spec.Pitch/2
+	}
+
+	// radius returns the radius of the tool path at z for the fraction of
+	// the thread depth cut.
+	taper := spec.Taper / 2
+	if !opts.External {
+		taper = -taper
+	}
+	radius := func(z, cut float64) float64 {
+		r := minor/2 + cut*(spec.Major-minor)/2 - toolR
+		if opts.External {
+			r = spec.Major/2 - cut*(spec.Major-minor)/2 + toolR
+		}
+		return r + taper*(top-z)
+	}
+	if radius(top, 1) <= 0 || radius(bottom, 1) <= 0 {
+		log.Fatal("ThreadMill: tool diameter is too large for the thread")
+	}
+	c := XY(center.X(), center.Y())
+	arc := func(p Tuple, r float64, ccw bool) {
+		if ccw {
+			g.ArcCCW(p, r, nil)
+		} else {
+			g.ArcCW(p, r, nil)
+		}
+	}
+
+	g.Comment("-- thread_mill ", spec, " external=", opts.External, " passes=", passes, " --")
+	if opts.Feedrate != nil {
+		g.Feedrate(*opts.Feedrate)
+	}
+	// The leads of internal threads are half circles from center, and the
+	// leads of external threads stay outside of the major diameter.
+	leadRadius := func(r float64) float64 {
+		if opts.External {
+			return toolR + (spec.Major-minor)/2
+		}
+		return r / 2
+	}
+	leadEnd := func(r float64) Tuple {
+		if opts.External {
+			return c.Add(X(r + 2*leadRadius(r)))
+		}
+		return c
+	}
+	for k := 1; k <= passes; k++ {
+		cut := float64(k) / float64(passes)
+		z, r := startZ, radius(startZ, cut)
+		p := leadEnd(r)
+		g.GotoZ(Z(safeZ))
+		g.GotoXY(p)
+		g.GotoZ(Z(math.Max(top, z-dz/2)))
+		g.MoveZ(Z(z - dz/2))
+		arc(XYZ(c.X()+r, c.Y(), z), leadRadius(r), ccw != opts.External)
+
+		// Follow the helix in half turns.
+		for h := 1; h <= 2*int(turns); h++ {
+			z += dz
+			prev := r
+			r = radius(z, cut)
+			side := 1.0
+			if h%2 == 1 {
+				side = -1
+			}
+			arc(XYZ(c.X()+side*r, c.Y(), z), (r+prev)/2, ccw)
+		}
+
+		p = leadEnd(r)
+		arc(XYZ(p.X(), p.Y(), z+dz/2), leadRadius(r), ccw != opts.External)
+	}
+	g.GotoZ(Z(safeZ))
+	g.Comment("-- end thread_mill --")
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestThreadSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		got  ThreadSpec
+		want ThreadSpec
+	}{
+		{"M8", MetricThreadSpec("M8"), ThreadSpec{Major: 8, Pitch: 1.25}},
+		{"M8x1", MetricThreadSpec("M8x1"), ThreadSpec{Major: 8, Pitch: 1}},
+		{"1/4 UNC", UNCThreadSpec("1/4"), ThreadSpec{Major: 6.35, Pitch: 1.27}},
+		{"#10 UNF", UNFThreadSpec("#10"), ThreadSpec{Major: 4.826, Pitch: 25.4 / 32}},
+		{"1-1/4 NPT", NPTThreadSpec("1-1/4"), ThreadSpec{Major: 42.164, Minor: 42.164 - 1.6*25.4/11.5, Pitch: 25.4 / 11.5, Taper: 1.0 / 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got.Major-tt.want.Major) > 1e-9 || math.Abs(tt.got.Minor-tt.want.Minor) > 1e-9 ||
+				math.Abs(tt.got.Pitch-tt.want.Pitch) > 1e-9 || tt.got.Taper != tt.want.Taper {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreadMillExternal(t *testing.T) {
+	g := New(NoHeader)
+	ThreadMill(g, XY(10, 0), MetricThreadSpec("M8x1"), &ThreadMillOptions{ToolDiameter: 5, Length: 1.5, External: true})
+	want := `(-- thread_mill major=8 pitch=1 external=true passes=1 --)
+G0 Z5.00000000
+G0 X22.11343450
+G0 Z0.25000000
+G3 X15.88656550 Y0.00000000 Z0.00000000 I-3.11343450 J0.00000000
+G2 X4.11343450 Y0.00000000 Z-0.50000000 I-5.88656550 J0.00000000
+G2 X15.88656550 Y0.00000000 Z-1.00000000 I5.88656550 J0.00000000
+G2 X4.11343450 Y0.00000000 Z-1.50000000 I-5.88656550 J0.00000000
+G2 X15.88656550 Y0.00000000 Z-2.00000000 I5.88656550 J0.00000000
+G3 X22.11343450 Y0.00000000 Z-2.25000000 I3.11343450 J0.00000000
+G0 Z5.00000000
+(-- end thread_mill --)
+`
+	if got := g.String(); got != want {
+		t.Errorf("ThreadMill =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestThreadMillInternal(t *testing.T) {
+	tests := []struct {
+		name string
+		spec ThreadSpec
+		opts *ThreadMillOptions
+		want []string
+	}{
+		{
+			name: "right hand climbs bottom-up",
+			spec: MetricThreadSpec("M8"),
+			opts: &ThreadMillOptions{ToolDiameter: 5, Length: 2.5, RadialPasses: 2},
+			want: []string{
+				"G1 Z-2.81250000\nG3 X1.16170875 Y0.00000000 Z-2.50000000 I0.58085437 J0.00000000\n",
+				"G3 X1.50000000 Y0.00000000 Z0.00000000 I1.50000000 J0.00000000\nG3 X0.00000000 Y0.00000000 Z0.31250000 I-0.75000000 J0.00000000\n",
+			},
+		},
+		{
+			name: "left hand climbs top-down",
+			spec: ThreadSpec{Major: 8, Pitch: 1.25, LeftHand: true},
+			opts: &ThreadMillOptions{ToolDiameter: 5, Length: 1.25},
+			want: []string{"G0 Z0.31250000\nG3 X1.50000000 Y0.00000000 Z0.00000000 I0.75000000 J0.00000000\nG3 X-1.50000000 Y0.00000000 Z-0.62500000"},
+		},
+		{
+			name: "tapered",
+			spec: NPTThreadSpec("1/4"),
+			opts: &ThreadMillOptions{ToolDiameter: 6, Length: 2, Direction: ThreadTopDown},
+			want: []string{"G2 X3.85800000 Y0.00000000 Z0.00000000 I1.92900000 J0.00000000\nG2 X-3.83595139 Y0.00000000 Z-0.70555556"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(NoHeader)
+			ThreadMill(g, XY(0, 0), tt.spec, tt.opts)
+			got := g.String()
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("ThreadMill =\n%v\nwant:\n%v", got, want)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"log"
 	"math"
+	"slices"
 
 	. "github.com/gmlewis/go-gcode/gcode"
 )
@@ -42,9 +43,109 @@ const (
 //
 // Return value: none
 func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
+	TracePathCompWithOptions(g, width, flags, nil, path...)
+}
+
+// TracePathCompWithEntry is like TracePathComp but enters the material
+// at the start of the entry move using the entry strategy.
+func TracePathCompWithEntry(g *GCode, width float64, flags TPCOptions, entry *EntryOptions, path ...Tuple) {
+	TracePathCompWithOptions(g, width, flags, &TraceOptions{Entry: entry}, path...)
+}
+
+// TracePathCompWithOptions is like TracePathComp but with the entry
+// strategy, holding tabs, depth passes and finishing passes of opts.
+// The lead-in and lead-out moves are never lifted over tabs. Each
+// stepped pass is cut at the Z of the path, but no lower than the
+// pass, and all but the last return to the entry Z-coordinate.
+// Spirals require a closed path.
+func TracePathCompWithOptions(g *GCode, width float64, flags TPCOptions, opts *TraceOptions, path ...Tuple) {
 	if len(path) == 0 {
 		return
 	}
+	if opts == nil {
+		opts = &TraceOptions{}
+	}
+	bottom := tpcBottom(flags, path)
+	f := opts.Finish
+	if f == nil {
+		tpcPasses(g, width, flags, opts, bottom, path)
+		return
+	}
+	radial := getFloat(f.RadialStock, 0)
+	axial := getFloat(f.AxialStock, 0)
+	if radial < 0 || axial < 0 || f.SpringPasses < 0 {
+		log.Fatalf("invalid RadialStock %v, AxialStock %v or SpringPasses %v", radial, axial, f.SpringPasses)
+	}
+	rough := make([]Tuple, len(path))
+	for i, p := range path {
+		rough[i] = clampZ(p, bottom+axial)
+	}
+	tpcPasses(g, width+radial, flags|TPCOldZ, opts, bottom, rough)
+
+	if f.Feedrate != nil {
+		g.Feedrate(*f.Feedrate)
+	}
+	if f.SpindleSpeed != nil {
+		g.SpindleOnCW(*f.SpindleSpeed)
+	}
+	g.Pathmode(true)
+	for k := 0; k <= f.SpringPasses; k++ {
+		passFlags := flags
+		if k < f.SpringPasses {
+			passFlags |= TPCOldZ
+		}
+		tracePathComp(g, width, passFlags, passEntry(opts.Entry, bottom+axial, false), opts.Tabs, bottom, nil, path)
+	}
+}
+
+// tpcPasses traces the path in the depth passes of opts.
+func tpcPasses(g *GCode, width float64, flags TPCOptions, opts *TraceOptions, bottom float64, path []Tuple) {
+	d := opts.Depth
+	switch {
+	case d == nil:
+		tracePathComp(g, width, flags, opts.Entry, opts.Tabs, bottom, nil, path)
+	case d.Spiral:
+		laps := d.laps(tpcBottom(flags, path))
+		tracePathComp(g, width, flags, passEntry(opts.Entry, laps[0][0], true), opts.Tabs, bottom, laps, path)
+	default:
+		top, levels := d.levels(tpcBottom(flags, path))
+		for k, level := range levels {
+			pass := make([]Tuple, len(path))
+			for i, p := range path {
+				pass[i] = clampZ(p, level)
+			}
+			passFlags := flags
+			if k < len(levels)-1 {
+				passFlags |= TPCOldZ
+			}
+			if d.Reverse && k%2 == 1 {
+				// Keep the tool on the same side of the reversed path.
+				slices.Reverse(pass)
+				if flags&TPCClosed > 0 {
+					pass = append(pass[len(pass)-1:], pass[:len(pass)-1]...)
+				}
+				passFlags ^= TPCLeft
+			}
+			tracePathComp(g, width, passFlags, passEntry(opts.Entry, top, k == 0), opts.Tabs, bottom, nil, pass)
+			top = level
+		}
+	}
+}
+
+// tpcBottom returns the lowest Z of the path.
+func tpcBottom(flags TPCOptions, path []Tuple) float64 {
+	bottom := path[0].Z()
+	if flags&TPCKeepZ == 0 {
+		for _, p := range path {
+			bottom = math.Min(bottom, p.Z())
+		}
+	}
+	return bottom
+}
+
+// tracePathComp traces a pass along the path with tabs rising from
+// bottom, or spirals down the laps if laps is not nil.
+func tracePathComp(g *GCode, width float64, flags TPCOptions, entry *EntryOptions, tabOpts *TabOptions, bottom float64, laps [][2]float64, path []Tuple) {
 	if width <= 0.0 {
 		log.Fatal("width must be positive")
 	}
@@ -73,6 +174,9 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 		path = path[0 : len(path)-1]
 		flags |= TPCClosed
 	}
+	if laps != nil && flags&TPCClosed == 0 {
+		log.Fatal("spiral depth passes require a closed path")
+	}
 
 	var normal, dir []Tuple
 	path, normal, dir = calcDirs(side, path)
@@ -188,15 +292,18 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 		}
 	}
 
-	// Entry into first segment
+	// Entry into first segment; ramps run along it. Spirals enter at their top.
+	top := math.Inf(-1)
+	if laps != nil {
+		top = laps[0][0]
+	}
+	ramp := dir[0].MultScalar(length2D(path[1%len(path)].Sub(path[0])))
 	if flags&TPCArcIn > 0 {
-		p := path[0].Add(normal[0].MultScalar(2).Sub(dir[0]).MultScalar(width))
+		p := clampZ(path[0].Add(normal[0].MultScalar(2).Sub(dir[0]).MultScalar(width)), top)
 		// log.Printf("path[0]=%v, normal[0]=%v, dir[0]=%v, p=%v", path[0], normal[0], dir[0], p)
-		g.GotoXY(p) // Rapid without Z
-		// g.Comment("GML: MoveXYZ - A")
-		g.MoveXYZ(p) // Move with Z
+		enter(g, p, p.Add(ramp), width, entry, nil)
 		// Arc into the first segment's start point
-		p = path[0].Add(normal[0].MultScalar(width))
+		p = clampZ(path[0].Add(normal[0].MultScalar(width)), top)
 		if side > 0.0 {
 			// log.Printf("GML1: g.ArcCW(p=%v, width=%v, nil)", p, width)
 			g.ArcCW(p, width, nil)
@@ -204,12 +311,16 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 			g.ArcCCW(p, width, nil)
 		}
 	} else {
-		p := path[0].Add(normal[0].MultScalar(2.0 * width))
-		g.GotoXY(p) // Rapid without Z
-		// g.Comment("GML: MoveXYZ - B")
-		g.MoveXYZ(p) // Move with Z
+		p := clampZ(path[0].Add(normal[0].MultScalar(2.0*width)), top)
+		enter(g, p, p.Add(ramp), width, entry, nil)
 	}
 
+	// Moves along the path are recorded so that tabs may be placed on them.
+	// Spirals also need the corner arc closing the lap, if any.
+	var moves []tpcMove
+	var closing []tpcMove
+	move := func(kind tpcMoveT, p Tuple) { moves = append(moves, tpcMove{kind: kind, p: p}) }
+
 	// A closed path ends at the first point, loop once more
 	npath = len(path)
 	n := npath
@@ -236,19 +347,19 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 				} else {
 					// Don't delete the last entry for closure
 					// g.Comment("GML: MoveXYZ - C")
-					g.MoveXYZ(path[j].Add(normal[j].MultScalar(width)))
+					move(tpcLine, path[j].Add(normal[j].MultScalar(width)))
 				}
 			} else {
 				// 180 degree turn; wrong side 180'ies have already been deleted
 				// Move to end of segment
 				// g.Comment("GML: MoveXYZ - D")
-				g.MoveXYZ(path[j].Sub(normal[j].MultScalar(width)))
+				move(tpcLine, path[j].Sub(normal[j].MultScalar(width)))
 				if i < n-1 { // Only if not last
 					// Arc with 180 degrees
 					if side > 0.0 {
-						g.ArcCCWRel(normal[j].MultScalar(width*2.0), width, nil)
+						move(tpcArcCCWRel, normal[j].MultScalar(width*2.0))
 					} else {
-						g.ArcCWRel(normal[j].MultScalar(width*2.0), width, nil)
+						move(tpcArcCWRel, normal[j].MultScalar(width*2.0))
 					}
 				}
 			}
@@ -263,22 +374,37 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 			// End at the projected direction of the next segment
 			tmp := path[j].Add(normal[j].Add(dir[j].MultScalar(side * crossP / dotP)).MultScalar(width))
 			// g.Comment("GML: MoveXYZ - E: crossP=", crossP, ", dotP=", dotP, ", path[j]=", path[j], ", normal[j]=", normal[j], ", dir[j]=", dir[j], ", tmp=", tmp)
-			g.MoveXYZ(tmp)
+			move(tpcLine, tmp)
 		} else {
 			// Outside angle move
 			// g.Comment("GML: MoveXYZ - F")
-			g.MoveXYZ(path[j].Add(normal[(j+npath-1)%npath].MultScalar(width)))
+			move(tpcLine, path[j].Add(normal[(j+npath-1)%npath].MultScalar(width)))
 			if i < n-1 { // Only is not last
 				// Arc around the angle
 				if side > 0.0 {
-					g.ArcCCW(path[j].Add(normal[j].MultScalar(width)), width, nil)
+					move(tpcArcCCW, path[j].Add(normal[j].MultScalar(width)))
 				} else {
-					g.ArcCW(path[j].Add(normal[j].MultScalar(width)), width, nil)
+					move(tpcArcCW, path[j].Add(normal[j].MultScalar(width)))
 				}
+			} else if side > 0.0 {
+				closing = []tpcMove{{kind: tpcArcCCW, p: path[j].Add(normal[j].MultScalar(width))}}
+			} else {
+				closing = []tpcMove{{kind: tpcArcCW, p: path[j].Add(normal[j].MultScalar(width))}}
 			}
 		}
 	}
 
+	if laps == nil {
+		tpcEmit(g, width, bottom, tabOpts, moves)
+	}
+	for k, lap := range laps {
+		lapMoves := moves
+		if k < len(laps)-1 {
+			lapMoves = append(moves[:len(moves):len(moves)], closing...)
+		}
+		tpcEmit(g, width, bottom, tabOpts, tpcLap(g.Position(), width, lap, lapMoves))
+	}
+
 	// Exit the path
 	i--
 	i = i % npath
@@ -302,6 +428,92 @@ func TracePathComp(g *GCode, width float64, flags TPCOptions, path ...Tuple) {
 	g.Comment("-- tracepath_comp end --")
 }
 
+// tpcMoveT represents the kind of a recorded TracePathComp move.
+type tpcMoveT int
+
+const (
+	tpcLine tpcMoveT = iota
+	tpcArcCW
+	tpcArcCCW
+	tpcArcCWRel
+	tpcArcCCWRel
+)
+
+// tpcMove represents a recorded TracePathComp move along the path.
+type tpcMove struct {
+	kind tpcMoveT
+	p    Tuple
+}
+
+// tpcEmit emits the recorded moves with arcs of radius width,
+// lifting over the tabs placed on the straight moves.
+func tpcEmit(g *GCode, width, bottom float64, tabOpts *TabOptions, moves []tpcMove) {
+	var cuts [][2]Tuple
+	lines := make([]int, len(moves))
+	pos := g.Position()
+	for i, m := range moves {
+		next := m.p
+		if m.kind == tpcArcCWRel || m.kind == tpcArcCCWRel {
+			next = pos.Add(m.p)
+		}
+		if m.kind == tpcLine {
+			lines[i] = len(cuts)
+			cuts = append(cuts, [2]Tuple{pos, next})
+		}
+		pos = next
+	}
+	t := newTabs(tabOpts, 2*width, bottom, cuts)
+
+	for i, m := range moves {
+		switch m.kind {
+		case tpcLine:
+			t.cut(g, lines[i], m.p)
+		case tpcArcCW:
+			g.ArcCW(m.p, width, nil)
+		case tpcArcCCW:
+			g.ArcCCW(m.p, width, nil)
+		case tpcArcCWRel:
+			g.ArcCWRel(m.p, width, nil)
+		case tpcArcCCWRel:
+			g.ArcCCWRel(m.p, width, nil)
+		}
+	}
+}
+
+// tpcLap returns the moves from start descending along the lap in
+// proportion to the distance traveled, but no lower than the moves.
+func tpcLap(start Tuple, width float64, lap [2]float64, moves []tpcMove) []tpcMove {
+	ends := make([]Tuple, len(moves))
+	traveled := make([]float64, len(moves))
+	pos := start
+	var length float64
+	for i, m := range moves {
+		ends[i] = m.p
+		if m.kind == tpcArcCWRel || m.kind == tpcArcCCWRel {
+			ends[i] = pos.Add(m.p)
+		}
+		d := length2D(ends[i].Sub(pos))
+		if m.kind != tpcLine {
+			d = 2 * width * math.Asin(math.Min(1, d/(2*width)))
+		}
+		length += d
+		traveled[i] = length
+		pos = ends[i]
+	}
+
+	r := make([]tpcMove, len(moves))
+	z := start.Z()
+	for i, m := range moves {
+		end := lapPoint(ends[i], lap, traveled[i], length)
+		r[i] = tpcMove{kind: m.kind, p: end}
+		if m.kind == tpcArcCWRel || m.kind == tpcArcCCWRel {
+			r[i].p = XYZ(m.p.X(), m.p.Y(), end.Z()-z)
+		}
+		z = end.Z()
+	}
+	return r
+}
+
 func calcDirs(side float64, path []Tuple) (_ []Tuple, normal []Tuple, dir []Tuple) {
 	npath := len(path)
 	for i := 0; i < npath; i++ {
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+func TestTracePathCompFinish(t *testing.T) {
+	g := New(NoHeader)
+	g.GotoZ(Z(5))
+	finish := &FinishOptions{
+		RadialStock:  Float(0.5),
+		AxialStock:   Float(0.2),
+		Feedrate:     Float(150),
+		SpindleSpeed: Float(12000),
+		SpringPasses: 1,
+	}
+	TracePathCompWithOptions(g, 1, TPCClosed|TPCOldZ, &TraceOptions{Finish: finish},
+		XYZ(0, 0, -3), XYZ(0, 10, -3), XYZ(10, 10, -3), XYZ(10, 0, -3))
+	pass := `(-- tracepath_comp at right side at width=1 --)
+G0 X2.00000000 Y0.00000000
+G0 Z-2.80000000
+G1 Z-3.00000000
+G1 X1.00000000 Y9.00000000
+G1 X9.00000000
+G1 Y1.00000000
+G1 X1.00000000
+G1 Y2.00000000
+G0 Z5.00000000
+(-- tracepath_comp end --)
+`
+	want := `G0 Z5.00000000
+(-- tracepath_comp at right side at width=1.5 --)
+G0 X3.00000000
+G1 Z-2.80000000
+G1 X1.50000000 Y8.50000000
+G1 X8.50000000
+G1 Y1.50000000
+G1 X1.50000000
+G1 Y3.00000000
+G0 Z5.00000000
+(-- tracepath_comp end --)
+F150.00000000
+M3 S12000
+G61
+` + pass + pass
+	if got := g.String(); got != want {
+		t.Errorf("TracePathCompWithOptions =\n%v\nwant:\n%v", got, want)
+	}
+}
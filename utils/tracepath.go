@@ -19,26 +19,137 @@ import (
 //
 // Return value: none
 func TracePath(g *GCode, z, dw float64, path ...Tuple) {
+	TracePathWithOptions(g, z, dw, nil, path...)
+}
+
+// TraceOptions represents the options of TracePath and TracePathComp.
+type TraceOptions struct {
+	// Entry is the entry strategy. Default is a plunge.
+	Entry *EntryOptions
+	// Tabs are the holding tabs left on the path. Default is no tabs.
+	Tabs *TabOptions
+	// Depth steps the cut down in several passes. Default is a single
+	// pass at the depth of the path.
+	Depth *DepthOptions
+	// Finish leaves stock for finishing passes. Only used by TracePathComp.
+	// Default is no finishing passes.
+	Finish *FinishOptions
+}
+
+// FinishOptions represents the finishing passes of a profile, which
+// follow the roughing passes leaving stock. The finishing feedrate,
+// spindle speed and exact path mode remain in effect afterwards.
+type FinishOptions struct {
+	// RadialStock is the stock left on the walls by the roughing passes.
+	// Default is 0.
+	RadialStock *float64
+	// AxialStock is the stock left on the floor by the roughing passes.
+	// Default is 0.
+	AxialStock *float64
+	// Feedrate is the feedrate of the finishing passes.
+	// Default is the current feedrate.
+	Feedrate *float64
+	// SpindleSpeed is the clockwise spindle speed in RPM of the
+	// finishing passes. Default is the current speed.
+	SpindleSpeed *float64
+	// SpringPasses is the number of finishing passes repeated with no
+	// additional stock to remove the material left by tool deflection.
+	SpringPasses int
+}
+
+// TracePathWithEntry is like TracePath but enters the material
+// at the first path entry using the entry strategy.
+func TracePathWithEntry(g *GCode, z, dw float64, entry *EntryOptions, path ...Tuple) {
+	TracePathWithOptions(g, z, dw, &TraceOptions{Entry: entry}, path...)
+}
+
+// TracePathWithOptions is like TracePath but with the entry strategy,
+// holding tabs and depth passes of opts. As the tool size is unknown,
+// the tab width is measured along the path rather than on the material.
+func TracePathWithOptions(g *GCode, z, dw float64, opts *TraceOptions, path ...Tuple) {
 	if len(path) == 0 {
 		return
 	}
+	if opts == nil {
+		opts = &TraceOptions{}
+	}
+	d := opts.Depth
+	switch {
+	case d == nil:
+		tracePath(g, z, dw, opts.Entry, opts.Tabs, z, nil, path)
+	case d.Spiral:
+		laps := d.laps(z)
+		tracePath(g, laps[0][0], dw, passEntry(opts.Entry, laps[0][0], true), opts.Tabs, z, laps, path)
+	default:
+		top, levels := d.levels(z)
+		for k, level := range levels {
+			p := path
+			if d.Reverse && k%2 == 1 {
+				p = reversePath(path)
+			}
+			tracePath(g, level, dw, passEntry(opts.Entry, top, k == 0), opts.Tabs, z, nil, p)
+			top = level
+		}
+	}
+}
+
+// tracePath traces a pass at z with tabs rising from bottom,
+// or spirals down the laps from z if laps is not nil.
+func tracePath(g *GCode, z, dw float64, entry *EntryOptions, tabOpts *TabOptions, bottom float64, laps [][2]float64, path []Tuple) {
 	g.Comment("-- tracepath at Z=", z, " --")
 	oldZ := g.Position().Z()
-	g.GotoXY(path[0])
-	g.MoveZ(Z(z))
+	next := path[0]
+	if len(path) > 1 {
+		next = path[1]
+	}
+	enter(g, XYZ(path[0].X(), path[0].Y(), z), next, 0, entry, nil)
 	if dw >= 0.0 {
 		g.Dwell(dw)
 	}
-	for _, p := range path {
-		g.MoveXY(p)
-		if dw >= 0.0 {
-			g.Dwell(dw)
+	floor := z
+	if laps != nil {
+		floor = bottom
+	}
+	at := func(i int) Tuple {
+		p := path[i%len(path)]
+		return XYZ(p.X(), p.Y(), floor)
+	}
+	cuts := make([][2]Tuple, len(path))
+	var length float64
+	for i := range path {
+		cuts[i] = [2]Tuple{at(i), at(i + 1)}
+		length += length2D(cuts[i][1].Sub(cuts[i][0]))
+	}
+	t := newTabs(tabOpts, 0, bottom, cuts)
+	if laps == nil {
+		laps = [][2]float64{{z, z}}
+	}
+	for _, lap := range laps {
+		// Descend along the lap in proportion to the distance traveled.
+		var traveled float64
+		for i := range path {
+			if i > 0 {
+				traveled += length2D(cuts[i-1][1].Sub(cuts[i-1][0]))
+				t.cut(g, i-1, lapPoint(at(i), lap, traveled, length))
+			}
+			if dw >= 0.0 {
+				g.Dwell(dw)
+			}
 		}
+		t.cut(g, len(path)-1, lapPoint(at(0), lap, length, length))
 	}
-	g.MoveXY(path[0])
 	if dw >= 0.0 {
 		g.Dwell(dw)
 	}
 	g.MoveZ(Z(oldZ))
 	g.Comment("-- tracepath end --")
 }
+
+// lapPoint returns p at the Z reached after traveling the distance along
+// a lap of the given length, but no lower than p.
+func lapPoint(p Tuple, lap [2]float64, traveled, length float64) Tuple {
+	if length < epsilon {
+		return clampZ(p, lap[1])
+	}
+	return clampZ(p, lap[0]-(lap[0]-lap[1])*traveled/length)
+}
@@ -2,3 +2,7 @@
 // It is based on the examples here:
 // https://gitlab.com/gcmc/gcmc/blob/master/library
 package utils
+
+// defaultSafeHeight is the default height above the top of the stock
+// of the rapids before and after an operation.
+const defaultSafeHeight = 5 // mm
@@ -0,0 +1,412 @@
+package utils
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+const (
+	defaultVCarveClearance    = 1.0 // mm
+	defaultVCarveFlatStepover = 50  // percent of the flat tool diameter
+	vcarveResolution          = 200 // boundary samples across the shapes
+)
+
+// VCarveOptions represents options for the VCarve and VCarveFlat functions.
+type VCarveOptions struct {
+	// Angle is the included angle of the V-bit in degrees.
+	Angle float64
+	// MaxDepth, if set, caps the depth of the V-bit below Top. The areas
+	// too wide for the V-bit at MaxDepth have a flat bottom at MaxDepth.
+	MaxDepth *float64
+	// Top is the Z of the top of the material. Default is 0.
+	Top *float64
+	// Clearance is the height above Top of the retracts between cuts.
+	// Default is 1.
+	Clearance *float64
+	// SafeZ is the Z of the rapids before and after carving.
+	// Default is 5 above Top.
+	SafeZ *float64
+	// Resolution is the spacing of the samples of the shapes used to
+	// find their medial axis, and of the grid used to offset them.
+	// Default is 1/200th of the larger side of the shapes.
+	Resolution *float64
+	// FlatStepover is the distance between the passes of VCarveFlat in
+	// percent of the flat tool diameter. Default is 50.
+	FlatStepover *float64
+	// Feedrate, if set, is the feedrate of the cuts.
+	Feedrate *float64
+}
+
+// VCarve carves the closed shapes (such as the paths of SplitPaths from
+// Typeset, or imported artwork) with a V-bit. Overlapping shapes follow
+// the even-odd rule, so the holes of letters are left uncut.
+//
+// The V-bit follows the medial axis of the shapes, plunging at each point
+// to the depth at which its cone touches the nearest walls on both sides,
+// and rising into the sharp corners. When MaxDepth caps the depth, the
+// V-bit also traces the walls of the areas too wide for it at MaxDepth;
+// their flat bottoms are then cleared by VCarveFlat after a tool change.
+func VCarve(g *GCode, shapes [][]Tuple, opts *VCarveOptions) {
+	v := newVCarver(g, shapes, opts)
+	rCap := v.maxDepth * v.tanHalf
+
+	var cuts [][]Tuple
+	var wide bool
+	for _, chain := range v.medialAxis() {
+		var points []Tuple
+		for _, p := range chain {
+			// p.Z() is the distance to the walls.
+			wide = wide || p.Z() > rCap
+			points = append(points, XYZ(p.X(), p.Y(), v.top-math.Min(p.Z()/v.tanHalf, v.maxDepth)))
+		}
+		cuts = append(cuts, simplifyTolerance(points, v.res/4))
+	}
+	if wide {
+		field, at, _ := v.field()
+		for _, loop := range contourPoints(field, rCap, at) {
+			var points []Tuple
+			for _, p := range loop {
+				points = append(points, XYZ(p.X(), p.Y(), v.top-v.maxDepth))
+			}
+			cuts = append(cuts, simplifyTolerance(points, v.res/4))
+		}
+	}
+
+	g.Comment("-- vcarve angle=", opts.Angle, " --")
+	v.run(cuts)
+	g.Comment("-- end vcarve --")
+}
+
+// VCarveFlat clears the flat bottoms left by VCarve at MaxDepth with a
+// flat end mill of the given diameter, following the offsets of the
+// walls of the V-carving from the middle of each area outward. With a
+// FlatStepover above 50, the middles left between the last passes are
+// cleared along the medial axis of the shapes.
+func VCarveFlat(g *GCode, shapes [][]Tuple, toolDiameter float64, opts *VCarveOptions) {
+	if toolDiameter <= 0 {
+		log.Fatalf("invalid tool diameter %v", toolDiameter)
+	}
+	v := newVCarver(g, shapes, opts)
+	if math.IsInf(v.maxDepth, 1) {
+		log.Fatal("VCarveFlat: MaxDepth must be set")
+	}
+	stepover := getFloat(opts.FlatStepover, defaultVCarveFlatStepover)
+	if stepover <= 0 || stepover > 100 {
+		log.Fatalf("invalid FlatStepover %v", stepover)
+	}
+	step := stepover / 100 * toolDiameter
+	z := v.top - v.maxDepth
+
+	// The edge of the tool reaches the bottom of the walls of the V-bit.
+	first := v.maxDepth*v.tanHalf + toolDiameter/2
+	field, at, far := v.field()
+	var levels []float64
+	for level := first; level < far; level += step {
+		levels = append(levels, level)
+	}
+	if len(levels) == 0 {
+		log.Printf("WARNING: VCarveFlat: no flat bottom is wide enough for a tool of diameter %v", toolDiameter)
+	}
+	var cuts [][]Tuple
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, loop := range contourPoints(field, levels[i], at) {
+			var points []Tuple
+			for _, p := range loop {
+				points = append(points, XYZ(p.X(), p.Y(), z))
+			}
+			cuts = append(cuts, simplifyTolerance(points, v.res/4))
+		}
+	}
+
+	// With a stepover above 50%, the last pass of each area may be too
+	// far from its middle, which is then cleared along the medial axis
+	// wherever it is more than the tool radius from the pass below it.
+	if step > toolDiameter/2 && len(levels) > 0 {
+		for _, chain := range v.medialAxis() {
+			var points []Tuple
+			flush := func() {
+				if len(points) > 0 {
+					cuts = append(cuts, simplifyTolerance(points, v.res/4))
+				}
+				points = nil
+			}
+			for _, p := range chain {
+				r := p.Z()
+				below := math.Min(first+(math.Ceil((r-first)/step)-1)*step, levels[len(levels)-1])
+				if r < first || r-below <= toolDiameter/2 {
+					flush()
+					continue
+				}
+				points = append(points, XYZ(p.X(), p.Y(), z))
+			}
+			flush()
+		}
+	}
+
+	g.Comment("-- vcarve flat diameter=", toolDiameter, " depth=", v.maxDepth, " --")
+	v.run(cuts)
+	g.Comment("-- end vcarve flat --")
+}
+
+// vcarver holds the state of a V-carving operation.
+type vcarver struct {
+	g        *GCode
+	shapes   [][]Tuple
+	tanHalf  float64
+	maxDepth float64
+	top      float64
+	retractZ float64
+	safeZ    float64
+	res      float64
+	feedrate *float64
+}
+
+func newVCarver(g *GCode, shapes [][]Tuple, opts *VCarveOptions) *vcarver {
+	if opts == nil || opts.Angle <= 0 || opts.Angle >= 180 {
+		log.Fatal("VCarve: Angle must be between 0 and 180 degrees")
+	}
+	v := &vcarver{
+		g:        g,
+		tanHalf:  math.Tan(ToRad(opts.Angle / 2)),
+		maxDepth: getFloat(opts.MaxDepth, math.Inf(1)),
+		top:      getFloat(opts.Top, 0),
+		feedrate: opts.Feedrate,
+	}
+	if v.maxDepth <= 0 {
+		log.Fatalf("invalid MaxDepth %v", v.maxDepth)
+	}
+	var all []Tuple
+	for _, shape := range shapes {
+		// Drop the closing point of closed shapes.
+		if n := len(shape); n > 1 && length2D(shape[0].Sub(shape[n-1])) < epsilon {
+			shape = shape[:n-1]
+		}
+		if len(shape) < 3 {
+			continue
+		}
+		var s []Tuple
+		for _, p := range shape {
+			s = append(s, XY(p.X(), p.Y()))
+		}
+		v.shapes = append(v.shapes, s)
+		all = append(all, s...)
+	}
+	if len(v.shapes) == 0 {
+		log.Fatal("VCarve: no shape has at least 3 points")
+	}
+	min, max := polygonBounds(all)
+	size := math.Max(max.X()-min.X(), max.Y()-min.Y())
+	v.res = getFloat(opts.Resolution, size/vcarveResolution)
+	v.retractZ = v.top + getFloat(opts.Clearance, defaultVCarveClearance)
+	if v.res <= 0 || v.retractZ <= v.top {
+		log.Fatalf("invalid Resolution %v or Clearance %v", v.res, v.retractZ-v.top)
+	}
+	v.safeZ = math.Max(getFloat(opts.SafeZ, v.top+defaultSafeHeight), v.retractZ)
+	return v
+}
+
+// inside reports whether p is inside the shapes by the even-odd rule.
+func (v *vcarver) inside(p Tuple) bool {
+	return insideShapes(p, v.shapes)
+}
+
+// medialAxis returns the branches of the medial axis of the shapes.
+func (v *vcarver) medialAxis() [][]Tuple {
+	return medialAxis(v.shapes, v.res)
+}
+
+// insideShapes reports whether p is inside the shapes by the even-odd rule.
+func insideShapes(p Tuple, shapes [][]Tuple) bool {
+	var inside bool
+	for _, s := range shapes {
+		if insidePolygon(p, s) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// medialAxis returns the branches of the medial axis of the closed shapes
+// (by the even-odd rule) sampled every res, with the distance to the
+// walls in Z.
+//
+// The medial axis is approximated by the Voronoi diagram of samples of
+// the walls: the circumcenters of the Delaunay triangles inside the
+// shapes, linked across their shared edges.
+func medialAxis(shapes [][]Tuple, res float64) [][]Tuple {
+	// Jitter the samples slightly so that no four are cocircular.
+	rnd := rand.New(rand.NewSource(1))
+	var samples [][2]float64
+	for _, s := range shapes {
+		for i, a := range s {
+			b := s[(i+1)%len(s)]
+			n := int(math.Ceil(length2D(b.Sub(a)) / res))
+			for k := 0; k < n; k++ {
+				p := a.Add(b.Sub(a).MultScalar(float64(k) / float64(n)))
+				samples = append(samples, [2]float64{
+					p.X() + (rnd.Float64()-0.5)*res*1e-3,
+					p.Y() + (rnd.Float64()-0.5)*res*1e-3,
+				})
+			}
+		}
+	}
+
+	var nodes []Tuple
+	edges := map[[2]int][]int{} // triangle edge to the nodes sharing it
+	for _, t := range delaunay(samples) {
+		// Slivers along the walls have their circumcenters outside.
+		a, b, c := samples[t.v[0]], samples[t.v[1]], samples[t.v[2]]
+		if !insideShapes(XY((a[0]+b[0]+c[0])/3, (a[1]+b[1]+c[1])/3), shapes) || !insideShapes(XY(t.cx, t.cy), shapes) {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			i, j := t.v[k], t.v[(k+1)%3]
+			if i > j {
+				i, j = j, i
+			}
+			edges[[2]int{i, j}] = append(edges[[2]int{i, j}], len(nodes))
+		}
+		nodes = append(nodes, XYZ(t.cx, t.cy, math.Sqrt(t.r2)))
+	}
+	adj := make([][]int, len(nodes))
+	for _, e := range edges {
+		if len(e) == 2 {
+			adj[e[0]] = append(adj[e[0]], e[1])
+			adj[e[1]] = append(adj[e[1]], e[0])
+		}
+	}
+
+	// Split the graph into branches between its junctions and ends,
+	// then follow the remaining loops.
+	visited := map[[2]int]bool{}
+	key := func(a, b int) [2]int { return [2]int{min(a, b), max(a, b)} }
+	walk := func(start, next int) []Tuple {
+		chain := []Tuple{nodes[start]}
+		prev, cur := start, next
+		visited[key(prev, cur)] = true
+		for {
+			chain = append(chain, nodes[cur])
+			if len(adj[cur]) != 2 || cur == start {
+				return chain
+			}
+			nxt := adj[cur][0]
+			if nxt == prev {
+				nxt = adj[cur][1]
+			}
+			if visited[key(cur, nxt)] {
+				return chain
+			}
+			visited[key(cur, nxt)] = true
+			prev, cur = cur, nxt
+		}
+	}
+	var chains [][]Tuple
+	for pass := 0; pass < 2; pass++ {
+		for i, ns := range adj {
+			if pass == 0 && len(ns) == 2 {
+				continue
+			}
+			for _, j := range ns {
+				if !visited[key(i, j)] {
+					chains = append(chains, walk(i, j))
+				}
+			}
+		}
+	}
+	return chains
+}
+
+// field returns the signed distance to the walls of the shapes (positive
+// inside) at the nodes of a grid, the position of the nodes, and the
+// largest distance.
+func (v *vcarver) field() ([][]float64, func(i, j int) Tuple, float64) {
+	var all []Tuple
+	for _, s := range v.shapes {
+		all = append(all, s...)
+	}
+	min, max := polygonBounds(all)
+	min, max = min.Sub(XY(2*v.res, 2*v.res)), max.Add(XY(2*v.res, 2*v.res))
+	nx := int(math.Ceil((max.X()-min.X())/v.res)) + 1
+	ny := int(math.Ceil((max.Y()-min.Y())/v.res)) + 1
+	at := func(i, j int) Tuple { return min.Add(XY(float64(i)*v.res, float64(j)*v.res)) }
+	field := make([][]float64, ny)
+	far := math.Inf(-1)
+	for j := range field {
+		field[j] = make([]float64, nx)
+		for i := range field[j] {
+			p := at(i, j)
+			d := math.Inf(1)
+			for _, s := range v.shapes {
+				for k, a := range s {
+					d = math.Min(d, segmentDistance(p, a, s[(k+1)%len(s)]))
+				}
+			}
+			if !v.inside(p) {
+				d = -d
+			}
+			field[j][i] = d
+			far = math.Max(far, d)
+		}
+	}
+	return field, at, far
+}
+
+// run cuts the paths, nearest first. Paths sharing their ends with the
+// position of the tool continue without retracting, and closed paths may
+// start at any of their points.
+func (v *vcarver) run(cuts [][]Tuple) {
+	g := v.g
+	if v.feedrate != nil {
+		g.Feedrate(*v.feedrate)
+	}
+	g.GotoZ(Z(v.safeZ))
+	down := false
+	for len(cuts) > 0 {
+		pos := g.Position()
+		best, bestK, bestD := 0, 0, math.Inf(1)
+		for i, c := range cuts {
+			for k, p := range c {
+				if !vcarveClosed(c) && k != 0 && k != len(c)-1 {
+					continue
+				}
+				if d := p.Sub(pos).Magnitude(); d < bestD {
+					best, bestK, bestD = i, k, d
+				}
+			}
+		}
+		path := cuts[best]
+		cuts = append(cuts[:best], cuts[best+1:]...)
+		switch {
+		case !vcarveClosed(path) && bestK > 0:
+			r := make([]Tuple, 0, len(path))
+			for i := len(path) - 1; i >= 0; i-- {
+				r = append(r, path[i])
+			}
+			path = r
+		case vcarveClosed(path) && bestK > 0 && bestK < len(path)-1:
+			path = append(append([]Tuple{}, path[bestK:len(path)-1]...), path[:bestK+1]...)
+		}
+
+		if !down || bestD > v.res {
+			if down {
+				g.GotoZ(Z(v.retractZ))
+			}
+			g.GotoXY(path[0])
+			if g.Position().Z() > v.retractZ {
+				g.GotoZ(Z(v.retractZ))
+			}
+			g.MoveZ(path[0])
+			down = true
+		}
+		g.MoveXYZ(path[1:]...)
+	}
+	g.GotoZ(Z(v.safeZ))
+}
+
+// vcarveClosed reports whether the path ends where it starts.
+func vcarveClosed(path []Tuple) bool {
+	return len(path) > 2 && length2D(path[0].Sub(path[len(path)-1])) < epsilon
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/gmlewis/go-gcode/gcode"
+)
+
+// cutPoints returns the end points of the G1 moves of the G-code.
+func cutPoints(t *testing.T, gcode string) []Tuple {
+	t.Helper()
+	var pos [3]float64
+	var cuts []Tuple
+	for _, line := range strings.Split(gcode, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (fields[0] != "G0" && fields[0] != "G1") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil {
+				t.Fatalf("bad line %q: %v", line, err)
+			}
+			pos[strings.IndexByte("XYZ", f[0])] = v
+		}
+		if fields[0] == "G1" {
+			cuts = append(cuts, XYZ(pos[0], pos[1], pos[2]))
+		}
+	}
+	return cuts
+}
+
+// cutSegments returns the start and end points of the G1 moves of the G-code.
+func cutSegments(t *testing.T, gcode string) [][2]Tuple {
+	t.Helper()
+	var pos [3]float64
+	var cuts [][2]Tuple
+	for _, line := range strings.Split(gcode, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (fields[0] != "G0" && fields[0] != "G1") {
+			continue
+		}
+		from := XYZ(pos[0], pos[1], pos[2])
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil {
+				t.Fatalf("bad line %q: %v", line, err)
+			}
+			pos[strings.IndexByte("XYZ", f[0])] = v
+		}
+		if fields[0] == "G1" {
+			cuts = append(cuts, [2]Tuple{from, XYZ(pos[0], pos[1], pos[2])})
+		}
+	}
+	return cuts
+}
+
+func TestVCarveRect(t *testing.T) {
+	rect := [][]Tuple{{XY(0, 0), XY(10, 0), XY(10, 4), XY(0, 4)}}
+	tests := []struct {
+		name     string
+		maxDepth *float64
+		want     float64
+	}{
+		{name: "full depth", want: -2},
+		{name: "capped", maxDepth: Float(0.5), want: -0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(NoHeader)
+			VCarve(g, rect, &VCarveOptions{Angle: 90, MaxDepth: tt.maxDepth, Resolution: Float(0.05)})
+			cuts := cutPoints(t, g.String())
+			low := math.Inf(1)
+			for _, p := range cuts {
+				if p.X() < -0.05 || p.X() > 10.05 || p.Y() < -0.05 || p.Y() > 4.05 {
+					t.Fatalf("cut at %v outside of the shape", p)
+				}
+				// A 90 degree V-bit touches the nearest wall at the top.
+				d := math.Min(math.Min(p.X(), 10-p.X()), math.Min(p.Y(), 4-p.Y()))
+				if depth := -p.Z(); depth > d+0.05 {
+					t.Fatalf("cut at %v is %v deep, want at most %v", p, depth, d)
+				}
+				low = math.Min(low, p.Z())
+			}
+			if math.Abs(low-tt.want) > 0.05 {
+				t.Errorf("deepest cut = %v, want %v", low, tt.want)
+			}
+		})
+	}
+}
+
+func TestVCarveCorners(t *testing.T) {
+	// The V-bit rises into the sharp corners of the shape.
+	g := New(NoHeader)
+	VCarve(g, [][]Tuple{{XY(0, 0), XY(10, 0), XY(10, 4), XY(0, 4)}}, &VCarveOptions{Angle: 60, Resolution: Float(0.05)})
+	for _, corner := range []Tuple{XY(0, 0), XY(10, 0), XY(10, 4), XY(0, 4)} {
+		var found bool
+		for _, p := range cutPoints(t, g.String()) {
+			if length2D(p.Sub(corner)) < 0.2 && p.Z() > -0.2 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no shallow cut near corner %v", corner)
+		}
+	}
+}
+
+func TestVCarveHole(t *testing.T) {
+	// The hole of the inner square is left uncut.
+	shapes := [][]Tuple{
+		{XY(0, 0), XY(10, 0), XY(10, 10), XY(0, 10)},
+		{XY(2, 2), XY(8, 2), XY(8, 8), XY(2, 8)},
+	}
+	g := New(NoHeader)
+	VCarve(g, shapes, &VCarveOptions{Angle: 90, Resolution: Float(0.05)})
+	for _, p := range cutPoints(t, g.String()) {
+		if p.X() > 2.05 && p.X() < 7.95 && p.Y() > 2.05 && p.Y() < 7.95 {
+			t.Fatalf("cut at %v inside of the hole", p)
+		}
+		// The widest parts of the ring are at its corners.
+		if p.Z() < -2*math.Sqrt2/(1+math.Sqrt2)-0.05 {
+			t.Fatalf("cut at %v deeper than the ring allows", p)
+		}
+	}
+}
+
+func TestVCarveFlat(t *testing.T) {
+	g := New(NoHeader)
+	VCarveFlat(g, [][]Tuple{{XY(0, 0), XY(10, 0), XY(10, 4), XY(0, 4)}}, 1, &VCarveOptions{Angle: 90, MaxDepth: Float(0.5), Resolution: Float(0.05)})
+	cuts := cutPoints(t, g.String())
+	if len(cuts) == 0 {
+		t.Fatal("VCarveFlat made no cuts")
+	}
+	for _, p := range cuts {
+		// The edge of the tool stays inside of the walls of the V-bit.
+		if math.Abs(p.Z()+0.5) > epsilon || p.X() < 0.95 || p.X() > 9.05 || p.Y() < 0.95 || p.Y() > 3.05 {
+			t.Fatalf("cut at %v, want inside of (1,1)-(9,3) at Z-0.5", p)
+		}
+	}
+}
+
+func TestVCarveFlat_WideStepover(t *testing.T) {
+	// With a full stepover, the passes alone would miss the middle of
+	// the flat bottoms of both the wide and the narrow rectangle.
+	shapes := [][]Tuple{
+		{XY(0, 0), XY(10, 0), XY(10, 6), XY(0, 6)},
+		{XY(0, 8), XY(10, 8), XY(10, 11.6), XY(0, 11.6)},
+	}
+	g := New(NoHeader)
+	VCarveFlat(g, shapes, 1, &VCarveOptions{Angle: 90, MaxDepth: Float(0.5), Resolution: Float(0.05), FlatStepover: Float(100)})
+	cuts := cutSegments(t, g.String())
+	for _, y := range []float64{3, 9.8} {
+		for x := 2.0; x <= 8; x += 0.5 {
+			p, d := XY(x, y), math.Inf(1)
+			for _, c := range cuts {
+				d = math.Min(d, segmentDistance(p, XY(c[0].X(), c[0].Y()), XY(c[1].X(), c[1].Y())))
+			}
+			if d > 0.5+0.05 {
+				t.Errorf("%v is %v from the nearest cut, want at most 0.5", p, d)
+			}
+		}
+	}
+}
+
+func TestSplitPaths(t *testing.T) {
+	vs := []Tuple{XYZ(0, 0, 1), XYZ(0, 0, 0), XYZ(1, 0, 0), XYZ(1, 1, 0), XYZ(1, 1, 1), XYZ(2, 2, 1), XYZ(2, 2, 0), XYZ(3, 2, 0), XYZ(3, 3, 0)}
+	got := SplitPaths(vs)
+	if len(got) != 2 || len(got[0]) != 3 || len(got[1]) != 3 || got[1][0] != XY(2, 2) {
+		t.Errorf("SplitPaths = %v, want 2 paths of 3 points", got)
+	}
+}